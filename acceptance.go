@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// acceptanceTimeout is how long a require_acceptance transfer waits for
+// the receiver before its hold expires: the funds go back to the sender
+// and the transfer fails with expired_hold.
+var acceptanceTimeout = 24 * time.Hour
+
+// holdSweepInterval is how often expired holds are released: a tenth of
+// acceptanceTimeout, so even a short timeout is kept closely, but at
+// least every second.
+func holdSweepInterval() time.Duration {
+	interval := acceptanceTimeout / 10
+	if interval <= 0 || interval > time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// holdForAcceptance reserves the sender's funds and parks t until the
+// receiver decides. It must be called with mu held, after checkTransfer.
+func holdForAcceptance(t Transaction) {
+	recordEvent(Event{Type: eventHeld, UserID: t.SenderID, TransactionID: t.ID, Amount: t.Amount + t.Fee})
+	acceptBy := time.Now().UTC().Add(acceptanceTimeout)
+	txMu.Lock()
+	defer txMu.Unlock()
+	stored, ok := transactions[t.ID]
+	if !ok {
+		return
+	}
+	stored.Status = statusAwaitingAcceptance
+	stored.AcceptBy = &acceptBy
+	transactions[t.ID] = stored
+}
+
+// awaitingAcceptance returns the stored transaction if it is still waiting
+// on the receiver. Callers hold mu, which every path that resolves a hold
+// takes, so the result can't go stale before they act on it.
+func awaitingAcceptance(id ID) (Transaction, *APIError) {
+	t, ok := getTransaction(id)
+	if !ok {
+		return t, newError(CodeTransactionNotFound, "Transaction not found")
+	}
+	if t.Status != statusAwaitingAcceptance {
+		return t, newError(CodeNotAwaitingAcceptance, "Transaction is not awaiting acceptance")
+	}
+	return t, nil
+}
+
+func releaseHold(t Transaction) {
+	recordEvent(Event{Type: eventReleased, UserID: t.SenderID, TransactionID: t.ID, Amount: t.Amount + t.Fee})
+}
+
+// acceptTransfer releases the hold and applies the transfer, re-checked
+// against current state; if it no longer passes it fails and the funds
+// stay with the sender.
+func acceptTransfer(id ID) (Transaction, *APIError) {
+	mu.Lock()
+	t, err := awaitingAcceptance(id)
+	if err != nil {
+		mu.Unlock()
+		return t, err
+	}
+	releaseHold(t)
+	var result error
+	if err := checkTransfer(db, t); err != nil {
+		result = failTransaction(t, err)
+	} else if err := commitTransfer(t); err != nil {
+		result = err
+	}
+	mu.Unlock()
+	runAfterHooks(context.Background(), id, result)
+	t, _ = getTransaction(id)
+	return t, nil
+}
+
+func rejectTransfer(id ID, reason *APIError) (Transaction, *APIError) {
+	mu.Lock()
+	t, err := awaitingAcceptance(id)
+	if err != nil {
+		mu.Unlock()
+		return t, err
+	}
+	releaseHold(t)
+	result := failTransaction(t, reason)
+	mu.Unlock()
+	runAfterHooks(context.Background(), id, result)
+	t, _ = getTransaction(id)
+	return t, nil
+}
+
+// expireAcceptances releases every hold whose accept_by has passed and
+// returns how many expired.
+func expireAcceptances(now time.Time) int {
+	var due []ID
+	txMu.Lock()
+	for _, t := range transactions {
+		if t.Status == statusAwaitingAcceptance && !t.AcceptBy.After(now) {
+			due = append(due, t.ID)
+		}
+	}
+	txMu.Unlock()
+
+	expired := 0
+	for _, id := range due {
+		if _, err := rejectTransfer(id, newError(CodeExpiredHold, "Receiver did not accept in time")); err == nil {
+			expired++
+		}
+	}
+	return expired
+}
+
+func runAcceptanceSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		expireAcceptances(now)
+	}
+}
+
+func AcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	resolveAcceptance(w, r, acceptTransfer)
+}
+
+func RejectTransfer(w http.ResponseWriter, r *http.Request) {
+	resolveAcceptance(w, r, func(id ID) (Transaction, *APIError) {
+		return rejectTransfer(id, newError(CodeRejectedByReceiver, "Receiver rejected the transfer"))
+	})
+}
+
+func resolveAcceptance(w http.ResponseWriter, r *http.Request, resolve func(ID) (Transaction, *APIError)) {
+	opts, err := parseResponseOptions(r, transactionFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	t, apiErr := resolve(ID(mux.Vars(r)["id"]))
+	if apiErr != nil {
+		status := 409
+		if apiErr.Code == CodeTransactionNotFound {
+			status = 404
+		}
+		writeAPIError(w, status, apiErr)
+		return
+	}
+	writeResponse(w, opts, t)
+}
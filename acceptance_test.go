@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeldTransferExpires(t *testing.T) {
+	resetStore(t)
+	acceptanceTimeout = 50 * time.Millisecond
+	defer func() { acceptanceTimeout = 24 * time.Hour }()
+	sender, receiver := newUser(t, true), newUser(t, true)
+
+	held := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 300, RequireAcceptance: true})
+	if held.Status != statusAwaitingAcceptance {
+		t.Fatalf("status %s, want %s", held.Status, statusAwaitingAcceptance)
+	}
+	u, _ := getUser(sender.ID)
+	if u.Held != 300 || u.available() != 700 || u.Balance != 1000 {
+		t.Fatalf("sender while held: balance %v held %v available %v", u.Balance, u.Held, u.available())
+	}
+
+	if n := expireAcceptances(time.Now()); n != 0 {
+		t.Fatalf("expired %d holds before the timeout", n)
+	}
+	if n := expireAcceptances(time.Now().Add(acceptanceTimeout)); n != 1 {
+		t.Fatalf("expired %d holds, want 1", n)
+	}
+	got, _ := getTransaction(held.ID)
+	if got.Status != statusFailed || got.Reason != string(CodeExpiredHold) {
+		t.Errorf("expired transfer: status %s reason %q", got.Status, got.Reason)
+	}
+	u, _ = getUser(sender.ID)
+	if u.Held != 0 || u.available() != u.Balance || u.Balance != 1000 {
+		t.Errorf("sender after expiry: balance %v held %v available %v", u.Balance, u.Held, u.available())
+	}
+	if balance(t, receiver.ID) != 1000 {
+		t.Errorf("receiver balance %v, want 1000", balance(t, receiver.ID))
+	}
+}
+
+func TestAcceptAndRejectHeldTransfers(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+
+	accepted := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 100, RequireAcceptance: true})
+	w := serve(t, "POST", "/transaction/"+string(accepted.ID)+"/accept", nil)
+	wantStatus(t, w, 200)
+	decode(t, w, &accepted)
+	if accepted.Status != statusCompleted {
+		t.Errorf("accepted transfer: status %s reason %q", accepted.Status, accepted.Reason)
+	}
+	wantStatus(t, serve(t, "POST", "/transaction/"+string(accepted.ID)+"/reject", nil), 409)
+
+	rejected := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 200, RequireAcceptance: true})
+	w = serve(t, "POST", "/transaction/"+string(rejected.ID)+"/reject", nil)
+	wantStatus(t, w, 200)
+	decode(t, w, &rejected)
+	if rejected.Status != statusFailed || rejected.Reason != string(CodeRejectedByReceiver) {
+		t.Errorf("rejected transfer: status %s reason %q", rejected.Status, rejected.Reason)
+	}
+
+	u, _ := getUser(sender.ID)
+	if u.Balance != 900 || u.Held != 0 {
+		t.Errorf("sender balance %v held %v, want 900 and 0", u.Balance, u.Held)
+	}
+	if balance(t, receiver.ID) != 1100 {
+		t.Errorf("receiver balance %v, want 1100", balance(t, receiver.ID))
+	}
+}
+
+// Held funds can't be spent elsewhere until the receiver decides, and the
+// receiver sees nothing until they accept.
+func TestHeldFundsAreReserved(t *testing.T) {
+	resetStore(t)
+	sender, receiver, other := newUser(t, true), newUser(t, true), newUser(t, true)
+
+	held := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 800, RequireAcceptance: true})
+	if held.Status != statusAwaitingAcceptance {
+		t.Fatalf("status %s, want %s", held.Status, statusAwaitingAcceptance)
+	}
+	if balance(t, receiver.ID) != 1000 {
+		t.Errorf("receiver balance %v before accepting, want 1000", balance(t, receiver.ID))
+	}
+	spend := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: other.ID, Amount: 300})
+	if spend.Status != statusFailed || spend.Reason != string(CodeInsufficientFunds) {
+		t.Errorf("spending held funds: status %s reason %q", spend.Status, spend.Reason)
+	}
+
+	wantStatus(t, serve(t, "POST", "/transaction/"+string(held.ID)+"/reject", nil), 200)
+	wantStatus(t, serve(t, "POST", "/transaction/"+string(held.ID)+"/accept", nil), 409)
+	spend = transfer(t, Transaction{SenderID: sender.ID, ReceiverID: other.ID, Amount: 300})
+	if spend.Status != statusCompleted {
+		t.Errorf("spending released funds: status %s reason %q", spend.Status, spend.Reason)
+	}
+	if balance(t, sender.ID) != 700 || balance(t, receiver.ID) != 1000 || balance(t, other.ID) != 1300 {
+		t.Errorf("balances %v, %v, %v; want 700, 1000, 1300", balance(t, sender.ID), balance(t, receiver.ID), balance(t, other.ID))
+	}
+
+	plain := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 1})
+	wantStatus(t, serve(t, "POST", "/transaction/"+string(plain.ID)+"/accept", nil), 409)
+}
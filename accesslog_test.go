@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestAccessLogFields(t *testing.T) {
+	resetStore(t)
+	var buf bytes.Buffer
+	accessLogger = log.New(&buf, "", 0)
+	defer func() { accessLogger = log.New(os.Stderr, "", log.LstdFlags) }()
+	u := newUser(t, true)
+
+	for _, c := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/user/" + string(u.ID), 200},
+		{"GET", "/user/999", 404},
+		{"POST", "/transaction", 400},
+		{"GET", "/no/such/route", 404},
+	} {
+		buf.Reset()
+		w := serve(t, c.method, c.path, "{", "X-Request-ID", "req-1")
+		if w.Code != c.status {
+			t.Fatalf("%s %s: status %d, want %d", c.method, c.path, w.Code, c.status)
+		}
+		want := fmt.Sprintf(`^request_id=req-1 method=%s path=%s status=%d size=%d duration=\S+\n$`,
+			c.method, regexp.QuoteMeta(c.path), c.status, w.Body.Len())
+		if !regexp.MustCompile(want).MatchString(buf.String()) {
+			t.Errorf("access log %q, want match for %s", buf.String(), want)
+		}
+		if got := w.Header().Get("X-Request-ID"); got != "req-1" {
+			t.Errorf("X-Request-ID %q, want the caller's", got)
+		}
+	}
+}
+
+func TestStatusRecorderKeepsFirstStatus(t *testing.T) {
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	rec.WriteHeader(409)
+	rec.WriteHeader(200)
+	rec.Write([]byte("abc"))
+	if rec.status != 409 || rec.size != 3 {
+		t.Errorf("recorded status %d size %d, want 409 and 3", rec.status, rec.size)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// adjustmentApprovalThreshold is the largest balance correction one admin
+// may apply alone; bigger ones wait for a second admin's approval.
+var adjustmentApprovalThreshold = 1000.0
+
+const (
+	adjustmentPending = "pending"
+	adjustmentApplied = "applied"
+)
+
+// Adjustment is an admin correction to a user's balance. The opposite
+// amount is booked to the currency reserve, so corrections move money
+// rather than mint it.
+type Adjustment struct {
+	ID         ID         `json:"id"`
+	UserID     ID         `json:"user_id"`
+	Amount     float64    `json:"amount"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	ProposedBy string     `json:"proposed_by"`
+	ApprovedBy string     `json:"approved_by,omitempty"`
+	ProposedAt time.Time  `json:"proposed_at"`
+	AppliedAt  *time.Time `json:"applied_at,omitempty"`
+}
+
+// adjustments is only kept in memory: applied ones are in the event log,
+// but pending ones don't survive a restart.
+var adjustmentsMu sync.Mutex
+var adjustments []Adjustment
+
+func needsApproval(amount float64) bool {
+	return math.Abs(amount) > adjustmentApprovalThreshold
+}
+
+// checkAdjustment must be called with mu held.
+func checkAdjustment(a Adjustment) *APIError {
+	u, ok := db[a.UserID]
+	if !ok {
+		return newError(CodeUserNotFound, "User not found")
+	}
+	if u.System {
+		return newError(CodeSystemAccount, "Reserve accounts can't be adjusted")
+	}
+	if u.Closed {
+		return newError(CodeAccountClosed, "Account is closed")
+	}
+	if err := checkPrecision(a.Amount, u.Currency); err != nil {
+		return err
+	}
+	if u.available()+a.Amount < 0 {
+		return newError(CodeInsufficientFunds, "Adjustment would take the balance below zero")
+	}
+	if math.IsInf(u.Balance+a.Amount, 0) {
+		return newError(CodeAmountOverflow, "Adjustment would overflow the balance")
+	}
+	return nil
+}
+
+// applyAdjustment must be called with mu held, after checkAdjustment.
+func applyAdjustment(a Adjustment) {
+	recordEvent(Event{Type: eventAdjusted, UserID: a.UserID, Amount: a.Amount})
+	creditReserve(db[a.UserID].Currency, -a.Amount)
+}
+
+// proposeAdjustment applies a at once if it is within the threshold and
+// otherwise stores it as pending.
+func proposeAdjustment(a Adjustment) (Adjustment, *APIError) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := checkAdjustment(a); err != nil {
+		return a, err
+	}
+	a.Status = adjustmentPending
+	a.ProposedAt = time.Now().UTC()
+	if !needsApproval(a.Amount) {
+		applyAdjustment(a)
+		a.Status = adjustmentApplied
+		a.AppliedAt = &a.ProposedAt
+	}
+	adjustmentsMu.Lock()
+	defer adjustmentsMu.Unlock()
+	a.ID = ID(strconv.Itoa(len(adjustments) + 1))
+	adjustments = append(adjustments, a)
+	return a, nil
+}
+
+// approveAdjustment applies a pending adjustment on behalf of approver,
+// who must not be the admin who proposed it. The checks are repeated
+// since the balance may have changed while it waited.
+func approveAdjustment(id ID, approver string) (before, after Adjustment, err *APIError) {
+	mu.Lock()
+	defer mu.Unlock()
+	adjustmentsMu.Lock()
+	defer adjustmentsMu.Unlock()
+	i, convErr := strconv.Atoi(string(id))
+	if convErr != nil || i < 1 || i > len(adjustments) {
+		return before, after, newError(CodeAdjustmentNotFound, "Adjustment not found")
+	}
+	before = adjustments[i-1]
+	if before.Status != adjustmentPending {
+		return before, after, newError(CodeAdjustmentNotPending, "Adjustment is already "+before.Status)
+	}
+	if approver == before.ProposedBy {
+		return before, after, newError(CodeSelfApproval, "An adjustment must be approved by a different admin")
+	}
+	if err := checkAdjustment(before); err != nil {
+		return before, after, err
+	}
+	applyAdjustment(before)
+	now := time.Now().UTC()
+	after = before
+	after.Status = adjustmentApplied
+	after.ApprovedBy = approver
+	after.AppliedAt = &now
+	adjustments[i-1] = after
+	return before, after, nil
+}
+
+// ProposeAdjustment handles POST /admin/adjustments. It answers 201 when
+// the adjustment was applied and 202 when it awaits approval.
+func ProposeAdjustment(w http.ResponseWriter, r *http.Request) {
+	var a Adjustment
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil || a.UserID == "" || a.Reason == "" {
+		writeError(w, 400, CodeBadRequest, "user_id, amount and reason are required")
+		return
+	}
+	if a.Amount == 0 || math.IsNaN(a.Amount) || math.IsInf(a.Amount, 0) {
+		writeError(w, 400, CodeInvalidAmount, "Amount must be a non-zero number")
+		return
+	}
+	a = Adjustment{UserID: a.UserID, Amount: a.Amount, Reason: a.Reason, ProposedBy: adminActor(r)}
+	a, err := proposeAdjustment(a)
+	if err != nil {
+		status := 400
+		if err.Code == CodeUserNotFound {
+			status = 404
+		} else if err.Code == CodeAccountClosed || err.Code == CodeInsufficientFunds {
+			status = 409
+		}
+		writeAPIError(w, status, err)
+		return
+	}
+	recordAudit(r, "adjustment.propose", string(a.ID), nil, a)
+	status := 201
+	if a.Status == adjustmentPending {
+		status = 202
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(a)
+}
+
+func ApproveAdjustment(w http.ResponseWriter, r *http.Request) {
+	id := ID(mux.Vars(r)["id"])
+	before, after, err := approveAdjustment(id, adminActor(r))
+	if err != nil {
+		status := 409
+		switch err.Code {
+		case CodeAdjustmentNotFound, CodeUserNotFound:
+			status = 404
+		case CodeSelfApproval:
+			status = 403
+		}
+		writeAPIError(w, status, err)
+		return
+	}
+	recordAudit(r, "adjustment.approve", string(id), before, after)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after)
+}
+
+// GetAdjustments pages through adjustments oldest first, optionally only
+// those with ?status=.
+func GetAdjustments(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	status := r.URL.Query().Get("status")
+	adjustmentsMu.Lock()
+	list := make([]Adjustment, 0, len(adjustments))
+	for _, a := range adjustments {
+		if status == "" || a.Status == status {
+			list = append(list, a)
+		}
+	}
+	adjustmentsMu.Unlock()
+
+	start, end, p := paginate(len(list), limit, offset)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Envelope{Data: list[start:end], Pagination: p})
+}
@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestAdjustmentNeedsSecondAdmin(t *testing.T) {
+	resetStore(t)
+	var err error
+	if adminKeys, err = parseAdminKeys("alice=alice-key,bob=bob-key"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { adminKeys = nil }()
+	u := newUser(t, true)
+
+	w := serve(t, "POST", "/admin/adjustments", Adjustment{UserID: u.ID, Amount: 50, Reason: "goodwill"}, "X-Admin-Key", "alice-key")
+	wantStatus(t, w, 201)
+	if balance(t, u.ID) != 1050 {
+		t.Errorf("small adjustment: balance %v, want 1050", balance(t, u.ID))
+	}
+
+	w = serve(t, "POST", "/admin/adjustments", Adjustment{UserID: u.ID, Amount: 5000, Reason: "migration"}, "X-Admin-Key", "alice-key")
+	wantStatus(t, w, 202)
+	var pending Adjustment
+	decode(t, w, &pending)
+	if pending.Status != adjustmentPending || pending.ProposedBy != "alice" || balance(t, u.ID) != 1050 {
+		t.Fatalf("large adjustment %+v, balance %v", pending, balance(t, u.ID))
+	}
+
+	approve := "/admin/adjustments/" + string(pending.ID) + "/approve"
+	wantStatus(t, serve(t, "POST", approve, nil, "X-Admin-Key", "alice-key"), 403)
+	// Naming someone else in a header doesn't make alice a second admin
+	wantStatus(t, serve(t, "POST", approve, nil, "X-Admin-Key", "alice-key", "X-Admin-Actor", "bob"), 403)
+
+	w = serve(t, "POST", approve, nil, "X-Admin-Key", "bob-key")
+	wantStatus(t, w, 200)
+	var applied Adjustment
+	decode(t, w, &applied)
+	if applied.Status != adjustmentApplied || applied.ProposedBy != "alice" || applied.ApprovedBy != "bob" {
+		t.Errorf("approved adjustment %+v", applied)
+	}
+	if balance(t, u.ID) != 6050 {
+		t.Errorf("balance %v after approval, want 6050", balance(t, u.ID))
+	}
+	if reserve := balance(t, systemAccounts[defaultCurrency]); reserve != -5050 {
+		t.Errorf("reserve %v, want -5050", reserve)
+	}
+	wantStatus(t, serve(t, "POST", approve, nil, "X-Admin-Key", "bob-key"), 409)
+}
+
+// Everyone on the shared key is one admin, so it can't approve what it
+// proposed.
+func TestSharedAdminKeyCantApproveItself(t *testing.T) {
+	resetStore(t)
+	u := newUser(t, true)
+	w := serve(t, "POST", "/admin/adjustments", Adjustment{UserID: u.ID, Amount: 5000, Reason: "migration"})
+	wantStatus(t, w, 202)
+	var pending Adjustment
+	decode(t, w, &pending)
+	wantStatus(t, serve(t, "POST", "/admin/adjustments/"+string(pending.ID)+"/approve", nil), 403)
+}
+
+func TestParseAdminKeys(t *testing.T) {
+	for _, spec := range []string{"alice", "alice=", "alice=k,alice=j", "alice=k,bob=k"} {
+		if _, err := parseAdminKeys(spec); err == nil {
+			t.Errorf("%q was accepted", spec)
+		}
+	}
+}
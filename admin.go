@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// adminKey must be sent as X-Admin-Key on every /admin route. It is
+// separate from any user-facing auth; if unset, admin routes are closed.
+// Everyone sharing it acts as one admin, so admins who need to be told
+// apart, e.g. to approve each other's adjustments, each get a named key in
+// adminKeys instead.
+var adminKey string
+
+// adminKeys maps each named admin key to its admin's name, which is
+// recorded as the actor of everything done with it. adminKeyList
+// configures it, e.g. "alice=key1,bob=key2".
+var adminKeyList string
+var adminKeys map[string]string
+
+func parseAdminKeys(spec string) (map[string]string, error) {
+	keys := make(map[string]string)
+	names := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("bad admin key %q, want name=key", part)
+		}
+		if names[kv[0]] {
+			return nil, fmt.Errorf("admin %q has more than one key", kv[0])
+		}
+		if _, dup := keys[kv[1]]; dup || kv[1] == adminKey {
+			return nil, fmt.Errorf("admin %q shares a key with another admin", kv[0])
+		}
+		names[kv[0]] = true
+		keys[kv[1]] = kv[0]
+	}
+	return keys, nil
+}
+
+type adminActorKey struct{}
+
+// matchAdminKey returns the actor a key authenticates: the admin's name
+// for a named key, and for the shared key a fingerprint of it (never the
+// key itself).
+func matchAdminKey(got string) (string, bool) {
+	if got == "" {
+		return "", false
+	}
+	actor, ok := "", false
+	for key, name := range adminKeys {
+		if subtle.ConstantTimeCompare([]byte(got), []byte(key)) == 1 {
+			actor, ok = name, true
+		}
+	}
+	if !ok && adminKey != "" && subtle.ConstantTimeCompare([]byte(got), []byte(adminKey)) == 1 {
+		sum := sha256.Sum256([]byte(adminKey))
+		actor, ok = "key:"+hex.EncodeToString(sum[:4]), true
+	}
+	return actor, ok
+}
+
+func requireAdminKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, ok := matchAdminKey(r.Header.Get("X-Admin-Key"))
+		if !ok {
+			writeError(w, 401, CodeUnauthorized, "Unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminActorKey{}, actor)))
+	})
+}
+
+// adminActor identifies who made an admin request from the key it was
+// authenticated with.
+func adminActor(r *http.Request) string {
+	actor, _ := r.Context().Value(adminActorKey{}).(string)
+	return actor
+}
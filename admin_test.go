@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestAdminRoutesNeedKey(t *testing.T) {
+	resetStore(t)
+	adminKeys = map[string]string{"alice-key": "alice"}
+	for _, c := range []struct {
+		key    string
+		status int
+	}{
+		{"", 401},
+		{"wrong", 401},
+		{"test-key-and-more", 401},
+		{"test-key", 200},
+		{"alice-key", 200},
+	} {
+		for _, path := range []string{"/admin/debug", "/admin/audit", "/v1/admin/blocklist"} {
+			if w := serve(t, "GET", path, nil, "X-Admin-Key", c.key); w.Code != c.status {
+				t.Errorf("GET %s with key %q: status %d, want %d", path, c.key, w.Code, c.status)
+			}
+		}
+	}
+	w := serve(t, "PUT", "/admin/blocklist/1", nil, "X-Admin-Key", "wrong")
+	wantStatus(t, w, 401)
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if apiErr.Code != CodeUnauthorized || isBlocked("1") {
+		t.Errorf("unauthorized write: code %q, blocked %v", apiErr.Code, isBlocked("1"))
+	}
+
+	// user routes don't need the admin key
+	wantStatus(t, serve(t, "GET", "/user", nil, "X-Admin-Key", ""), 200)
+}
+
+func TestAdminRoutesClosedWithoutKey(t *testing.T) {
+	resetStore(t)
+	adminKey = ""
+	wantStatus(t, serve(t, "GET", "/admin/debug", nil, "X-Admin-Key", ""), 401)
+}
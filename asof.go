@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type BalanceAsOf struct {
+	UserID  ID        `json:"user_id"`
+	AsOf    time.Time `json:"as_of"`
+	Balance float64   `json:"balance"`
+	Held    float64   `json:"held"`
+	// Available is what the user could have spent at AsOf.
+	Available float64 `json:"available_balance"`
+}
+
+// balanceAsOf replays the event log up to and including at. ok is false
+// if the user didn't exist yet.
+func balanceAsOf(id ID, at time.Time) (BalanceAsOf, bool) {
+	mu.RLock()
+	n := sort.Search(len(events), func(i int) bool { return events[i].At.After(at) })
+	u, ok := Replay(events[:n])[id]
+	mu.RUnlock()
+	if !ok {
+		return BalanceAsOf{}, false
+	}
+	return BalanceAsOf{UserID: id, AsOf: at, Balance: u.Balance, Held: u.Held, Available: u.available()}, true
+}
+
+// GetBalanceAsOf answers GET /user/{id}/balance?as_of=<RFC3339>, defaulting
+// to now. History starts at the oldest event, so for state restored from
+// a snapshot without events it starts at the restore.
+func GetBalanceAsOf(w http.ResponseWriter, r *http.Request) {
+	id := ID(mux.Vars(r)["id"])
+	at := time.Now().UTC()
+	if v := r.URL.Query().Get("as_of"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, 400, CodeBadRequest, "as_of must be RFC3339")
+			return
+		}
+		at = t.UTC()
+	}
+	if _, ok := getUser(id); !ok {
+		writeError(w, 404, CodeUserNotFound, "User not found")
+		return
+	}
+	b, ok := balanceAsOf(id, at)
+	if !ok {
+		writeError(w, 404, CodeUserNotFound, "User did not exist at as_of")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBalanceAsOf(t *testing.T) {
+	resetStore(t)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	alice, bob := newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 100})
+	transfer(t, Transaction{SenderID: bob.ID, ReceiverID: alice.ID, Amount: 30})
+	transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 5})
+	// one event a minute, so each transfer has its own point in history
+	mu.Lock()
+	for i := range events {
+		events[i].At = start.Add(time.Duration(i) * time.Minute)
+	}
+	transferAt := make(map[int]time.Time)
+	n := 0
+	for _, e := range events {
+		if e.Type == eventTransferred {
+			transferAt[n] = e.At
+			n++
+		}
+	}
+	mu.Unlock()
+	if n != 3 {
+		t.Fatalf("%d transfer events, want 3", n)
+	}
+
+	asOf := func(id ID, at time.Time) (int, BalanceAsOf) {
+		w := serve(t, "GET", "/user/"+string(id)+"/balance?as_of="+at.Format(time.RFC3339), nil)
+		var b BalanceAsOf
+		if w.Code == 200 {
+			decode(t, w, &b)
+		}
+		return w.Code, b
+	}
+	for _, c := range []struct {
+		at         time.Time
+		alice, bob float64
+	}{
+		{transferAt[0].Add(-time.Second), 1000, 1000},
+		{transferAt[0], 900, 1100},
+		{transferAt[1].Add(-time.Second), 900, 1100},
+		{transferAt[1], 930, 1070},
+		{transferAt[2].Add(time.Hour), 925, 1075},
+	} {
+		if code, b := asOf(alice.ID, c.at); code != 200 || b.Balance != c.alice || b.Available != c.alice {
+			t.Errorf("alice as of %v: %d %+v, want %v", c.at, code, b, c.alice)
+		}
+		if code, b := asOf(bob.ID, c.at); code != 200 || b.Balance != c.bob {
+			t.Errorf("bob as of %v: %d %+v, want %v", c.at, code, b, c.bob)
+		}
+	}
+
+	if code, _ := asOf(alice.ID, start.Add(-time.Hour)); code != 404 {
+		t.Errorf("before alice existed: status %d, want 404", code)
+	}
+	if code, _ := asOf("999", start.Add(time.Hour)); code != 404 {
+		t.Errorf("unknown user: status %d, want 404", code)
+	}
+	wantStatus(t, serve(t, "GET", "/user/"+string(alice.ID)+"/balance?as_of=yesterday", nil), 400)
+	var now BalanceAsOf
+	decode(t, serve(t, "GET", "/user/"+string(alice.ID)+"/balance", nil), &now)
+	if now.Balance != balance(t, alice.ID) {
+		t.Errorf("balance with no as_of %v, want the current %v", now.Balance, balance(t, alice.ID))
+	}
+}
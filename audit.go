@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditFile, if set, gets every admin audit entry appended as a JSON line
+// so the trail outlives the process.
+var auditFile string
+
+// AdminAuditEntry records one successful admin action. Entries are only
+// ever appended.
+type AdminAuditEntry struct {
+	Seq    int         `json:"seq"`
+	At     time.Time   `json:"at"`
+	Actor  string      `json:"actor"`
+	Action string      `json:"action"`
+	Target string      `json:"target,omitempty"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+var auditMu sync.Mutex
+var adminAudit []AdminAuditEntry
+
+func recordAudit(r *http.Request, action, target string, before, after interface{}) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	e := AdminAuditEntry{
+		Seq:    len(adminAudit) + 1,
+		At:     time.Now().UTC(),
+		Actor:  adminActor(r),
+		Action: action,
+		Target: target,
+		Before: before,
+		After:  after,
+	}
+	adminAudit = append(adminAudit, e)
+	if auditFile == "" {
+		return
+	}
+	if err := appendAuditLine(e); err != nil {
+		log.Println("audit:", err)
+	}
+}
+
+func appendAuditLine(e AdminAuditEntry) error {
+	f, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(e)
+}
+
+// GetAdminAudit pages through admin actions oldest first.
+func GetAdminAudit(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	auditMu.Lock()
+	start, end, p := paginate(len(adminAudit), limit, offset)
+	page := make([]AdminAuditEntry, end-start)
+	copy(page, adminAudit[start:end])
+	auditMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Envelope{Data: page, Pagination: p})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdminActionsAreAudited(t *testing.T) {
+	resetStore(t)
+	auditFile = filepath.Join(t.TempDir(), "audit.jsonl")
+	adminKeys = map[string]string{"alice-key": "alice"}
+	u := newUser(t, true)
+
+	wantStatus(t, serve(t, "PUT", "/admin/users/"+string(u.ID)+"/freeze", nil, "X-Admin-Key", "alice-key"), 204)
+	wantStatus(t, serve(t, "PUT", "/admin/blocklist/"+string(u.ID), nil), 204)
+	wantStatus(t, serve(t, "DELETE", "/admin/users/"+string(u.ID)+"/freeze", nil, "X-Admin-Key", "alice-key"), 204)
+	// a failed action is not audited
+	wantStatus(t, serve(t, "PUT", "/admin/users/999/freeze", nil), 404)
+
+	var page struct{ Data []AdminAuditEntry }
+	decode(t, serve(t, "GET", "/admin/audit", nil), &page)
+	want := []struct{ actor, action, field string }{
+		{"alice", "user.freeze", "frozen"},
+		{"key:", "blocklist.add", "blocked"},
+		{"alice", "user.unfreeze", "frozen"},
+	}
+	if len(page.Data) != len(want) {
+		t.Fatalf("%d audit entries, want %d: %+v", len(page.Data), len(want), page.Data)
+	}
+	for i, w := range want {
+		e := page.Data[i]
+		if e.Seq != i+1 || !strings.HasPrefix(e.Actor, w.actor) || e.Action != w.action || e.Target != string(u.ID) || e.At.IsZero() {
+			t.Errorf("entry %d: %+v, want %s by %s on %s", i, e, w.action, w.actor, u.ID)
+		}
+		before, _ := e.Before.(map[string]interface{})
+		after, _ := e.After.(map[string]interface{})
+		if before[w.field] == after[w.field] || after[w.field] == nil {
+			t.Errorf("entry %d: %s before %v after %v", i, w.field, e.Before, e.After)
+		}
+	}
+	if strings.Contains(page.Data[1].Actor, adminKey) {
+		t.Errorf("shared key recorded as actor %q", page.Data[1].Actor)
+	}
+
+	f, err := os.Open(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []AdminAuditEntry
+	for s := bufio.NewScanner(f); s.Scan(); {
+		var e AdminAuditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, e)
+	}
+	if len(lines) != len(want) || lines[2].Action != "user.unfreeze" {
+		t.Errorf("audit file has %+v", lines)
+	}
+}
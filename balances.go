@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// maxBalanceQueryIDs caps how many users one POST /users/balances may ask for.
+const maxBalanceQueryIDs = 500
+
+type BalanceQuery struct {
+	IDs []ID `json:"ids"`
+}
+
+type AccountBalance struct {
+	Balance   float64 `json:"balance"`
+	Available float64 `json:"available_balance"`
+	Currency  string  `json:"currency"`
+	Verified  bool    `json:"verified"`
+	Frozen    bool    `json:"frozen"`
+	Closed    bool    `json:"closed,omitempty"`
+}
+
+type BalanceResult struct {
+	Balances map[ID]AccountBalance `json:"balances"`
+	NotFound []ID                  `json:"not_found"`
+}
+
+// GetBalances looks up many users' balances in one round trip. IDs that
+// don't exist are listed in not_found rather than failing the request.
+func GetBalances(w http.ResponseWriter, r *http.Request) {
+	var q BalanceQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		writeError(w, 400, CodeBadRequest, "Bad request")
+		return
+	}
+	if len(q.IDs) > maxBalanceQueryIDs {
+		writeError(w, 400, CodeBadRequest, "Too many ids in one request")
+		return
+	}
+
+	res := BalanceResult{Balances: make(map[ID]AccountBalance), NotFound: []ID{}}
+	mu.RLock()
+	for _, id := range q.IDs {
+		u, ok := db[id]
+		if !ok {
+			res.NotFound = append(res.NotFound, id)
+			continue
+		}
+		res.Balances[id] = AccountBalance{
+			Balance:   u.Balance,
+			Available: u.available(),
+			Currency:  u.Currency,
+			Verified:  u.Verified,
+			Frozen:    u.Frozen,
+			Closed:    u.Closed,
+		}
+	}
+	mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"testing"
+)
+
+// Reads taken while transfers are applied always see every transfer
+// either fully applied or not at all.
+func TestReadsDuringTransfersAreConsistent(t *testing.T) {
+	resetStore(t)
+	var users []User
+	for i := 0; i < 5; i++ {
+		users = append(users, newUser(t, true))
+	}
+	total := func(list []User) float64 {
+		sum := 0.0
+		for _, u := range list {
+			sum += u.Balance
+		}
+		return sum
+	}
+	mu.RLock()
+	var all []User
+	for _, u := range db {
+		all = append(all, u)
+	}
+	mu.RUnlock()
+	want := total(all)
+
+	startWorkers(t, 4)
+	var ids []ID
+	for i := 0; i < 200; i++ {
+		tx := addTransaction(Transaction{SenderID: users[i%5].ID, ReceiverID: users[(i+1)%5].ID, Amount: float64(i%7 + 1), Currency: defaultCurrency})
+		ids = append(ids, tx.ID)
+		enqueueTransaction(tx)
+	}
+
+	var readers sync.WaitGroup
+	stop := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				var page struct{ Data []User }
+				decode(t, serve(t, "GET", "/user?limit=1000", nil), &page)
+				if got := total(page.Data); math.Abs(got-want) > 1e-9 {
+					t.Errorf("read a total of %v, want %v", got, want)
+					return
+				}
+			}
+		}()
+	}
+	for _, id := range ids {
+		waitFor(t, "transfer "+string(id), func() bool {
+			tx, _ := getTransaction(id)
+			return isTerminal(tx.Status)
+		})
+	}
+	close(stop)
+	readers.Wait()
+}
+
+func TestBulkBalances(t *testing.T) {
+	resetStore(t)
+	alice, bob := newUser(t, true), newUser(t, false)
+	if _, _, err := setFrozen(alice.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	w := serve(t, "POST", "/users/balances", BalanceQuery{IDs: []ID{alice.ID, "404", bob.ID, "405"}})
+	wantStatus(t, w, 200)
+	var res BalanceResult
+	decode(t, w, &res)
+	if len(res.Balances) != 2 {
+		t.Fatalf("found %d balances, want 2: %+v", len(res.Balances), res.Balances)
+	}
+	if a := res.Balances[alice.ID]; a.Balance != 1000 || !a.Verified || !a.Frozen {
+		t.Errorf("alice %+v, want 1000, verified and frozen", a)
+	}
+	if b := res.Balances[bob.ID]; b.Balance != 1000 || b.Verified || b.Frozen {
+		t.Errorf("bob %+v, want 1000, unverified and not frozen", b)
+	}
+	if len(res.NotFound) != 2 || res.NotFound[0] != "404" || res.NotFound[1] != "405" {
+		t.Errorf("not found %v, want [404 405]", res.NotFound)
+	}
+
+	ids := make([]ID, maxBalanceQueryIDs+1)
+	for i := range ids {
+		ids[i] = alice.ID
+	}
+	wantStatus(t, serve(t, "POST", "/users/balances", BalanceQuery{IDs: ids}), 400)
+}
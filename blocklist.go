@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+var blocklistMu sync.Mutex
+var blocklist map[ID]bool
+var blocklistFile string
+
+func isBlocked(id ID) bool {
+	blocklistMu.Lock()
+	defer blocklistMu.Unlock()
+	return blocklist[id]
+}
+
+func loadBlocklist(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var ids []ID
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return err
+	}
+	blocklistMu.Lock()
+	defer blocklistMu.Unlock()
+	for _, id := range ids {
+		blocklist[id] = true
+	}
+	return nil
+}
+
+// blockedIDs must be called with blocklistMu held.
+func blockedIDs() []ID {
+	ids := make([]ID, 0, len(blocklist))
+	for id := range blocklist {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+// saveBlocklist must be called with blocklistMu held.
+func saveBlocklist() error {
+	if blocklistFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(blockedIDs())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(blocklistFile, data, 0644)
+}
+
+// setBlocked reports whether id was blocked before the change. If the
+// change can't be saved it is undone, so the live blocklist never differs
+// from the one that would be reloaded.
+func setBlocked(id ID, blocked bool) (bool, error) {
+	blocklistMu.Lock()
+	defer blocklistMu.Unlock()
+	was := blocklist[id]
+	apply := func(on bool) {
+		if on {
+			blocklist[id] = true
+		} else {
+			delete(blocklist, id)
+		}
+	}
+	apply(blocked)
+	if err := saveBlocklist(); err != nil {
+		apply(was)
+		return was, err
+	}
+	return was, nil
+}
+
+// GetBlocklist pages through the blocked IDs in ID order.
+func GetBlocklist(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	blocklistMu.Lock()
+	ids := blockedIDs()
+	blocklistMu.Unlock()
+	start, end, p := paginate(len(ids), limit, offset)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Envelope{Data: ids[start:end], Pagination: p})
+}
+
+func BlockUser(w http.ResponseWriter, r *http.Request) {
+	updateBlocklist(w, r, true)
+}
+
+func UnblockUser(w http.ResponseWriter, r *http.Request) {
+	updateBlocklist(w, r, false)
+}
+
+func updateBlocklist(w http.ResponseWriter, r *http.Request, blocked bool) {
+	id := ID(mux.Vars(r)["id"])
+	was, err := setBlocked(id, blocked)
+	if err != nil {
+		writeError(w, 500, CodeInternal, "Error occured. Try again later")
+		return
+	}
+	action := "blocklist.remove"
+	if blocked {
+		action = "blocklist.add"
+	}
+	recordAudit(r, action, string(id), map[string]bool{"blocked": was}, map[string]bool{"blocked": blocked})
+	w.WriteHeader(204)
+}
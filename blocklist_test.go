@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockedAccounts(t *testing.T) {
+	resetStore(t)
+	alice, bob := newUser(t, true), newUser(t, true)
+
+	setBlocked(alice.ID, true)
+	got := transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 10})
+	if got.Status != statusFailed || got.Reason != string(CodeBlockedAccount) {
+		t.Errorf("blocked sender: status %s reason %q", got.Status, got.Reason)
+	}
+
+	setBlocked(alice.ID, false)
+	setBlocked(bob.ID, true)
+	got = transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 10})
+	if got.Status != statusFailed || got.Reason != string(CodeBlockedAccount) {
+		t.Errorf("blocked receiver: status %s reason %q", got.Status, got.Reason)
+	}
+	if balance(t, alice.ID) != 1000 || balance(t, bob.ID) != 1000 {
+		t.Errorf("blocked transfers moved money: %v, %v", balance(t, alice.ID), balance(t, bob.ID))
+	}
+
+	setBlocked(bob.ID, false)
+	got = transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 10})
+	if got.Status != statusCompleted {
+		t.Errorf("after unblocking: status %s reason %q", got.Status, got.Reason)
+	}
+	if balance(t, bob.ID) != 1010 {
+		t.Errorf("receiver balance %v, want 1010", balance(t, bob.ID))
+	}
+}
+
+func TestBlocklistEndpointsPersist(t *testing.T) {
+	resetStore(t)
+	blocklistFile = filepath.Join(t.TempDir(), "blocklist.json")
+
+	wantStatus(t, serve(t, "PUT", "/admin/blocklist/7", nil), 204)
+	wantStatus(t, serve(t, "PUT", "/admin/blocklist/9", nil), 204)
+	wantStatus(t, serve(t, "DELETE", "/admin/blocklist/7", nil), 204)
+
+	var page struct {
+		Data       []ID
+		Pagination Pagination
+	}
+	decode(t, serve(t, "GET", "/admin/blocklist", nil), &page)
+	if len(page.Data) != 1 || page.Data[0] != "9" || page.Pagination.Total != 1 {
+		t.Fatalf("blocklist %+v, want [9]", page)
+	}
+
+	blocklist = make(map[ID]bool)
+	if err := loadBlocklist(blocklistFile); err != nil {
+		t.Fatal(err)
+	}
+	if !isBlocked("9") || isBlocked("7") {
+		t.Errorf("reloaded blocklist %v, want only 9", blocklist)
+	}
+}
+
+// A change that can't be saved is undone, so it doesn't vanish on restart.
+func TestBlocklistSaveFailureIsUndone(t *testing.T) {
+	resetStore(t)
+	setBlocked("9", true)
+	blocklistFile = filepath.Join(t.TempDir(), "missing", "blocklist.json")
+
+	wantStatus(t, serve(t, "PUT", "/admin/blocklist/7", nil), 500)
+	wantStatus(t, serve(t, "DELETE", "/admin/blocklist/9", nil), 500)
+	if isBlocked("7") || !isBlocked("9") {
+		t.Errorf("blocklist %v after failed saves, want only 9", blocklist)
+	}
+}
+
+func TestBlocklistPages(t *testing.T) {
+	resetStore(t)
+	for _, id := range []ID{"3", "1", "2"} {
+		setBlocked(id, true)
+	}
+	var page struct {
+		Data       []ID
+		Pagination Pagination
+	}
+	decode(t, serve(t, "GET", "/admin/blocklist?limit=2&offset=1", nil), &page)
+	if len(page.Data) != 2 || page.Data[0] != "2" || page.Data[1] != "3" || page.Pagination.Total != 3 {
+		t.Errorf("second page %+v, want [2 3] of 3", page)
+	}
+}
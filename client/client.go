@@ -0,0 +1,218 @@
+// Package client is a typed Go client for the lemonade HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ID is a user or transaction ID. The server sends sequential IDs as JSON
+// numbers and UUIDs as strings; ID accepts both.
+type ID string
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.ParseInt(string(id), 10, 64); err == nil && strconv.FormatInt(n, 10) == string(id) {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+func (id *ID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = ID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("id must be a string or number: %s", data)
+	}
+	*id = ID(n.String())
+	return nil
+}
+
+type User struct {
+	ID          ID      `json:"id"`
+	Balance     float64 `json:"balance"`
+	Verified    bool    `json:"verified"`
+	Currency    string  `json:"currency"`
+	DisplayName string  `json:"display_name,omitempty"`
+	// AvailableBalance is Balance minus held and unsettled funds.
+	AvailableBalance float64 `json:"available_balance"`
+	Held             float64 `json:"held,omitempty"`
+}
+
+type Transaction struct {
+	ID          ID                `json:"id"`
+	SenderID    ID                `json:"sender_id"`
+	ReceiverID  ID                `json:"receiver_id"`
+	Amount      float64           `json:"amount"`
+	Currency    string            `json:"currency,omitempty"`
+	Category    string            `json:"category,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Status      string            `json:"status"`
+	Reason      string            `json:"reason,omitempty"`
+	Attempts    int               `json:"attempts"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+}
+
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type UserPage struct {
+	Data       []User     `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// APIError is returned for any non-2xx response. Code is the server's
+// machine-readable error code, e.g. "insufficient_funds".
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("lemonade: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// DefaultPrefix is the version prefix the server mounts its routes under.
+const DefaultPrefix = "/v1"
+
+type Client struct {
+	BaseURL string
+	// Prefix is put before every path, to match the server's -api-prefix.
+	// Empty calls the unprefixed routes.
+	Prefix     string
+	HTTPClient *http.Client
+	// Retries is how many extra attempts idempotent (GET) calls get on
+	// network errors and 5xx responses.
+	Retries int
+	// RetryWait is the delay before the first retry; it doubles each time.
+	RetryWait time.Duration
+}
+
+// New returns a Client for baseURL using DefaultPrefix. A nil httpClient
+// uses http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Prefix:     DefaultPrefix,
+		HTTPClient: httpClient,
+		Retries:    2,
+		RetryWait:  100 * time.Millisecond,
+	}
+}
+
+func (c *Client) CreateUser(ctx context.Context) (User, error) {
+	var u User
+	err := c.do(ctx, "POST", "/user", User{}, &u)
+	return u, err
+}
+
+// GetUser lists users a page at a time. A zero limit uses the server default.
+func (c *Client) GetUser(ctx context.Context, limit, offset int) (UserPage, error) {
+	path := fmt.Sprintf("/user?offset=%d", offset)
+	if limit > 0 {
+		path += fmt.Sprintf("&limit=%d", limit)
+	}
+	var page UserPage
+	err := c.get(ctx, path, &page)
+	return page, err
+}
+
+func (c *Client) GetUserByID(ctx context.Context, id ID) (User, error) {
+	var u User
+	err := c.get(ctx, "/user/"+url.PathEscape(string(id)), &u)
+	return u, err
+}
+
+func (c *Client) Transfer(ctx context.Context, senderID, receiverID ID, amount float64) (Transaction, error) {
+	in := Transaction{SenderID: senderID, ReceiverID: receiverID, Amount: amount}
+	var t Transaction
+	err := c.do(ctx, "POST", "/transaction", in, &t)
+	return t, err
+}
+
+func (c *Client) GetTransaction(ctx context.Context, id ID) (Transaction, error) {
+	var t Transaction
+	err := c.get(ctx, "/transaction/"+url.PathEscape(string(id)), &t)
+	return t, err
+}
+
+// get retries on transport errors and 5xx since GETs are safe to repeat.
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	wait := c.RetryWait
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = c.do(ctx, "GET", path, nil, out)
+		apiErr, isAPI := err.(*APIError)
+		if err == nil || (isAPI && apiErr.StatusCode < 500) || attempt >= c.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	prefix := "/" + strings.Trim(c.Prefix, "/")
+	if prefix == "/" {
+		prefix = ""
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+prefix+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		msg, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(msg, apiErr) != nil || apiErr.Code == "" {
+			apiErr.Message = strings.TrimSpace(string(msg))
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
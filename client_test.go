@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"lemonade/client"
+)
+
+// newTestClient serves the real router on prefix only, so the client
+// works only if it sends the prefix too.
+func newTestClient(t *testing.T, wrap func(http.Handler) http.Handler) *client.Client {
+	t.Helper()
+	var h http.Handler = newRouter(apiPrefix, false)
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c := client.New(srv.URL, srv.Client())
+	c.RetryWait = time.Millisecond
+	return c
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	resetStore(t)
+	c := newTestClient(t, nil)
+	ctx := context.Background()
+
+	alice, err := c.CreateUser(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := c.CreateUser(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []ID{ID(alice.ID), ID(bob.ID)} {
+		u, _ := getUser(id)
+		verifyUser(u)
+	}
+
+	sent, err := c.Transfer(ctx, alice.ID, bob.ID, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drainQueue(t)
+	got, err := c.GetTransaction(ctx, sent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != statusCompleted || got.Amount != 25 {
+		t.Errorf("transaction %+v, want completed for 25", got)
+	}
+	u, err := c.GetUserByID(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Balance != 1025 || !u.Verified {
+		t.Errorf("receiver %+v, want verified with 1025", u)
+	}
+	page, err := c.GetUser(ctx, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Data) != 1 || page.Pagination.Total < 2 {
+		t.Errorf("user page %+v", page)
+	}
+}
+
+func TestClientTypedErrors(t *testing.T) {
+	resetStore(t)
+	c := newTestClient(t, nil)
+	ctx := context.Background()
+
+	_, err := c.GetUserByID(ctx, "999")
+	apiErr, ok := err.(*client.APIError)
+	if !ok || apiErr.StatusCode != 404 || apiErr.Code != string(CodeUserNotFound) {
+		t.Errorf("unknown user: %#v", err)
+	}
+	_, err = c.Transfer(ctx, "1", "2", -5)
+	apiErr, ok = err.(*client.APIError)
+	if !ok || apiErr.StatusCode != 400 || apiErr.Code != string(CodeInvalidAmount) {
+		t.Errorf("negative amount: %#v", err)
+	}
+
+	c.Prefix = ""
+	_, err = c.GetUserByID(ctx, "1")
+	if apiErr, ok := err.(*client.APIError); !ok || apiErr.StatusCode != 404 {
+		t.Errorf("unprefixed call to a prefix-only server: %#v", err)
+	}
+}
+
+func TestClientRetriesOnlyIdempotentCalls(t *testing.T) {
+	resetStore(t)
+	var calls, failing int32
+	c := newTestClient(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			if atomic.AddInt32(&failing, -1) >= 0 {
+				writeError(w, 503, CodeOverloaded, "try again")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	ctx := context.Background()
+	u := newUser(t, true)
+
+	atomic.StoreInt32(&failing, 2)
+	if _, err := c.GetUserByID(ctx, client.ID(u.ID)); err != nil {
+		t.Errorf("GET after two 503s: %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("GET made %d calls, want 3", n)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	atomic.StoreInt32(&failing, 1)
+	_, err := c.CreateUser(ctx)
+	if apiErr, ok := err.(*client.APIError); !ok || apiErr.StatusCode != 503 {
+		t.Errorf("POST on 503: %#v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("POST made %d calls, want 1", n)
+	}
+}
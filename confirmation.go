@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Transfers above confirmationThreshold are held until confirmed with the
+// returned token. Zero disables confirmation.
+var confirmationThreshold float64
+var confirmationTTL = 5 * time.Minute
+
+var pendingConfirmations KeyStore
+
+type PendingConfirmation struct {
+	Token       string      `json:"confirmation_token"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+	Transaction Transaction `json:"transaction"`
+}
+
+func needsConfirmation(t Transaction) bool {
+	return confirmationThreshold > 0 && t.Amount > confirmationThreshold
+}
+
+func newConfirmationToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func requestConfirmation(w http.ResponseWriter, t Transaction) {
+	token, err := newConfirmationToken()
+	if err != nil {
+		writeError(w, 500, CodeInternal, "Error occured. Try again later")
+		return
+	}
+	pendingConfirmations.Set(token, t, confirmationTTL)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(202)
+	json.NewEncoder(w).Encode(PendingConfirmation{
+		Token:       token,
+		ExpiresAt:   time.Now().UTC().Add(confirmationTTL),
+		Transaction: t,
+	})
+}
+
+func ConfirmTransfer(w http.ResponseWriter, r *http.Request) {
+	if isShuttingDown() {
+		writeError(w, 503, CodeShuttingDown, "Server is shutting down. Try again later")
+		return
+	}
+	opts, err := parseResponseOptions(r, transactionFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	v, ok := pendingConfirmations.Pop(mux.Vars(r)["token"])
+	if !ok {
+		writeError(w, 404, CodeConfirmationNotFound, "Confirmation not found or expired")
+		return
+	}
+	enqueueTransfer(w, opts, v.(Transaction))
+}
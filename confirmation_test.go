@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLargeTransferNeedsConfirmation(t *testing.T) {
+	resetStore(t)
+	confirmationThreshold = 100
+	clock := &fakeClock{t: time.Now()}
+	pendingConfirmations = newClockedStore(clock)
+	sender, receiver := newUser(t, true), newUser(t, true)
+
+	w := serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 500})
+	wantStatus(t, w, 202)
+	var pending PendingConfirmation
+	decode(t, w, &pending)
+	if pending.Token == "" || len(transactions) != 0 {
+		t.Fatalf("large transfer was not held: %+v, %d stored", pending, len(transactions))
+	}
+
+	w = serve(t, "POST", "/transaction/"+pending.Token+"/confirm", nil)
+	wantStatus(t, w, 200)
+	var queued Transaction
+	decode(t, w, &queued)
+	drainQueue(t)
+	if got, _ := getTransaction(queued.ID); got.Status != statusCompleted || got.Amount != 500 {
+		t.Errorf("confirmed transfer: %+v", got)
+	}
+	wantStatus(t, serve(t, "POST", "/transaction/"+pending.Token+"/confirm", nil), 404)
+
+	w = serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 200})
+	wantStatus(t, w, 202)
+	decode(t, w, &pending)
+	clock.advance(confirmationTTL)
+	wantStatus(t, serve(t, "POST", "/transaction/"+pending.Token+"/confirm", nil), 404)
+
+	w = serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 50})
+	wantStatus(t, w, 200)
+	drainQueue(t)
+	if balance(t, receiver.ID) != 1000+500+50 {
+		t.Errorf("receiver balance %v, want %v", balance(t, receiver.ID), 1000+500+50)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+const maxDisplayNameLen = 64
+
+// Counterparty is the minimal public profile embedded in a transaction
+// with ?expand=counterparty.
+type Counterparty struct {
+	ID          ID     `json:"id"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+type ExpandedTransaction struct {
+	Transaction
+	Sender   *Counterparty `json:"sender,omitempty"`
+	Receiver *Counterparty `json:"receiver,omitempty"`
+}
+
+// parseExpand reports whether ?expand=counterparty was passed; it is the
+// only expansion there is.
+func parseExpand(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("expand") {
+	case "":
+		return false, nil
+	case "counterparty":
+		return true, nil
+	}
+	return false, errors.New("expand must be counterparty")
+}
+
+// expandCounterparties resolves every sender and receiver in list under a
+// single read lock rather than one lookup per transaction.
+func expandCounterparties(list []Transaction) []ExpandedTransaction {
+	out := make([]ExpandedTransaction, len(list))
+	mu.RLock()
+	defer mu.RUnlock()
+	profile := func(id ID) *Counterparty {
+		u, ok := db[id]
+		if !ok {
+			return nil
+		}
+		return &Counterparty{ID: u.ID, DisplayName: u.DisplayName}
+	}
+	for i, t := range list {
+		out[i] = ExpandedTransaction{Transaction: t, Sender: profile(t.SenderID), Receiver: profile(t.ReceiverID)}
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandCounterparty(t *testing.T) {
+	resetStore(t)
+	verificationEnabled = false
+	var alice, bob User
+	decode(t, serve(t, "POST", "/user", User{DisplayName: "  Alice  "}), &alice)
+	decode(t, serve(t, "POST", "/user", User{DisplayName: "Bob"}), &bob)
+	if alice.DisplayName != "Alice" {
+		t.Errorf("display name %q, want it trimmed to Alice", alice.DisplayName)
+	}
+	tx := transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 5})
+
+	var plain map[string]interface{}
+	decode(t, serve(t, "GET", "/transaction/"+string(tx.ID), nil), &plain)
+	if _, ok := plain["sender"]; ok {
+		t.Errorf("unexpanded transaction embeds the sender: %v", plain)
+	}
+	if _, ok := plain["receiver"]; ok {
+		t.Errorf("unexpanded transaction embeds the receiver: %v", plain)
+	}
+
+	var expanded ExpandedTransaction
+	decode(t, serve(t, "GET", "/transaction/"+string(tx.ID)+"?expand=counterparty", nil), &expanded)
+	if expanded.Sender == nil || expanded.Sender.DisplayName != "Alice" || expanded.Receiver == nil || expanded.Receiver.DisplayName != "Bob" {
+		t.Errorf("expanded transaction: sender %+v receiver %+v", expanded.Sender, expanded.Receiver)
+	}
+
+	var page struct{ Data []ExpandedTransaction }
+	decode(t, serve(t, "GET", "/transactions?user_id="+string(bob.ID)+"&expand=counterparty", nil), &page)
+	if len(page.Data) != 1 || page.Data[0].Sender == nil || page.Data[0].Sender.ID != alice.ID || page.Data[0].Sender.DisplayName != "Alice" {
+		t.Errorf("expanded history: %+v", page.Data)
+	}
+	if body := serve(t, "GET", "/transactions?user_id="+string(bob.ID), nil).Body.String(); strings.Contains(body, "Alice") {
+		t.Errorf("unexpanded history includes a display name: %s", body)
+	}
+
+	wantStatus(t, serve(t, "GET", "/transaction/"+string(tx.ID)+"?expand=everything", nil), 400)
+	wantStatus(t, serve(t, "POST", "/user", User{DisplayName: strings.Repeat("x", maxDisplayNameLen+1)}), 400)
+}
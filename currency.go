@@ -0,0 +1,41 @@
+package main
+
+import "math"
+
+var defaultCurrency = "USD"
+
+// currencyDecimals is the number of minor-unit digits each supported
+// currency allows.
+var currencyDecimals = map[string]int{
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"NGN": 2,
+	"JPY": 0,
+	"KWD": 3,
+	"BHD": 3,
+}
+
+func knownCurrency(code string) bool {
+	_, ok := currencyDecimals[code]
+	return ok
+}
+
+// checkPrecision rejects amounts with more decimal places than currency
+// allows, e.g. fractional yen.
+func checkPrecision(amount float64, currency string) *APIError {
+	d, ok := currencyDecimals[currency]
+	if !ok {
+		return newError(CodeUnknownCurrency, "Unknown currency")
+	}
+	scaled := amount * math.Pow10(d)
+	if math.Abs(scaled-math.Round(scaled)) > 1e-6 {
+		return newError(CodeInvalidAmountPrecision, "Amount has more decimal places than the currency allows")
+	}
+	return nil
+}
+
+func roundToPrecision(amount float64, currency string) float64 {
+	scale := math.Pow10(currencyDecimals[currency])
+	return math.Round(amount*scale) / scale
+}
@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestCurrencyPrecision(t *testing.T) {
+	resetStore(t)
+	newIn := func(currency string) User {
+		u, err := addUser(User{Currency: currency})
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifyUser(u)
+		return u
+	}
+	yenFrom, yenTo := newIn("JPY"), newIn("JPY")
+	usdFrom, usdTo := newIn("USD"), newIn("USD")
+
+	w := serve(t, "POST", "/transaction", Transaction{SenderID: yenFrom.ID, ReceiverID: yenTo.ID, Amount: 1.5})
+	wantStatus(t, w, 400)
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if apiErr.Code != CodeInvalidAmountPrecision {
+		t.Errorf("fractional yen: code %q", apiErr.Code)
+	}
+	wantStatus(t, serve(t, "POST", "/transaction", Transaction{SenderID: usdFrom.ID, ReceiverID: usdTo.ID, Amount: 1.5}), 200)
+	drainQueue(t)
+	if balance(t, usdTo.ID) != 1001.5 {
+		t.Errorf("USD receiver balance %v, want 1001.5", balance(t, usdTo.ID))
+	}
+
+	for _, c := range []struct {
+		amount   float64
+		currency string
+		ok       bool
+	}{
+		{2, "JPY", true},
+		{0.01, "USD", true},
+		{0.001, "USD", false},
+		{0.001, "KWD", true},
+		{0.0001, "BHD", false},
+		{1, "XYZ", false},
+	} {
+		if err := checkPrecision(c.amount, c.currency); (err == nil) != c.ok {
+			t.Errorf("checkPrecision(%v, %s) = %v", c.amount, c.currency, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// currencyLimits bounds how many transactions of each currency the worker
+// pool processes at once, so a flood in one ledger can't take every worker.
+// Empty disables it. "even" splits -workers-max evenly across currencies;
+// a list like "USD=6,EUR=2" sets those caps and splits what's left evenly
+// across the rest, with at least one worker each.
+var currencyLimits string
+
+var currencySlots *currencyLimiter
+
+// parseCurrencyLimits returns nil when limits are disabled.
+func parseCurrencyLimits(spec string, workers int) (map[string]int, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	limits := make(map[string]int)
+	if spec != "even" {
+		for _, part := range strings.Split(spec, ",") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 || !knownCurrency(kv[0]) {
+				return nil, fmt.Errorf("bad currency limit %q", part)
+			}
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad currency limit %q", part)
+			}
+			limits[kv[0]] = n
+			workers -= n
+		}
+	}
+	var rest []string
+	for c := range currencyDecimals {
+		if _, ok := limits[c]; !ok {
+			rest = append(rest, c)
+		}
+	}
+	sort.Strings(rest)
+	for _, c := range rest {
+		share := workers / len(rest)
+		if share < 1 {
+			share = 1
+		}
+		limits[c] = share
+	}
+	return limits, nil
+}
+
+// currencyLimiter never blocks a worker. A transaction over its currency's
+// cap is parked, and the worker that next frees a slot in that currency
+// runs it, so workers stay free for other currencies.
+type currencyLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]int
+	running map[string]int
+	parked  map[string][]Transaction
+}
+
+func newCurrencyLimiter(limits map[string]int) *currencyLimiter {
+	return &currencyLimiter{limits: limits, running: make(map[string]int), parked: make(map[string][]Transaction)}
+}
+
+// admit takes a slot for t, or parks it and returns false. Anything
+// already parked goes first so a currency's transfers keep their order.
+func (l *currencyLimiter) admit(t Transaction) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	max, ok := l.limits[t.Currency]
+	if !ok || (l.running[t.Currency] < max && len(l.parked[t.Currency]) == 0) {
+		l.running[t.Currency]++
+		return true
+	}
+	l.parked[t.Currency] = append(l.parked[t.Currency], t)
+	return false
+}
+
+// done frees the slot held for currency. If a transaction is parked it
+// inherits the slot and is returned for the caller to run.
+func (l *currencyLimiter) done(currency string) (Transaction, bool) {
+	if l == nil {
+		return Transaction{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if queue := l.parked[currency]; len(queue) > 0 {
+		next := queue[0]
+		l.parked[currency] = queue[1:]
+		return next, true
+	}
+	l.running[currency]--
+	return Transaction{}, false
+}
+
+func (l *currencyLimiter) parkedCount() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, q := range l.parked {
+		n += len(q)
+	}
+	return n
+}
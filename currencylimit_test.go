@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestParseCurrencyLimits(t *testing.T) {
+	if limits, err := parseCurrencyLimits("", 8); limits != nil || err != nil {
+		t.Errorf("empty spec: %v %v, want disabled", limits, err)
+	}
+	limits, err := parseCurrencyLimits("even", 2*len(currencyDecimals))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c := range currencyDecimals {
+		if limits[c] != 2 {
+			t.Errorf("even split gives %s %d workers, want 2", c, limits[c])
+		}
+	}
+	limits, err = parseCurrencyLimits("USD=6,EUR=2", 8+len(currencyDecimals)-2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits["USD"] != 6 || limits["EUR"] != 2 || limits["JPY"] != 1 {
+		t.Errorf("limits %v, want USD 6, EUR 2 and one each for the rest", limits)
+	}
+	for _, spec := range []string{"USD", "XYZ=1", "USD=0", "USD=two"} {
+		if _, err := parseCurrencyLimits(spec, 8); err == nil {
+			t.Errorf("bad spec %q was accepted", spec)
+		}
+	}
+}
+
+// A flood of USD transfers stuck in processing leaves workers free for
+// EUR.
+func TestCurrencyFloodDoesNotStarveOthers(t *testing.T) {
+	resetStore(t)
+	maxInFlightPerAccount = 0
+	senderSlots = newAccountLimiter(0)
+	currencySlots = newCurrencyLimiter(map[string]int{"USD": 1, "EUR": 1})
+	usd, usdReceiver := newUser(t, true), newUser(t, true)
+	eur, _ := addUser(User{Currency: "EUR"})
+	verifyUser(eur)
+	eurReceiver, _ := addUser(User{Currency: "EUR"})
+	gate := &gateHook{sender: usd.ID, open: make(chan struct{})}
+	registerTransactionHook(gate)
+	startWorkers(t, 3)
+
+	var flood []ID
+	for i := 0; i < 20; i++ {
+		tx := addTransaction(Transaction{SenderID: usd.ID, ReceiverID: usdReceiver.ID, Amount: 1, Currency: "USD"})
+		flood = append(flood, tx.ID)
+		enqueueTransaction(tx)
+	}
+	waitFor(t, "a USD transfer to be picked up", func() bool { return gate.held() == 1 })
+	waitFor(t, "the USD flood to be dequeued", func() bool { return len(transactionQueue) == 0 })
+
+	tx := addTransaction(Transaction{SenderID: eur.ID, ReceiverID: eurReceiver.ID, Amount: 5, Currency: "EUR"})
+	enqueueTransaction(tx)
+	waitFor(t, "the EUR transfer", hasStatus(tx.ID, statusCompleted))
+	if n := gate.held(); n != 1 {
+		t.Errorf("%d USD transfers processing at once, want the cap of 1", n)
+	}
+
+	close(gate.open)
+	for _, id := range flood {
+		waitFor(t, "USD transfer "+string(id), hasStatus(id, statusCompleted))
+	}
+	gate.mu.Lock()
+	defer gate.mu.Unlock()
+	if gate.most != 1 {
+		t.Errorf("up to %d USD transfers processed at once, want 1", gate.most)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const recentProcessedSize = 20
+
+// busyWorkers counts workers currently inside handleTransaction.
+var busyWorkers int32
+
+var processedMu sync.Mutex
+var recentProcessed []Transaction
+
+// rememberProcessed keeps the last few transactions workers finished an
+// attempt on, for the debug endpoint.
+func rememberProcessed(t Transaction) {
+	processedMu.Lock()
+	defer processedMu.Unlock()
+	recentProcessed = append(recentProcessed, t)
+	if len(recentProcessed) > recentProcessedSize {
+		recentProcessed = recentProcessed[len(recentProcessed)-recentProcessedSize:]
+	}
+}
+
+type DebugVars struct {
+	Goroutines          int            `json:"goroutines"`
+	InvariantViolations int            `json:"invariant_violations"`
+	WorkerPanics        int            `json:"worker_panics"`
+	Queues              map[string]int `json:"queues"`
+	Workers             WorkerVars     `json:"workers"`
+	GC                  GCVars         `json:"gc"`
+	RecentTransactions  []Transaction  `json:"recent_transactions"`
+}
+
+type WorkerVars struct {
+	Mode  string `json:"mode"`
+	Total int    `json:"total"`
+	Busy  int    `json:"busy"`
+}
+
+type GCVars struct {
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"pause_total_ns"`
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	NextGC       uint64 `json:"next_gc"`
+}
+
+func debugVars() DebugVars {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	workers := WorkerVars{Mode: "pool", Busy: int(atomic.LoadInt32(&busyWorkers))}
+	if orderBySender {
+		workers.Mode = "partitioned"
+		workers.Total = senderPartitions
+	} else if transactionPool != nil {
+		workers.Total = transactionPool.size()
+	}
+
+	processedMu.Lock()
+	recent := make([]Transaction, len(recentProcessed))
+	copy(recent, recentProcessed)
+	processedMu.Unlock()
+
+	return DebugVars{
+		Goroutines:          runtime.NumGoroutine(),
+		InvariantViolations: int(atomic.LoadInt32(&invariantViolations)),
+		WorkerPanics:        int(atomic.LoadInt32(&workerPanics)),
+		Queues: map[string]int{
+			"transactions":    len(transactionQueue),
+			"verifications":   len(verificationQueue),
+			"currency_parked": currencySlots.parkedCount(),
+			"sender_parked":   senderSlots.parkedCount(),
+		},
+		Workers: workers,
+		GC: GCVars{
+			NumGC:        ms.NumGC,
+			PauseTotalNs: ms.PauseTotalNs,
+			HeapAlloc:    ms.HeapAlloc,
+			HeapObjects:  ms.HeapObjects,
+			NextGC:       ms.NextGC,
+		},
+		RecentTransactions: recent,
+	}
+}
+
+func GetDebugVars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(debugVars())
+}
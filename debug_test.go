@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDebugVars(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	done := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 1})
+	for i := 0; i < 3; i++ {
+		enqueueTransaction(addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 1, Currency: defaultCurrency}))
+	}
+
+	w := serve(t, "GET", "/admin/debug", nil)
+	wantStatus(t, w, 200)
+	var raw map[string]json.RawMessage
+	decode(t, w, &raw)
+	for _, key := range []string{"goroutines", "invariant_violations", "worker_panics", "queues", "workers", "gc", "recent_transactions"} {
+		if _, ok := raw[key]; !ok {
+			t.Errorf("debug vars missing %q: %s", key, w.Body.String())
+		}
+	}
+	var vars DebugVars
+	decode(t, w, &vars)
+	if vars.Queues["transactions"] != 3 || vars.Queues["verifications"] != 0 {
+		t.Errorf("queue depths %v, want 3 transactions", vars.Queues)
+	}
+	if vars.Goroutines < 1 || vars.GC.HeapAlloc == 0 {
+		t.Errorf("runtime stats %+v", vars)
+	}
+	if n := len(vars.RecentTransactions); n != 1 || vars.RecentTransactions[0].ID != done.ID {
+		t.Errorf("recent transactions %+v, want only %s", vars.RecentTransactions, done.ID)
+	}
+
+	drainQueue(t)
+	decode(t, serve(t, "GET", "/admin/debug", nil), &vars)
+	if vars.Queues["transactions"] != 0 || len(vars.RecentTransactions) != 4 {
+		t.Errorf("after draining: queues %v, %d recent", vars.Queues, len(vars.RecentTransactions))
+	}
+	wantStatus(t, serve(t, "GET", "/admin/debug", nil, "X-Admin-Key", ""), 401)
+}
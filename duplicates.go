@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// duplicateWindow is how long an identical sender/receiver/amount transfer
+// is treated as a likely accidental resubmission. Zero disables the check.
+var duplicateWindow = 5 * time.Second
+
+var recentTransfers KeyStore
+
+// isDuplicateTransfer reports whether an identical transfer was seen within
+// the window, recording t as seen otherwise.
+func isDuplicateTransfer(t Transaction, now time.Time) bool {
+	if duplicateWindow <= 0 {
+		return false
+	}
+	sig := fmt.Sprintf("transfer:%s:%s:%v", t.SenderID, t.ReceiverID, t.Amount)
+	return !recentTransfers.SetIfAbsent(sig, now, duplicateWindow)
+}
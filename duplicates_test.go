@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuplicateTransfers(t *testing.T) {
+	resetStore(t)
+	duplicateWindow = 5 * time.Second
+	clock := &fakeClock{t: time.Now()}
+	recentTransfers = newClockedStore(clock)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	tx := Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10}
+
+	wantStatus(t, serve(t, "POST", "/transaction", tx), 200)
+	w := serve(t, "POST", "/transaction", tx)
+	wantStatus(t, w, 409)
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if apiErr.Code != CodePossibleDuplicate {
+		t.Errorf("repeat within the window: code %q", apiErr.Code)
+	}
+	wantStatus(t, serve(t, "POST", "/transaction", tx, "X-Allow-Duplicate", "true"), 200)
+
+	other := tx
+	other.Amount = 11
+	wantStatus(t, serve(t, "POST", "/transaction", other), 200)
+
+	clock.advance(duplicateWindow)
+	wantStatus(t, serve(t, "POST", "/transaction", tx), 200)
+
+	drainQueue(t)
+	if balance(t, receiver.ID) != 1000+10+10+11+10 {
+		t.Errorf("receiver balance %v, want %v", balance(t, receiver.ID), 1000+10+10+11+10)
+	}
+}
+
+func TestDuplicateWindowDisabled(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	tx := Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10}
+	wantStatus(t, serve(t, "POST", "/transaction", tx), 200)
+	wantStatus(t, serve(t, "POST", "/transaction", tx), 200)
+}
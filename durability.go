@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	durabilityShutdown = "shutdown"
+	durabilityAsync    = "async"
+	durabilitySync     = "sync"
+)
+
+// durability decides when accepted transfers reach stateFile. "shutdown"
+// only saves on a clean exit. "async" also saves every flushInterval, so a
+// crash loses at most that much. "sync" appends each transfer to a journal
+// beside stateFile before Transfer answers, so an accepted transfer
+// survives a crash; the full state is still only snapshotted every
+// flushInterval, which empties the journal.
+var durability = durabilityShutdown
+var flushInterval = time.Second
+
+// saveMu serializes snapshots, which share one temp file, and journal
+// appends, so nothing is appended between a snapshot and the journal
+// being emptied.
+var saveMu sync.Mutex
+
+func journalPath() string {
+	return stateFile + ".journal"
+}
+
+// persistState never saves in read-only mode, which would replace the
+// state that failed the self-test. Every journaled transfer was added
+// before the snapshot was taken, so the journal is emptied once it is
+// written.
+func persistState() error {
+	if readOnly {
+		return nil
+	}
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	if err := saveState(stateFile); err != nil {
+		return err
+	}
+	if err := os.Remove(journalPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// appendJournal writes t to the journal, one JSON object per line, and
+// syncs it to disk.
+func appendJournal(t Transaction) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	f, err := os.OpenFile(journalPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readJournal returns the transfers journaled since the last snapshot. A
+// crash mid-append can leave a torn last line, which was never
+// acknowledged and is skipped.
+func readJournal(path string) ([]Transaction, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []Transaction
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var t Transaction
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			log.Printf("journal: skipping unreadable entry: %v", err)
+			continue
+		}
+		list = append(list, t)
+	}
+	return list, scanner.Err()
+}
+
+// withJournal adds to s every journaled transfer the snapshot doesn't
+// have yet, as queued, so restoring s runs it.
+func withJournal(s State, journal []Transaction) State {
+	saved := make(map[ID]bool, len(s.Transactions))
+	for _, t := range s.Transactions {
+		saved[t.ID] = true
+	}
+	for _, t := range journal {
+		if !saved[t.ID] {
+			saved[t.ID] = true
+			t.Status = statusQueued
+			s.Transactions = append(s.Transactions, t)
+		}
+	}
+	return s
+}
+
+func validDurability(mode string) bool {
+	return mode == durabilityShutdown || mode == durabilityAsync || mode == durabilitySync
+}
+
+func runStateFlusher(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := persistState(); err != nil {
+			log.Println("flushing state: ", err)
+		}
+	}
+}
+
+// persistAccepted applies the sync guarantee to a just-added transfer.
+func persistAccepted(t Transaction) *APIError {
+	if durability != durabilitySync || readOnly {
+		return nil
+	}
+	if err := appendJournal(t); err != nil {
+		log.Println("persisting transfer: ", err)
+		failTransaction(t, newError(CodeNotPersisted, "Transfer could not be saved"))
+		return newError(CodeNotPersisted, "Transfer could not be saved. Try again later")
+	}
+	return nil
+}
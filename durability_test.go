@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// crashAndRestart drops everything in memory, as a crash would, and
+// restarts from the state file, running whatever it requeues.
+func crashAndRestart(t *testing.T) {
+	t.Helper()
+	path := stateFile
+	resetStore(t)
+	stateFile = path
+	if err := loadState(path); err != nil {
+		t.Fatal(err)
+	}
+	drainQueue(t)
+}
+
+// submitQueued submits a transfer that stays queued, since no workers
+// are running, and returns its ID.
+func submitQueued(t *testing.T, sender, receiver ID) ID {
+	t.Helper()
+	w := serve(t, "POST", "/transaction", Transaction{SenderID: sender, ReceiverID: receiver, Amount: 40}, "X-Allow-Duplicate", "true")
+	wantStatus(t, w, 200)
+	var q QueuedTransaction
+	decode(t, w, &q)
+	return q.ID
+}
+
+func TestSyncDurabilitySurvivesCrash(t *testing.T) {
+	resetStore(t)
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	sender, receiver := newUser(t, true), newUser(t, true)
+	durability = durabilitySync
+	if err := persistState(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := submitQueued(t, sender.ID, receiver.ID)
+	if after, _ := ioutil.ReadFile(stateFile); !bytes.Equal(after, snapshot) {
+		t.Error("accepting a transfer rewrote the state file")
+	}
+	if journal, _ := readJournal(journalPath()); len(journal) != 1 || journal[0].ID != id {
+		t.Fatalf("journal %+v, want just %s", journal, id)
+	}
+
+	crashAndRestart(t)
+	if got, ok := getTransaction(id); !ok || got.Status != statusCompleted {
+		t.Fatalf("accepted transfer after a crash: %+v (found %v)", got, ok)
+	}
+	if balance(t, sender.ID) != 960 || balance(t, receiver.ID) != 1040 {
+		t.Errorf("balances %v and %v after restart, want 960 and 1040", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+}
+
+// A snapshot takes over the journal: transfers from before it are loaded
+// once from the snapshot and later ones from the journal.
+func TestSyncSnapshotEmptiesJournal(t *testing.T) {
+	resetStore(t)
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	sender, receiver := newUser(t, true), newUser(t, true)
+	durability = durabilitySync
+	first := submitQueued(t, sender.ID, receiver.ID)
+	// the flusher's next tick
+	if err := persistState(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(journalPath()); !os.IsNotExist(err) {
+		t.Errorf("journal still there after a snapshot: %v", err)
+	}
+	second := submitQueued(t, sender.ID, receiver.ID)
+
+	// a torn entry from a crash mid-append is skipped
+	f, err := os.OpenFile(journalPath(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"9`)
+	f.Close()
+
+	crashAndRestart(t)
+	for _, id := range []ID{first, second} {
+		if got, ok := getTransaction(id); !ok || got.Status != statusCompleted {
+			t.Errorf("transfer %s after a crash: %+v (found %v)", id, got, ok)
+		}
+	}
+	if balance(t, sender.ID) != 920 {
+		t.Errorf("sender balance %v after restart, want 920", balance(t, sender.ID))
+	}
+}
+
+func TestSyncDurabilityRefusesUnsavedTransfers(t *testing.T) {
+	resetStore(t)
+	stateFile = filepath.Join(t.TempDir(), "missing", "state.json")
+	sender, receiver := newUser(t, true), newUser(t, true)
+	durability = durabilitySync
+
+	w := serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 40})
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if w.Code != 503 || apiErr.Code != CodeNotPersisted {
+		t.Fatalf("unsaveable transfer: %d %+v", w.Code, apiErr)
+	}
+	if len(transactionQueue) != 0 {
+		t.Error("a transfer that wasn't saved was queued")
+	}
+	txMu.Lock()
+	defer txMu.Unlock()
+	for _, tx := range transactions {
+		if tx.Status != statusFailed || tx.Reason != string(CodeNotPersisted) {
+			t.Errorf("unsaved transfer %s: status %s reason %q", tx.ID, tx.Status, tx.Reason)
+		}
+	}
+}
+
+func TestAsyncDurabilityLosesUnflushedTransfers(t *testing.T) {
+	resetStore(t)
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	sender, receiver := newUser(t, true), newUser(t, true)
+	durability = durabilityAsync
+	if err := persistState(); err != nil {
+		t.Fatal(err)
+	}
+
+	flushed := submitQueued(t, sender.ID, receiver.ID)
+	// the flusher's next tick
+	if err := persistState(); err != nil {
+		t.Fatal(err)
+	}
+	lost := submitQueued(t, sender.ID, receiver.ID)
+
+	crashAndRestart(t)
+	if got, ok := getTransaction(flushed); !ok || got.Status != statusCompleted {
+		t.Errorf("flushed transfer after a crash: %+v (found %v)", got, ok)
+	}
+	if _, ok := getTransaction(lost); ok {
+		t.Error("transfer accepted after the last flush survived the crash")
+	}
+	if balance(t, sender.ID) != 960 {
+		t.Errorf("sender balance %v after restart, want 960", balance(t, sender.ID))
+	}
+}
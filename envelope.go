@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// debugEnvelopes wraps every JSON response in a DebugEnvelope. A single
+// request can opt in with X-Debug-Envelope: true instead.
+var debugEnvelopes bool
+
+// DebugEnvelope correlates a response with server logs. Data is the body
+// the handler would have sent on its own.
+type DebugEnvelope struct {
+	RequestID  string          `json:"request_id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	DurationMs float64         `json:"duration_ms"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// bufferedResponse holds the status and body back so they can be wrapped.
+// Headers go straight to the real writer. Only JSON is buffered: anything
+// else, such as a streamed export, is passed through unwrapped from its
+// first write, flushes included.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+	direct bool
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status != 0 {
+		return
+	}
+	b.status = code
+	if !strings.HasPrefix(b.Header().Get("Content-Type"), "application/json") {
+		b.direct = true
+		b.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.direct {
+		return b.ResponseWriter.Write(p)
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) Flush() {
+	if f, ok := b.ResponseWriter.(http.Flusher); ok && b.direct {
+		f.Flush()
+	}
+}
+
+func debugEnvelope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !debugEnvelopes && r.Header.Get("X-Debug-Envelope") != "true" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		buf := &bufferedResponse{ResponseWriter: w}
+		next.ServeHTTP(buf, r)
+		if buf.direct {
+			return
+		}
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+
+		body := buf.body.Bytes()
+		if len(body) > 0 {
+			wrapped, err := json.Marshal(DebugEnvelope{
+				RequestID:  requestID(r),
+				Timestamp:  time.Now().UTC(),
+				DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+				Data:       json.RawMessage(bytes.TrimSpace(body)),
+			})
+			if err == nil {
+				body = append(wrapped, '\n')
+			}
+		}
+		w.WriteHeader(buf.status)
+		w.Write(body)
+	})
+}
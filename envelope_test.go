@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebugEnvelope(t *testing.T) {
+	resetStore(t)
+	u := newUser(t, true)
+
+	var plain User
+	decode(t, serve(t, "GET", "/user/"+string(u.ID), nil), &plain)
+	if plain.ID != u.ID {
+		t.Errorf("unwrapped response %+v", plain)
+	}
+
+	var env struct {
+		RequestID  string  `json:"request_id"`
+		DurationMs float64 `json:"duration_ms"`
+		Timestamp  string  `json:"timestamp"`
+		Data       User    `json:"data"`
+	}
+	w := serve(t, "GET", "/user/"+string(u.ID), nil, "X-Debug-Envelope", "true")
+	decode(t, w, &env)
+	if env.RequestID == "" || env.RequestID != w.Header().Get("X-Request-ID") || env.Timestamp == "" || env.Data.ID != u.ID {
+		t.Errorf("envelope %+v", env)
+	}
+
+	debugEnvelopes = true
+	env.Data = User{}
+	decode(t, serve(t, "GET", "/user/"+string(u.ID), nil), &env)
+	if env.Data.ID != u.ID {
+		t.Errorf("envelope with -debug-envelope: %+v", env)
+	}
+}
+
+// Streamed exports aren't buffered into an envelope.
+func TestDebugEnvelopeSkipsStreams(t *testing.T) {
+	resetStore(t)
+	debugEnvelopes = true
+	a, b := newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: a.ID, ReceiverID: b.ID, Amount: 1})
+	transfer(t, Transaction{SenderID: a.ID, ReceiverID: b.ID, Amount: 2})
+
+	w := serve(t, "GET", "/transactions/export", nil)
+	wantStatus(t, w, 200)
+	if !w.Flushed {
+		t.Error("export was not flushed through the envelope middleware")
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 || strings.Contains(w.Body.String(), "request_id") {
+		t.Errorf("export body %q", w.Body.String())
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ErrorCode is a stable, machine-readable failure reason. The same codes
+// are used in HTTP error bodies and as transaction status reasons.
+type ErrorCode string
+
+const (
+	CodeBadRequest             ErrorCode = "bad_request"
+	CodeInternal               ErrorCode = "internal_error"
+	CodeUnauthorized           ErrorCode = "unauthorized"
+	CodeShuttingDown           ErrorCode = "shutting_down"
+	CodeNotFound               ErrorCode = "not_found"
+	CodeUserNotFound           ErrorCode = "user_not_found"
+	CodeReceiverNotFound       ErrorCode = "receiver_not_found"
+	CodeTransactionNotFound    ErrorCode = "transaction_not_found"
+	CodeConfirmationNotFound   ErrorCode = "confirmation_not_found"
+	CodeBlockedAccount         ErrorCode = "blocked_account"
+	CodeInsufficientFunds      ErrorCode = "insufficient_funds"
+	CodeAmountOverflow         ErrorCode = "amount_overflow"
+	CodeConditionNotMet        ErrorCode = "condition_not_met"
+	CodeSenderUnverified       ErrorCode = "sender_unverified"
+	CodeReceiverUnverified     ErrorCode = "receiver_unverified"
+	CodeInvalidAmount          ErrorCode = "invalid_amount"
+	CodeUnknownCurrency        ErrorCode = "unknown_currency"
+	CodeInvalidAmountPrecision ErrorCode = "invalid_amount_precision"
+	CodeCurrencyMismatch       ErrorCode = "currency_mismatch"
+	CodeSystemAccount          ErrorCode = "system_account"
+	CodeInvalidCategory        ErrorCode = "invalid_category"
+	CodeInvalidMetadata        ErrorCode = "invalid_metadata"
+	CodePossibleDuplicate      ErrorCode = "possible_duplicate"
+	CodeUserRateLimited        ErrorCode = "user_rate_limited"
+	CodeStoreNotEmpty          ErrorCode = "store_not_empty"
+	CodeAccountClosed          ErrorCode = "account_closed"
+	CodeAccountFrozen          ErrorCode = "account_frozen"
+	CodeOverloaded             ErrorCode = "overloaded"
+	CodeNotAwaitingAcceptance  ErrorCode = "not_awaiting_acceptance"
+	CodeRejectedByReceiver     ErrorCode = "rejected_by_receiver"
+	CodeExpiredHold            ErrorCode = "expired_hold"
+	CodeFundsHeld              ErrorCode = "funds_held"
+	CodeNotRetryable           ErrorCode = "not_retryable"
+	CodeInvariantViolation     ErrorCode = "invariant_violation"
+	CodeSignatureRequired      ErrorCode = "signature_required"
+	CodeInvalidSignature       ErrorCode = "invalid_signature"
+	CodeSignatureExpired       ErrorCode = "signature_expired"
+	CodeSignatureReplayed      ErrorCode = "signature_replayed"
+	CodeNotPersisted           ErrorCode = "not_persisted"
+	CodeMalformedTransaction   ErrorCode = "malformed_transaction"
+	CodeProcessingPanic        ErrorCode = "processing_panic"
+	CodeAdjustmentNotFound     ErrorCode = "adjustment_not_found"
+	CodeAdjustmentNotPending   ErrorCode = "adjustment_not_pending"
+	CodeSelfApproval           ErrorCode = "self_approval"
+	CodeFlaggedForReview       ErrorCode = "flagged_for_review"
+	CodeNotInReview            ErrorCode = "not_in_review"
+	CodeRejectedInReview       ErrorCode = "rejected_in_review"
+	CodeReadOnly               ErrorCode = "read_only"
+	CodeRateUnavailable        ErrorCode = "rate_unavailable"
+	CodeSplitRolledBack        ErrorCode = "split_rolled_back"
+)
+
+// APIError is both the error value passed around internally and the JSON
+// body returned to clients. Error() returns the bare code so it can be
+// stored directly as a transaction reason.
+type APIError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return string(e.Code)
+}
+
+func newError(code ErrorCode, message string) *APIError {
+	return &APIError{Code: code, Message: message}
+}
+
+func writeError(w http.ResponseWriter, status int, code ErrorCode, message string) {
+	writeAPIError(w, status, newError(code, message))
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err *APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(err)
+}
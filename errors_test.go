@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestHTTPErrorCodes(t *testing.T) {
+	resetStore(t)
+	u, other := newUser(t, true), newUser(t, true)
+	for _, c := range []struct {
+		method, path string
+		body         interface{}
+		status       int
+		code         ErrorCode
+	}{
+		{"GET", "/user/999", nil, 404, CodeUserNotFound},
+		{"GET", "/transaction/999", nil, 404, CodeTransactionNotFound},
+		{"GET", "/no/such/route", nil, 404, CodeNotFound},
+		{"POST", "/transaction", "{", 400, CodeBadRequest},
+		{"POST", "/transaction", Transaction{SenderID: u.ID, ReceiverID: other.ID, Amount: -1}, 400, CodeInvalidAmount},
+		{"POST", "/transaction", Transaction{SenderID: u.ID, ReceiverID: other.ID, Amount: 1, Currency: "XYZ"}, 400, CodeUnknownCurrency},
+		{"POST", "/transaction", Transaction{SenderID: u.ID, ReceiverID: other.ID, Amount: 1.234}, 400, CodeInvalidAmountPrecision},
+		{"POST", "/transaction", Transaction{SenderID: u.ID, ReceiverID: other.ID, Amount: 1, Category: "bribes"}, 400, CodeInvalidCategory},
+		{"POST", "/transaction/nope/confirm", nil, 404, CodeConfirmationNotFound},
+		{"POST", "/transaction/999/accept", nil, 404, CodeTransactionNotFound},
+		{"POST", "/admin/transaction/999/retry", nil, 404, CodeTransactionNotFound},
+	} {
+		w := serve(t, c.method, c.path, c.body)
+		var apiErr APIError
+		decode(t, w, &apiErr)
+		if w.Code != c.status || apiErr.Code != c.code || apiErr.Message == "" {
+			t.Errorf("%s %s: %d %+v, want %d %s", c.method, c.path, w.Code, apiErr, c.status, c.code)
+		}
+	}
+	wantStatus(t, serve(t, "GET", "/admin/debug", nil, "X-Admin-Key", "wrong"), 401)
+}
+
+func TestTransactionReasonCodes(t *testing.T) {
+	resetStore(t)
+	u, other := newUser(t, true), newUser(t, true)
+	eur, _ := addUser(User{Currency: "EUR"})
+	frozen, closed := newUser(t, true), newUser(t, true)
+	wantStatus(t, serve(t, "PUT", "/admin/users/"+string(frozen.ID)+"/freeze", nil), 204)
+	if _, _, err := mergeUsers(closed.ID, other.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		tx   Transaction
+		code ErrorCode
+	}{
+		{Transaction{SenderID: u.ID, ReceiverID: other.ID, Amount: 5000}, CodeInsufficientFunds},
+		{Transaction{SenderID: "999", ReceiverID: other.ID, Amount: 1}, CodeUserNotFound},
+		{Transaction{SenderID: u.ID, ReceiverID: "999", Amount: 1}, CodeReceiverNotFound},
+		{Transaction{SenderID: u.ID, ReceiverID: eur.ID, Amount: 1}, CodeCurrencyMismatch},
+		{Transaction{SenderID: u.ID, ReceiverID: systemAccounts[defaultCurrency], Amount: 1}, CodeSystemAccount},
+		{Transaction{SenderID: u.ID, ReceiverID: frozen.ID, Amount: 1}, CodeAccountFrozen},
+		{Transaction{SenderID: u.ID, ReceiverID: closed.ID, Amount: 1}, CodeAccountClosed},
+		{Transaction{SenderID: u.ID, ReceiverID: other.ID, Amount: 1, MinBalanceBefore: floatPtr(2000)}, CodeConditionNotMet},
+	} {
+		got := transfer(t, c.tx)
+		if got.Status != statusFailed || got.Reason != string(c.code) {
+			t.Errorf("%+v: status %s reason %q, want %s", c.tx, got.Status, got.Reason, c.code)
+		}
+	}
+}
+
+func floatPtr(f float64) *float64 { return &f }
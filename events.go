@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	eventUserCreated  = "user_created"
+	eventVerified     = "verified"
+	eventTransferred  = "transferred"
+	eventAdjusted     = "adjusted"
+	eventThresholdSet = "threshold_set"
+	eventSettled      = "settled"
+	eventMerged       = "merged"
+	eventHeld         = "held"
+	eventReleased     = "released"
+	eventFrozen       = "frozen"
+	eventUnfrozen     = "unfrozen"
+
+	eventVerificationRejected = "verification_rejected"
+	eventNotificationsSet     = "notifications_set"
+	eventConverted            = "converted"
+	eventRolledBack           = "rolled_back"
+)
+
+// Event is one entry in the append-only log that is the source of truth
+// for account state. db is only a projection of it: every change to a
+// user goes through recordEvent, and Replay rebuilds db from scratch.
+type Event struct {
+	Seq           int       `json:"seq"`
+	Type          string    `json:"type"`
+	At            time.Time `json:"at"`
+	UserID        ID        `json:"user_id"`
+	User          *User     `json:"user,omitempty"`
+	ReceiverID    ID        `json:"receiver_id,omitempty"`
+	TransactionID ID        `json:"transaction_id,omitempty"`
+	Amount        float64   `json:"amount,omitempty"`
+	Threshold     *float64  `json:"threshold,omitempty"`
+	// Preferences are the notification settings a notifications_set
+	// event changes; other event types keep theirs.
+	Preferences map[string]bool `json:"preferences,omitempty"`
+	// Settling marks a transfer whose credit is unsettled until a
+	// matching settled event.
+	Settling bool `json:"settling,omitempty"`
+	// A converted event pays ConvertedAmount in the receiver's currency
+	// for Amount in the sender's, at Rate, with both currencies' reserves
+	// taking the other side. Residual is what rounding left with the
+	// target reserve.
+	ConvertedAmount float64 `json:"converted_amount,omitempty"`
+	Rate            string  `json:"rate,omitempty"`
+	Residual        float64 `json:"residual,omitempty"`
+	SourceReserve   ID      `json:"source_reserve,omitempty"`
+	TargetReserve   ID      `json:"target_reserve,omitempty"`
+	// Fee is taken from the sender of a transferred or converted event, on
+	// top of Amount, and credited to FeeReserve.
+	Fee        float64 `json:"fee,omitempty"`
+	FeeReserve ID      `json:"fee_reserve,omitempty"`
+	// A rolled_back event undoes one account's side of a transfer that
+	// failed the conservation check: Amount goes back on the balance and
+	// UnsettledAmount on the unsettled funds.
+	UnsettledAmount float64 `json:"unsettled_amount,omitempty"`
+}
+
+// events is guarded by mu, together with db.
+var events []Event
+
+// testHookApplyEvent is only ever set by tests, through injectFault, to
+// break the projection the way a bug would. It stays nil in production.
+var testHookApplyEvent func(users map[ID]User, e Event)
+
+// recordEvent appends e to the log and applies it to db. It must be
+// called with mu held.
+func recordEvent(e Event) {
+	e.Seq = len(events) + 1
+	e.At = time.Now().UTC()
+	events = append(events, e)
+	applyEvent(db, e)
+}
+
+func applyEvent(users map[ID]User, e Event) {
+	if e.Type == eventUserCreated {
+		users[e.User.ID] = *e.User
+		return
+	}
+	u, ok := users[e.UserID]
+	if !ok {
+		return
+	}
+	switch e.Type {
+	case eventVerified:
+		u.Verified = true
+		u.VerificationRejected = false
+	case eventVerificationRejected:
+		u.Verified = false
+		u.VerificationRejected = true
+	case eventAdjusted:
+		u.Balance += e.Amount
+	case eventThresholdSet:
+		u.LowBalanceThreshold = e.Threshold
+	case eventNotificationsSet:
+		prefs := make(map[string]bool, len(u.NotificationPreferences)+len(e.Preferences))
+		for k, v := range u.NotificationPreferences {
+			prefs[k] = v
+		}
+		for k, v := range e.Preferences {
+			prefs[k] = v
+		}
+		u.NotificationPreferences = prefs
+	case eventSettled:
+		u.Unsettled -= e.Amount
+	case eventFrozen:
+		u.Frozen = true
+	case eventUnfrozen:
+		u.Frozen = false
+	case eventHeld:
+		u.Held += e.Amount
+	case eventReleased:
+		u.Held -= e.Amount
+	case eventMerged:
+		// The whole source account moves, settled or not
+		unsettled := u.Unsettled
+		u.Balance -= e.Amount
+		u.Unsettled = 0
+		u.Closed = true
+		u.MergedInto = e.ReceiverID
+		users[u.ID] = u
+		u = users[e.ReceiverID]
+		u.Balance += e.Amount
+		u.Unsettled += unsettled
+	case eventConverted:
+		u.Balance -= e.Amount + e.Fee
+		users[u.ID] = u
+		creditFee(users, e)
+		for id, amount := range map[ID]float64{e.SourceReserve: e.Amount, e.TargetReserve: -e.ConvertedAmount} {
+			if r, ok := users[id]; ok {
+				r.Balance += amount
+				users[id] = r
+			}
+		}
+		u = users[e.ReceiverID]
+		u.Balance += e.ConvertedAmount
+		if e.Settling {
+			u.Unsettled += e.ConvertedAmount
+		}
+	case eventTransferred:
+		u.Balance -= e.Amount + e.Fee
+		users[u.ID] = u
+		creditFee(users, e)
+		// Re-read in case the receiver is the sender
+		u = users[e.ReceiverID]
+		u.Balance += e.Amount
+		if e.Settling {
+			u.Unsettled += e.Amount
+		}
+	case eventRolledBack:
+		u.Balance += e.Amount
+		u.Unsettled += e.UnsettledAmount
+	}
+	users[u.ID] = u
+	if testHookApplyEvent != nil {
+		testHookApplyEvent(users, e)
+	}
+}
+
+func creditFee(users map[ID]User, e Event) {
+	if e.Fee == 0 {
+		return
+	}
+	if r, ok := users[e.FeeReserve]; ok {
+		r.Balance += e.Fee
+		users[r.ID] = r
+	}
+}
+
+// transferEvent must be called with mu held when t has a fee.
+func transferEvent(t Transaction) Event {
+	e := Event{
+		Type:          eventTransferred,
+		UserID:        t.SenderID,
+		ReceiverID:    t.ReceiverID,
+		TransactionID: t.ID,
+		Amount:        t.Amount,
+		Settling:      settlementWindow > 0,
+	}
+	if t.Fee > 0 {
+		e.Fee, e.FeeReserve = t.Fee, systemAccounts[t.Currency]
+	}
+	return e
+}
+
+// Replay rebuilds account state from an event log.
+func Replay(log []Event) map[ID]User {
+	users := make(map[ID]User)
+	for _, e := range log {
+		applyEvent(users, e)
+	}
+	return users
+}
+
+// GetEvents pages through the event log in order.
+func GetEvents(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	mu.RLock()
+	start, end, p := paginate(len(events), limit, offset)
+	page := make([]Event, end-start)
+	copy(page, events[start:end])
+	mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Envelope{Data: page, Pagination: p})
+}
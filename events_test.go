@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestReplayRebuildsBalances(t *testing.T) {
+	resetStore(t)
+	settlementWindow = time.Hour
+	a, b, c, d := newUser(t, true), newUser(t, true), newUser(t, true), newUser(t, false)
+	transfer(t, Transaction{SenderID: a.ID, ReceiverID: b.ID, Amount: 125.5})
+	transfer(t, Transaction{SenderID: b.ID, ReceiverID: c.ID, Amount: 20, RequireAcceptance: true})
+	held := transfer(t, Transaction{SenderID: c.ID, ReceiverID: a.ID, Amount: 75, RequireAcceptance: true})
+	acceptTransfer(held.ID)
+	transfer(t, Transaction{SenderID: a.ID, ReceiverID: d.ID, Amount: 5000})
+	settleDue(time.Now().Add(2 * time.Hour))
+	transfer(t, Transaction{SenderID: c.ID, ReceiverID: d.ID, Amount: 1})
+	proposeAdjustment(Adjustment{UserID: c.ID, Amount: -3, ProposedBy: "test"})
+	wantStatus(t, serve(t, "PUT", "/user/"+string(b.ID)+"/threshold", map[string]float64{"threshold": 2000}), 200)
+	wantStatus(t, serve(t, "PUT", "/admin/users/"+string(c.ID)+"/freeze", nil), 204)
+	if _, _, err := mergeUsers(d.ID, b.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.RLock()
+	replayed := Replay(events)
+	live := make(map[ID]User, len(db))
+	for id, u := range db {
+		live[id] = u
+	}
+	mu.RUnlock()
+	if len(replayed) != len(live) {
+		t.Fatalf("replay has %d users, store has %d", len(replayed), len(live))
+	}
+	for id, u := range live {
+		want, _ := json.Marshal(u)
+		got, _ := json.Marshal(replayed[id])
+		if string(got) != string(want) {
+			t.Errorf("user %s replays as %s, store has %s", id, got, want)
+		}
+	}
+
+	var page struct {
+		Data       []Event
+		Pagination Pagination
+	}
+	decode(t, serve(t, "GET", "/admin/events?limit=1000", nil), &page)
+	if page.Pagination.Total != len(events) || page.Data[0].Seq != 1 {
+		t.Errorf("event log endpoint: total %d of %d, first seq %d", page.Pagination.Total, len(events), page.Data[0].Seq)
+	}
+}
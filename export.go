@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultExportLimit = 10000
+
+// maxExportLimit bounds one export page. Exports have their own cap, well
+// above maxPageLimit, since each row is streamed rather than buffered
+// into one JSON document.
+var maxExportLimit = 100000
+
+// exportFlushEvery is how many rows are written between flushes, so a
+// slow client sees progress and a dropped connection loses little.
+const exportFlushEvery = 1000
+
+var exportColumns = []string{"id", "sender_id", "receiver_id", "amount", "currency", "category", "status", "reason", "attempts", "created_at", "completed_at"}
+
+// Exports page through transactions in creation order. A cursor names the
+// last row a page held by its created_at and ID, and the next page starts
+// strictly after it. Transactions are only ever added at the end of that
+// order, so following cursors returns every transaction exactly once, with
+// any created meanwhile on later pages; unlike an offset, nothing is
+// skipped or repeated. Rows show each transaction as it was when its page
+// was fetched.
+func encodeExportCursor(t Transaction) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(t.CreatedAt.Format(time.RFC3339Nano) + " " + string(t.ID)))
+}
+
+func decodeExportCursor(c string) (Transaction, error) {
+	var t Transaction
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	parts := strings.SplitN(string(b), " ", 2)
+	if err != nil || len(parts) != 2 || parts[1] == "" {
+		return t, fmt.Errorf("invalid cursor")
+	}
+	if t.CreatedAt, err = time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return t, fmt.Errorf("invalid cursor")
+	}
+	t.ID = ID(parts[1])
+	return t, nil
+}
+
+// exportPage returns up to limit transactions in creation order, starting
+// after the one after names (from the start when nil), and whether any
+// remain.
+func exportPage(after *Transaction, limit int) ([]Transaction, bool) {
+	txMu.Lock()
+	defer txMu.Unlock()
+	start := 0
+	if after != nil {
+		start = firstCreatedAfter(*after)
+	}
+	end, more := start+limit, true
+	if end >= len(transactionOrder) {
+		end, more = len(transactionOrder), false
+	}
+	page := make([]Transaction, 0, end-start)
+	for _, id := range transactionOrder[start:end] {
+		page = append(page, transactions[id])
+	}
+	return page, more
+}
+
+func csvRow(t Transaction) []string {
+	completed := ""
+	if t.CompletedAt != nil {
+		completed = t.CompletedAt.Format(time.RFC3339Nano)
+	}
+	return []string{
+		string(t.ID),
+		string(t.SenderID),
+		string(t.ReceiverID),
+		strconv.FormatFloat(t.Amount, 'f', -1, 64),
+		t.Currency,
+		t.Category,
+		t.Status,
+		t.Reason,
+		strconv.Itoa(t.Attempts),
+		t.CreatedAt.Format(time.RFC3339Nano),
+		completed,
+	}
+}
+
+// ExportTransactions streams transactions in creation order as JSON lines
+// (?format=jsonl, the default) or CSV. Each page's next cursor is sent in
+// the X-Next-Cursor header, and is absent on the last page. A client that
+// loses the connection mid-page can resume from the last row it got with
+// ?after_id= instead.
+func ExportTransactions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "jsonl" && format != "csv" {
+		writeError(w, 400, CodeBadRequest, `format must be "jsonl" or "csv"`)
+		return
+	}
+	limit := defaultExportLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, 400, CodeBadRequest, "invalid limit")
+			return
+		}
+		if n > maxExportLimit {
+			writeError(w, 400, CodeBadRequest, fmt.Sprintf("limit may be at most %d; page through larger exports with cursor", maxExportLimit))
+			return
+		}
+		limit = n
+	}
+	var after *Transaction
+	if id := q.Get("after_id"); id != "" {
+		t, ok := getTransaction(ID(id))
+		if !ok {
+			writeError(w, 404, CodeTransactionNotFound, "after_id names no transaction")
+			return
+		}
+		after = &t
+	}
+	if c := q.Get("cursor"); c != "" {
+		t, err := decodeExportCursor(c)
+		if err != nil {
+			writeError(w, 400, CodeBadRequest, err.Error())
+			return
+		}
+		after = &t
+	}
+
+	page, more := exportPage(after, limit)
+	if more {
+		w.Header().Set("X-Next-Cursor", encodeExportCursor(page[len(page)-1]))
+	}
+	flusher, _ := w.(http.Flusher)
+	buf := bufio.NewWriter(w)
+	flush := func() {
+		buf.Flush()
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(buf)
+		cw.Write(exportColumns)
+		for i, t := range page {
+			cw.Write(csvRow(t))
+			if (i+1)%exportFlushEvery == 0 {
+				cw.Flush()
+				flush()
+			}
+		}
+		cw.Flush()
+		flush()
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(buf)
+	for i, t := range page {
+		enc.Encode(t)
+		if (i+1)%exportFlushEvery == 0 {
+			flush()
+		}
+	}
+	flush()
+}
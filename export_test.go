@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func exportIDs(t *testing.T, query string) ([]ID, string) {
+	t.Helper()
+	w := serve(t, "GET", "/transactions/export?"+query, nil)
+	wantStatus(t, w, 200)
+	var ids []ID
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var tx Transaction
+		if err := json.Unmarshal([]byte(line), &tx); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, tx.ID)
+	}
+	return ids, w.Header().Get("X-Next-Cursor")
+}
+
+// Paging with cursors gives the same rows as one full export, even with
+// UUIDs, whose order says nothing about when they were created.
+func TestExportCursorPaging(t *testing.T) {
+	resetStore(t)
+	transactionIDs, _ = newIDGenerator("uuid")
+	a, b := newUser(t, true), newUser(t, true)
+	for i := 1; i <= 7; i++ {
+		transfer(t, Transaction{SenderID: a.ID, ReceiverID: b.ID, Amount: float64(i)})
+	}
+
+	full, next := exportIDs(t, "")
+	if len(full) != 7 || next != "" {
+		t.Fatalf("full export has %d rows and cursor %q", len(full), next)
+	}
+	first, next := exportIDs(t, "limit=4")
+	if len(first) != 4 || next == "" {
+		t.Fatalf("first page has %d rows and cursor %q", len(first), next)
+	}
+	second, last := exportIDs(t, "limit=4&cursor="+next)
+	if last != "" {
+		t.Errorf("last page has cursor %q", last)
+	}
+	paged := append(first, second...)
+	if len(paged) != len(full) {
+		t.Fatalf("pages hold %d rows, full export %d", len(paged), len(full))
+	}
+	for i := range full {
+		if paged[i] != full[i] {
+			t.Fatalf("row %d is %s paged but %s in the full export", i, paged[i], full[i])
+		}
+	}
+
+	resumed, _ := exportIDs(t, "after_id="+string(first[3]))
+	if len(resumed) != 3 || resumed[0] != second[0] {
+		t.Errorf("resuming after %s gave %v", first[3], resumed)
+	}
+}
+
+// Transfers made while paging show up on a later page.
+func TestExportCursorSeesNewRows(t *testing.T) {
+	resetStore(t)
+	transactionIDs, _ = newIDGenerator("uuid")
+	a, b := newUser(t, true), newUser(t, true)
+	for i := 1; i <= 3; i++ {
+		transfer(t, Transaction{SenderID: a.ID, ReceiverID: b.ID, Amount: float64(i)})
+	}
+	first, next := exportIDs(t, "limit=2")
+	added := transfer(t, Transaction{SenderID: a.ID, ReceiverID: b.ID, Amount: 10})
+	second, _ := exportIDs(t, "limit=10&cursor="+next)
+	if len(first)+len(second) != 4 || second[len(second)-1] != added.ID {
+		t.Errorf("pages %v then %v, want the new transfer %s last", first, second, added.ID)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	resetStore(t)
+	a, b := newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: a.ID, ReceiverID: b.ID, Amount: 1.5})
+	w := serve(t, "GET", "/transactions/export?format=csv", nil)
+	wantStatus(t, w, 200)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "id,sender_id") || !strings.Contains(lines[1], ",1.5,USD,") {
+		t.Errorf("csv export %q", w.Body.String())
+	}
+	wantStatus(t, serve(t, "GET", "/transactions/export?cursor=bad", nil), 400)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxFailureRecords bounds the audit log; the oldest entries are dropped.
+const maxFailureRecords = 10000
+
+// FailureRecord is one failed processing attempt, kept even when the
+// transaction is retried and later succeeds.
+type FailureRecord struct {
+	TransactionID ID        `json:"transaction_id"`
+	Attempt       int       `json:"attempt"`
+	Reason        string    `json:"reason"`
+	Worker        string    `json:"worker"`
+	At            time.Time `json:"at"`
+}
+
+var failuresMu sync.Mutex
+var failures []FailureRecord
+
+func recordFailure(f FailureRecord) {
+	failuresMu.Lock()
+	defer failuresMu.Unlock()
+	failures = append(failures, f)
+	if len(failures) > maxFailureRecords {
+		failures = failures[len(failures)-maxFailureRecords:]
+	}
+}
+
+// handleTransaction is what workers run for each dequeued transaction. A
+// transfer from a sender awaiting verification, or over its sender's
+// in-flight cap, is parked instead. Otherwise the worker runs it and then
+// any of the sender's transfers parked behind it.
+func handleTransaction(worker string, t Transaction) error {
+	if awaitVerification(t) || !senderSlots.admit(t) {
+		return nil
+	}
+	for {
+		err := attemptTransaction(worker, t)
+		next, ok := senderSlots.done(t.SenderID)
+		if !ok {
+			return err
+		}
+		t = next
+	}
+}
+
+// attemptTransaction counts the attempt and audits any failure. safeProcess
+// turns panics into errors, so the caller always gets to free the slot.
+func attemptTransaction(worker string, t Transaction) error {
+	atomic.AddInt32(&busyWorkers, 1)
+	defer atomic.AddInt32(&busyWorkers, -1)
+
+	t.Attempts = startAttempt(t.ID)
+	err := safeProcess(t)
+	transactionThroughput.mark(time.Now())
+	if stored, ok := getTransaction(t.ID); ok {
+		rememberProcessed(stored)
+	}
+	if err != nil {
+		recordFailure(FailureRecord{
+			TransactionID: t.ID,
+			Attempt:       t.Attempts,
+			Reason:        err.Error(),
+			Worker:        worker,
+			At:            time.Now().UTC(),
+		})
+	}
+	return err
+}
+
+// GetFailures lists failed attempts oldest first, optionally for a single
+// ?transaction_id=.
+func GetFailures(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	txID := ID(r.URL.Query().Get("transaction_id"))
+
+	failuresMu.Lock()
+	list := make([]FailureRecord, 0, len(failures))
+	for _, f := range failures {
+		if txID == "" || f.TransactionID == txID {
+			list = append(list, f)
+		}
+	}
+	failuresMu.Unlock()
+	start, end, p := paginate(len(list), limit, offset)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Envelope{Data: list[start:end], Pagination: p})
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestFailureAuditRecordsEachAttempt(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	registerTransactionHook(&panicHook{times: 2})
+	tx := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	other := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 5000})
+
+	var page struct {
+		Data       []FailureRecord
+		Pagination Pagination
+	}
+	decode(t, serve(t, "GET", "/admin/failures?transaction_id="+string(tx.ID), nil), &page)
+	if len(page.Data) != 2 || page.Pagination.Total != 2 {
+		t.Fatalf("failures for %s: %+v", tx.ID, page.Data)
+	}
+	for i, f := range page.Data {
+		if f.Attempt != i+1 || f.Reason != string(CodeProcessingPanic) || f.Worker != "test" || f.At.IsZero() {
+			t.Errorf("failure %d: %+v", i, f)
+		}
+	}
+	if got, _ := getTransaction(tx.ID); got.Attempts != 2 || got.Status != statusFailed {
+		t.Errorf("transaction after two panics: status %s, %d attempts", got.Status, got.Attempts)
+	}
+
+	decode(t, serve(t, "GET", "/admin/failures", nil), &page)
+	if len(page.Data) != 3 || page.Data[2].TransactionID != other.ID || page.Data[2].Reason != string(CodeInsufficientFunds) {
+		t.Errorf("all failures: %+v", page.Data)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// fraudCheck registers the built-in fraudHook. A transfer is flagged when
+// it is more than fraudAverageMultiple times the sender's average completed
+// transfer (once they have fraudMinHistory of them), or when the sender's
+// account is younger than fraudMinAccountAge and the transfer is over
+// fraudNewAccountLimit.
+var fraudCheck bool
+var fraudAverageMultiple = 5.0
+var fraudMinHistory = 3
+var fraudMinAccountAge = 24 * time.Hour
+var fraudNewAccountLimit = 500.0
+
+type senderActivity struct {
+	count int
+	total float64
+}
+
+// fraudHook learns each sender's typical transfer from AfterProcess, so
+// its averages only cover transfers completed since startup.
+type fraudHook struct {
+	mu       sync.Mutex
+	activity map[ID]senderActivity
+}
+
+func newFraudHook() *fraudHook {
+	return &fraudHook{activity: make(map[ID]senderActivity)}
+}
+
+func (h *fraudHook) BeforeProcess(ctx context.Context, t *Transaction) error {
+	if t.ReviewedBy != "" {
+		return nil
+	}
+	sender, ok := getUser(t.SenderID)
+	if !ok {
+		return nil
+	}
+	if sender.CreatedAt != nil && time.Since(*sender.CreatedAt) < fraudMinAccountAge && t.Amount > fraudNewAccountLimit {
+		return &ReviewRequired{Note: fmt.Sprintf("amount %g from an account created %s ago", t.Amount, time.Since(*sender.CreatedAt).Round(time.Second))}
+	}
+	h.mu.Lock()
+	a := h.activity[t.SenderID]
+	h.mu.Unlock()
+	if a.count >= fraudMinHistory {
+		avg := a.total / float64(a.count)
+		if t.Amount > fraudAverageMultiple*avg {
+			return &ReviewRequired{Note: fmt.Sprintf("amount %g is over %gx the sender's average of %g", t.Amount, fraudAverageMultiple, avg)}
+		}
+	}
+	return nil
+}
+
+func (h *fraudHook) AfterProcess(ctx context.Context, t Transaction, result error) {
+	if t.Status != statusCompleted || t.isSplit() {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a := h.activity[t.SenderID]
+	a.count++
+	a.total += t.Amount
+	h.activity[t.SenderID] = a
+}
+
+// holdForReview parks t with statusInReview; nothing is held, and the
+// transfer is checked from scratch if an admin approves it. A conversion
+// keeps the quote the sender was given, so approval pays out what the
+// transfer showed while it waited. The reviewer's context is gathered in
+// the background.
+func holdForReview(t Transaction, review *ReviewRequired) {
+	txMu.Lock()
+	stored, ok := transactions[t.ID]
+	if !ok {
+		txMu.Unlock()
+		return
+	}
+	stored.Status = statusInReview
+	stored.Reason = string(CodeFlaggedForReview)
+	stored.ReviewNote = review.Note
+	transactions[t.ID] = stored
+	txMu.Unlock()
+	go enrichReview(t)
+}
+
+// ReviewContext is what a reviewer sees beside a held transfer: how old
+// the sender's account is, their completed transfers so far and how many
+// of those went to the same receiver.
+type ReviewContext struct {
+	SenderAgeSeconds float64 `json:"sender_age_seconds,omitempty"`
+	SenderCompleted  int     `json:"sender_completed"`
+	SenderAverage    float64 `json:"sender_average"`
+	ReceiverPayments int     `json:"receiver_payments"`
+}
+
+// enrichReview scans t's sender's history off the worker, so a long one
+// never holds up the queue. The result is dropped if t was approved or
+// rejected in the meantime.
+func enrichReview(t Transaction) {
+	rc := &ReviewContext{}
+	if sender, ok := getUser(t.SenderID); ok && sender.CreatedAt != nil {
+		rc.SenderAgeSeconds = time.Since(*sender.CreatedAt).Seconds()
+	}
+	txMu.Lock()
+	defer txMu.Unlock()
+	total := 0.0
+	for _, other := range transactions {
+		if other.SenderID != t.SenderID || other.Status != statusCompleted || other.isSplit() {
+			continue
+		}
+		rc.SenderCompleted++
+		total += other.Amount
+		if other.ReceiverID == t.ReceiverID {
+			rc.ReceiverPayments++
+		}
+	}
+	if rc.SenderCompleted > 0 {
+		rc.SenderAverage = total / float64(rc.SenderCompleted)
+	}
+	stored, ok := transactions[t.ID]
+	if !ok || stored.Status != statusInReview {
+		return
+	}
+	stored.ReviewContext = rc
+	transactions[t.ID] = stored
+}
+
+// approveReview requeues t on behalf of reviewer; the ReviewedBy mark
+// keeps hooks from flagging it again. During shutdown t stays in review.
+func approveReview(id ID, reviewer string) (before, after Transaction, err *APIError) {
+	if isShuttingDown() {
+		return before, after, newError(CodeShuttingDown, "Server is shutting down. Try again later")
+	}
+	txMu.Lock()
+	before, ok := transactions[id]
+	if !ok {
+		txMu.Unlock()
+		return before, after, newError(CodeTransactionNotFound, "Transaction not found")
+	}
+	if before.Status != statusInReview {
+		txMu.Unlock()
+		return before, after, newError(CodeNotInReview, "Transaction is not in review")
+	}
+	after = before
+	after.Status = statusQueued
+	after.Reason = ""
+	after.ReviewedBy = reviewer
+	transactions[id] = after
+	txMu.Unlock()
+
+	enqueueTransaction(after)
+	return before, after, nil
+}
+
+func rejectReview(id ID, reviewer string) (before, after Transaction, err *APIError) {
+	txMu.Lock()
+	before, ok := transactions[id]
+	if !ok {
+		txMu.Unlock()
+		return before, after, newError(CodeTransactionNotFound, "Transaction not found")
+	}
+	if before.Status != statusInReview {
+		txMu.Unlock()
+		return before, after, newError(CodeNotInReview, "Transaction is not in review")
+	}
+	stored := before
+	stored.ReviewedBy = reviewer
+	transactions[id] = stored
+	txMu.Unlock()
+
+	result := failTransaction(stored, newError(CodeRejectedInReview, "Rejected in review"))
+	runAfterHooks(context.Background(), id, result)
+	after, _ = getTransaction(id)
+	return before, after, nil
+}
+
+func ApproveReview(w http.ResponseWriter, r *http.Request) {
+	resolveReview(w, r, "transaction.review.approve", approveReview)
+}
+
+func RejectReview(w http.ResponseWriter, r *http.Request) {
+	resolveReview(w, r, "transaction.review.reject", rejectReview)
+}
+
+func resolveReview(w http.ResponseWriter, r *http.Request, action string, resolve func(ID, string) (Transaction, Transaction, *APIError)) {
+	opts, err := parseResponseOptions(r, transactionFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	id := ID(mux.Vars(r)["id"])
+	before, after, apiErr := resolve(id, adminActor(r))
+	if apiErr != nil {
+		status := 409
+		switch apiErr.Code {
+		case CodeTransactionNotFound:
+			status = 404
+		case CodeShuttingDown:
+			status = 503
+		}
+		writeAPIError(w, status, apiErr)
+		return
+	}
+	recordAudit(r, action, string(id), before, after)
+	writeResponse(w, opts, after)
+}
+
+// GetReviews pages through transactions waiting for review, oldest first.
+func GetReviews(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	txMu.Lock()
+	list := make([]Transaction, 0)
+	for _, t := range transactions {
+		if t.Status == statusInReview {
+			list = append(list, t)
+		}
+	}
+	txMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return createdBefore(list[i], list[j]) })
+	start, end, p := paginate(len(list), limit, offset)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Envelope{Data: list[start:end], Pagination: p})
+}
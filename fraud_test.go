@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFraudHookHoldsLargeTransferFromNewAccount(t *testing.T) {
+	resetStore(t)
+	registerTransactionHook(newFraudHook())
+	sender, receiver := newUser(t, true), newUser(t, true)
+
+	normal := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 50})
+	if normal.Status != statusCompleted {
+		t.Fatalf("normal transfer: status %s reason %q", normal.Status, normal.Reason)
+	}
+	large := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: fraudNewAccountLimit + 1})
+	if large.Status != statusInReview || large.Reason != string(CodeFlaggedForReview) || large.ReviewNote == "" {
+		t.Fatalf("large transfer: %+v", large)
+	}
+	if balance(t, sender.ID) != 950 {
+		t.Errorf("held transfer moved money: sender has %v", balance(t, sender.ID))
+	}
+
+	var page struct{ Data []Transaction }
+	decode(t, serve(t, "GET", "/admin/reviews", nil), &page)
+	if len(page.Data) != 1 || page.Data[0].ID != large.ID {
+		t.Errorf("review list %+v", page.Data)
+	}
+
+	wantStatus(t, serve(t, "POST", "/admin/transaction/"+string(large.ID)+"/approve", nil), 200)
+	drainQueue(t)
+	if got, _ := getTransaction(large.ID); got.Status != statusCompleted || got.ReviewedBy == "" {
+		t.Errorf("approved transfer: status %s reviewed by %q", got.Status, got.ReviewedBy)
+	}
+}
+
+func TestFraudHookRejectInReview(t *testing.T) {
+	resetStore(t)
+	registerTransactionHook(newFraudHook())
+	sender, receiver := newUser(t, true), newUser(t, true)
+	large := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 900})
+
+	wantStatus(t, serve(t, "POST", "/admin/transaction/"+string(large.ID)+"/reject", nil), 200)
+	if got, _ := getTransaction(large.ID); got.Status != statusFailed || got.Reason != string(CodeRejectedInReview) {
+		t.Errorf("rejected transfer: status %s reason %q", got.Status, got.Reason)
+	}
+	wantStatus(t, serve(t, "POST", "/admin/transaction/"+string(large.ID)+"/approve", nil), 409)
+}
+
+// A conversion quoted before review is paid at that quote on approval.
+func TestReviewKeepsConversionQuote(t *testing.T) {
+	resetStore(t)
+	rates := fixedRates{"USD/EUR": big.NewRat(1, 2)}
+	rateProvider = rates
+	registerTransactionHook(newFraudHook())
+	sender := newUser(t, true)
+	receiver, _ := addUser(User{Currency: "EUR"})
+	verifyUser(receiver)
+
+	large := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 600})
+	if large.Status != statusInReview || large.ConvertedCurrency != "EUR" || large.ConvertedAmount != 300 {
+		t.Fatalf("held transfer lost its quote: %+v", large)
+	}
+	rates["USD/EUR"] = big.NewRat(3, 4)
+	approveReview(large.ID, "reviewer")
+	drainQueue(t)
+
+	got, _ := getTransaction(large.ID)
+	if got.Status != statusCompleted || got.ConvertedAmount != 300 || got.FXRate != "0.5" {
+		t.Errorf("approved transfer: status %s converted %v at %s, want 300 at the quoted 0.5", got.Status, got.ConvertedAmount, got.FXRate)
+	}
+	if balance(t, receiver.ID) != 1300 {
+		t.Errorf("receiver balance %v, want 1300", balance(t, receiver.ID))
+	}
+}
+
+func TestReviewsListOldestFirst(t *testing.T) {
+	resetStore(t)
+	transactionIDs, _ = newIDGenerator("uuid")
+	registerTransactionHook(newFraudHook())
+	sender, receiver := newUser(t, true), newUser(t, true)
+	var held []ID
+	for i := 0; i < 5; i++ {
+		held = append(held, transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 600 + float64(i)}).ID)
+	}
+	var page struct{ Data []Transaction }
+	decode(t, serve(t, "GET", "/admin/reviews", nil), &page)
+	if len(page.Data) != len(held) {
+		t.Fatalf("%d in review, want %d", len(page.Data), len(held))
+	}
+	for i, tx := range page.Data {
+		if tx.ID != held[i] {
+			t.Fatalf("review %d is %s, want %s", i, tx.ID, held[i])
+		}
+	}
+}
+
+func TestHeldTransferIsEnriched(t *testing.T) {
+	resetStore(t)
+	registerTransactionHook(newFraudHook())
+	sender, receiver, other := newUser(t, true), newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 40})
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 60})
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: other.ID, Amount: 20})
+
+	large := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: fraudNewAccountLimit + 1})
+	if large.Status != statusInReview {
+		t.Fatalf("large transfer: status %s", large.Status)
+	}
+	waitFor(t, "the review context", func() bool {
+		got, _ := getTransaction(large.ID)
+		return got.ReviewContext != nil
+	})
+	var page struct{ Data []Transaction }
+	decode(t, serve(t, "GET", "/admin/reviews", nil), &page)
+	if len(page.Data) != 1 || page.Data[0].ReviewContext == nil {
+		t.Fatalf("review list %+v", page.Data)
+	}
+	rc := *page.Data[0].ReviewContext
+	if rc.SenderCompleted != 3 || rc.SenderAverage != 40 || rc.ReceiverPayments != 2 || rc.SenderAgeSeconds <= 0 {
+		t.Errorf("review context %+v, want 3 completed averaging 40, 2 to this receiver", rc)
+	}
+}
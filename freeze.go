@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// setFrozen records the freeze or unfreeze under mu, so it lands either
+// before or after any transfer involving the user, never in the middle.
+func setFrozen(id ID, frozen bool) (before, after User, err *APIError) {
+	mu.Lock()
+	defer mu.Unlock()
+	before, ok := db[id]
+	if !ok {
+		return before, after, newError(CodeUserNotFound, "User not found")
+	}
+	if before.System {
+		return before, after, newError(CodeSystemAccount, "Reserve accounts can't be frozen")
+	}
+	if before.Frozen != frozen {
+		typ := eventUnfrozen
+		if frozen {
+			typ = eventFrozen
+		}
+		recordEvent(Event{Type: typ, UserID: id})
+	}
+	return before, db[id], nil
+}
+
+func FreezeUser(w http.ResponseWriter, r *http.Request) {
+	updateFrozen(w, r, true)
+}
+
+func UnfreezeUser(w http.ResponseWriter, r *http.Request) {
+	updateFrozen(w, r, false)
+}
+
+func updateFrozen(w http.ResponseWriter, r *http.Request, frozen bool) {
+	id := ID(mux.Vars(r)["id"])
+	before, after, err := setFrozen(id, frozen)
+	if err != nil {
+		status := 400
+		if err.Code == CodeUserNotFound {
+			status = 404
+		}
+		writeAPIError(w, status, err)
+		return
+	}
+	action := "user.unfreeze"
+	if frozen {
+		action = "user.freeze"
+	}
+	recordAudit(r, action, string(id), map[string]bool{"frozen": before.Frozen}, map[string]bool{"frozen": after.Frozen})
+	w.WriteHeader(204)
+}
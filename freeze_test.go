@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// A receiver frozen after the transfer was picked up, but before it is
+// applied, fails the whole transfer.
+func TestReceiverFrozenMidFlight(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	gate := &gateHook{sender: sender.ID, open: make(chan struct{})}
+	registerTransactionHook(gate)
+	startWorkers(t, 1)
+
+	tx := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 100, Currency: defaultCurrency})
+	enqueueTransaction(tx)
+	waitFor(t, "the transfer to be picked up", func() bool { return gate.held() == 1 })
+	wantStatus(t, serve(t, "PUT", "/admin/users/"+string(receiver.ID)+"/freeze", nil), 204)
+	close(gate.open)
+	waitFor(t, "the transfer to fail", hasStatus(tx.ID, statusFailed))
+
+	got, _ := getTransaction(tx.ID)
+	if got.Reason != string(CodeAccountFrozen) {
+		t.Errorf("reason %q, want %s", got.Reason, CodeAccountFrozen)
+	}
+	if balance(t, sender.ID) != 1000 || balance(t, receiver.ID) != 1000 {
+		t.Errorf("balances %v and %v after the failed transfer, want 1000 each", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+}
+
+// Freezes racing transfers land wholly before or after each one: every
+// transfer either moved its full amount or nothing.
+func TestFreezeRacingTransfers(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	maxInFlightPerAccount = 0
+	senderSlots = newAccountLimiter(0)
+	startWorkers(t, 4)
+
+	var ids []ID
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			setFrozen(receiver.ID, i%2 == 0)
+		}
+	}()
+	for i := 0; i < 40; i++ {
+		tx := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10, Currency: defaultCurrency})
+		ids = append(ids, tx.ID)
+		enqueueTransaction(tx)
+	}
+	wg.Wait()
+
+	completed := 0
+	for _, id := range ids {
+		waitFor(t, "transaction "+string(id), func() bool {
+			got, _ := getTransaction(id)
+			return isTerminal(got.Status)
+		})
+		got, _ := getTransaction(id)
+		switch {
+		case got.Status == statusCompleted:
+			completed++
+		case got.Reason != string(CodeAccountFrozen):
+			t.Errorf("transaction %s failed with %q", id, got.Reason)
+		}
+	}
+	moved := float64(10 * completed)
+	if balance(t, sender.ID) != 1000-moved || balance(t, receiver.ID) != 1000+moved {
+		t.Errorf("balances %v and %v after %d completed transfers", balance(t, sender.ID), balance(t, receiver.ID), completed)
+	}
+	if problems := checkLedger(snapshotState()); len(problems) > 0 {
+		t.Errorf("self-test problems: %v", problems)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// RateProvider quotes how many units of to one unit of from buys. Rates
+// are exact rationals so conversions don't pick up float error before
+// they are rounded.
+type RateProvider interface {
+	Rate(from, to string) (*big.Rat, error)
+}
+
+// rateProvider enables cross-currency transfers; nil rejects them with
+// currency_mismatch as before.
+var rateProvider RateProvider
+
+// fxRates configures a fixedRates provider, e.g. "USD/EUR=0.92,USD/JPY=150".
+var fxRates string
+
+// fixedRates serves rates from configuration. A pair configured one way
+// is also quoted the other way at the exact inverse.
+type fixedRates map[string]*big.Rat
+
+func parseFixedRates(spec string) (fixedRates, error) {
+	rates := make(fixedRates)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		pair := strings.SplitN(kv[0], "/", 2)
+		if len(kv) != 2 || len(pair) != 2 {
+			return nil, fmt.Errorf("bad fx rate %q, want FROM/TO=rate", part)
+		}
+		from, to := strings.ToUpper(pair[0]), strings.ToUpper(pair[1])
+		if !knownCurrency(from) || !knownCurrency(to) || from == to {
+			return nil, fmt.Errorf("bad fx pair %s/%s", from, to)
+		}
+		rate, ok := new(big.Rat).SetString(kv[1])
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("bad fx rate %q for %s/%s", kv[1], from, to)
+		}
+		rates[from+"/"+to] = rate
+		if _, set := rates[to+"/"+from]; !set {
+			rates[to+"/"+from] = new(big.Rat).Inv(rate)
+		}
+	}
+	return rates, nil
+}
+
+func (r fixedRates) Rate(from, to string) (*big.Rat, error) {
+	rate, ok := r[from+"/"+to]
+	if !ok {
+		return nil, fmt.Errorf("no rate for %s/%s", from, to)
+	}
+	return rate, nil
+}
+
+// convert turns amount of from into to at rate, rounding down to to's
+// minor unit. It returns the credited amount and the residual: the part
+// of a minor unit rounded off, which stays with the reserve.
+func convert(amount float64, from, to string, rate *big.Rat) (converted, residual float64) {
+	fromScale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(currencyDecimals[from])), nil)
+	toScale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(currencyDecimals[to])), nil)
+	// amount has passed checkPrecision, so it is a whole number of minor units
+	minor := big.NewInt(int64(math.Round(amount * math.Pow10(currencyDecimals[from]))))
+	exact := new(big.Rat).SetFrac(minor, fromScale)
+	exact.Mul(exact, rate)
+
+	scaled := new(big.Rat).Mul(exact, new(big.Rat).SetInt(toScale))
+	credited := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+	rounded := new(big.Rat).SetFrac(credited, toScale)
+
+	converted, _ = rounded.Float64()
+	residual, _ = new(big.Rat).Sub(exact, rounded).Float64()
+	return converted, residual
+}
+
+// quoteConversion fills in the conversion for a transfer to an account in
+// another currency. The rate is fetched without holding mu, since a
+// provider may be slow, and the quote is stored so a transfer held for
+// acceptance settles at the rate it was quoted.
+func quoteConversion(t Transaction) (Transaction, *APIError) {
+	if rateProvider == nil || t.ConvertedCurrency != "" {
+		return t, nil
+	}
+	rec, ok := getUser(t.ReceiverID)
+	if !ok || rec.Currency == t.Currency || !knownCurrency(rec.Currency) {
+		return t, nil
+	}
+	rate, err := rateProvider.Rate(t.Currency, rec.Currency)
+	if err != nil {
+		return t, newError(CodeRateUnavailable, err.Error())
+	}
+	t.ConvertedAmount, t.FXResidual = convert(t.Amount, t.Currency, rec.Currency, rate)
+	t.ConvertedCurrency = rec.Currency
+	t.FXRate = ratText(rate)
+	if t.ConvertedAmount <= 0 {
+		return t, newError(CodeInvalidAmount, "Amount converts to less than one minor unit")
+	}
+	setConversion(t)
+	return t, nil
+}
+
+func setConversion(t Transaction) {
+	txMu.Lock()
+	defer txMu.Unlock()
+	if stored, ok := transactions[t.ID]; ok {
+		stored.ConvertedAmount = t.ConvertedAmount
+		stored.ConvertedCurrency = t.ConvertedCurrency
+		stored.FXRate = t.FXRate
+		stored.FXResidual = t.FXResidual
+		transactions[t.ID] = stored
+	}
+}
+
+// ratText writes r as a plain decimal when that is exact, and as a
+// fraction otherwise.
+func ratText(r *big.Rat) string {
+	s := r.FloatString(12)
+	if back, ok := new(big.Rat).SetString(s); ok && back.Cmp(r) == 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+		return s
+	}
+	return r.RatString()
+}
+
+// credited is what the receiver gets, in the receiver's currency.
+func (t Transaction) credited() float64 {
+	if t.ConvertedCurrency != "" {
+		return t.ConvertedAmount
+	}
+	return t.Amount
+}
+
+// conversionEvent moves the source amount from the sender to the source
+// currency's reserve and the converted amount from the target currency's
+// reserve to the receiver, so each currency's total is unchanged. It
+// must be called with mu held.
+func conversionEvent(t Transaction) Event {
+	e := transferEvent(t)
+	e.Type = eventConverted
+	e.ConvertedAmount = t.ConvertedAmount
+	e.Rate = t.FXRate
+	e.Residual = t.FXResidual
+	e.SourceReserve = systemAccounts[t.Currency]
+	e.TargetReserve = systemAccounts[t.ConvertedCurrency]
+	return e
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+// stubRate quotes one fixed rate for every pair, or fails if err is set.
+type stubRate struct {
+	rate string
+	err  error
+}
+
+func (s stubRate) Rate(from, to string) (*big.Rat, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	r, _ := new(big.Rat).SetString(s.rate)
+	return r, nil
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestConvertRoundsDownToTheMinorUnit(t *testing.T) {
+	for _, c := range []struct {
+		amount             float64
+		from, to, rate     string
+		converted, residue float64
+	}{
+		{10.01, "USD", "EUR", "0.923", 9.23, 0.00923},
+		{100, "USD", "EUR", "0.92", 92, 0},
+		{10.01, "USD", "JPY", "150.5", 1506, 0.505},
+		{1, "EUR", "KWD", "1/3", 0.333, 1.0 / 3000},
+	} {
+		rate, _ := new(big.Rat).SetString(c.rate)
+		converted, residue := convert(c.amount, c.from, c.to, rate)
+		if !near(converted, c.converted) || !near(residue, c.residue) {
+			t.Errorf("%v %s->%s at %s: %v + %v, want %v + %v", c.amount, c.from, c.to, c.rate, converted, residue, c.converted, c.residue)
+		}
+	}
+}
+
+func TestCrossCurrencyTransfer(t *testing.T) {
+	resetStore(t)
+	rateProvider = stubRate{rate: "0.923"}
+	sender := newUser(t, true)
+	receiver, _ := addUser(User{Currency: "EUR"})
+	reserveBalance := func(currency string) float64 {
+		return balance(t, systemAccounts[currency])
+	}
+	usdReserve, eurReserve := reserveBalance("USD"), reserveBalance("EUR")
+
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10.01})
+	if got.Status != statusCompleted {
+		t.Fatalf("status %s reason %q", got.Status, got.Reason)
+	}
+	if got.ConvertedCurrency != "EUR" || got.ConvertedAmount != 9.23 || got.FXRate != "0.923" || !near(got.FXResidual, 0.00923) {
+		t.Errorf("conversion recorded as %v %s at %s with residual %v", got.ConvertedAmount, got.ConvertedCurrency, got.FXRate, got.FXResidual)
+	}
+	if !near(balance(t, sender.ID), 989.99) || !near(balance(t, receiver.ID), 1009.23) {
+		t.Errorf("balances %v USD and %v EUR, want 989.99 and 1009.23", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+	// the full source amount goes to the USD reserve and only the rounded
+	// credit leaves the EUR one, so the residual stays with the reserves
+	if !near(reserveBalance("USD")-usdReserve, 10.01) || !near(eurReserve-reserveBalance("EUR"), 9.23) {
+		t.Errorf("reserves moved %v USD and %v EUR, want +10.01 and -9.23", reserveBalance("USD")-usdReserve, reserveBalance("EUR")-eurReserve)
+	}
+
+	mu.RLock()
+	last := events[len(events)-1]
+	mu.RUnlock()
+	if last.Type != eventConverted || last.ConvertedAmount != 9.23 || last.Rate != "0.923" || !near(last.Residual, 0.00923) {
+		t.Errorf("ledger entry %+v", last)
+	}
+	if problems := checkLedger(snapshotState()); len(problems) > 0 {
+		t.Errorf("self-test problems: %v", problems)
+	}
+}
+
+func TestCrossCurrencyWithoutRate(t *testing.T) {
+	resetStore(t)
+	sender := newUser(t, true)
+	receiver, _ := addUser(User{Currency: "EUR"})
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	if got.Status != statusFailed || got.Reason != string(CodeCurrencyMismatch) {
+		t.Errorf("without a provider: status %s reason %q", got.Status, got.Reason)
+	}
+
+	rateProvider = stubRate{err: errors.New("provider is down")}
+	got = transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	if got.Status != statusFailed || got.Reason != string(CodeRateUnavailable) {
+		t.Errorf("with the provider down: status %s reason %q", got.Status, got.Reason)
+	}
+
+	rateProvider = stubRate{rate: "0.001"}
+	got = transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 0.01})
+	if got.Status != statusFailed || got.Reason != string(CodeInvalidAmount) {
+		t.Errorf("below one minor unit: status %s reason %q", got.Status, got.Reason)
+	}
+	if balance(t, sender.ID) != 1000 || balance(t, receiver.ID) != 1000 {
+		t.Errorf("failed conversions moved money: %v, %v", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+}
+
+func TestParseFixedRates(t *testing.T) {
+	rates, err := parseFixedRates("USD/EUR=0.8, usd/jpy=150")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := rates.Rate("EUR", "USD"); err != nil || r.Cmp(big.NewRat(5, 4)) != 0 {
+		t.Errorf("inverse rate %v %v, want 5/4", r, err)
+	}
+	if _, err := rates.Rate("EUR", "JPY"); err == nil {
+		t.Error("unconfigured pair was quoted")
+	}
+	for _, spec := range []string{"USD/USD=1", "USD/XYZ=1", "USD/EUR=-1", "USD-EUR=1"} {
+		if _, err := parseFixedRates(spec); err == nil {
+			t.Errorf("bad spec %q was accepted", spec)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxQueueAge is how long the head of a queue may wait before /healthz
+// reports the service unhealthy.
+var maxQueueAge = time.Minute
+
+// queueClock mirrors a channel's FIFO order with enqueue times so the age
+// of the head item can be read without draining the channel. It also
+// counts pushes and pops, so an item's position is its push number minus
+// the pops since, without scanning anything.
+type queueClock struct {
+	mu     sync.Mutex
+	times  []time.Time
+	pushed int64
+	popped int64
+}
+
+// push returns the item's sequence number for position.
+func (c *queueClock) push(t time.Time) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.times = append(c.times, t)
+	c.pushed++
+	return c.pushed
+}
+
+// position is 1 for the head of the queue and 0 once seq has been popped.
+func (c *queueClock) position(seq int64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if seq <= c.popped {
+		return 0
+	}
+	return int(seq - c.popped)
+}
+
+func (c *queueClock) pop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.popped++
+	if len(c.times) > 0 {
+		c.times = c.times[1:]
+	}
+}
+
+func (c *queueClock) oldestAge(now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.times) == 0 {
+		return 0
+	}
+	return now.Sub(c.times[0])
+}
+
+var transactionClock = &queueClock{}
+var verificationClock = &queueClock{}
+
+// enqueueTransaction returns t's sequence number in transactionClock.
+func enqueueTransaction(t Transaction) int64 {
+	seq := transactionClock.push(time.Now())
+	transactionQueue <- t
+	return seq
+}
+
+// requeueTransaction is for workers putting a transaction back on the
+// queue they drain. A blocking send there deadlocks once the queue is full
+// and every worker is stuck sending, so when there's no room the send is
+// handed to its own goroutine and the worker moves on.
+func requeueTransaction(t Transaction) {
+	transactionClock.push(time.Now())
+	select {
+	case transactionQueue <- t:
+	default:
+		go func() { transactionQueue <- t }()
+	}
+}
+
+type QueueHealth struct {
+	Depth            int     `json:"depth"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+	Healthy          bool    `json:"healthy"`
+}
+
+type Health struct {
+	Status string `json:"status"`
+	// ReadOnly is set when the saved state failed the startup self-test.
+	ReadOnly bool                   `json:"read_only,omitempty"`
+	Queues   map[string]QueueHealth `json:"queues"`
+}
+
+func checkHealth(now time.Time) Health {
+	h := Health{Status: "ok", ReadOnly: readOnly, Queues: make(map[string]QueueHealth)}
+	check := func(name string, depth int, c *queueClock) {
+		age := c.oldestAge(now)
+		q := QueueHealth{Depth: depth, OldestAgeSeconds: age.Seconds(), Healthy: age <= maxQueueAge}
+		if !q.Healthy {
+			h.Status = "unhealthy"
+		}
+		h.Queues[name] = q
+	}
+	check("transactions", len(transactionQueue), transactionClock)
+	check("verifications", len(verificationQueue), verificationClock)
+	return h
+}
+
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	h := checkHealth(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	if h.Status != "ok" {
+		w.WriteHeader(503)
+	}
+	json.NewEncoder(w).Encode(h)
+}
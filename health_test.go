@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStalledQueueIsUnhealthy(t *testing.T) {
+	resetStore(t)
+	maxQueueAge = 10 * time.Millisecond
+	sender, receiver := newUser(t, true), newUser(t, true)
+	wantStatus(t, serve(t, "GET", "/healthz", nil), 200)
+
+	// with no workers running, the transfer sits at the head of the queue
+	enqueueTransaction(addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 1, Currency: defaultCurrency}))
+	time.Sleep(2 * maxQueueAge)
+	w := serve(t, "GET", "/healthz", nil)
+	wantStatus(t, w, 503)
+	var h Health
+	decode(t, w, &h)
+	q := h.Queues["transactions"]
+	if h.Status != "unhealthy" || q.Healthy || q.Depth != 1 || q.OldestAgeSeconds < maxQueueAge.Seconds() {
+		t.Errorf("stalled queue reported as %+v", h)
+	}
+	if !h.Queues["verifications"].Healthy {
+		t.Errorf("empty verification queue reported unhealthy: %+v", h.Queues["verifications"])
+	}
+
+	drainQueue(t)
+	wantStatus(t, serve(t, "GET", "/healthz", nil), 200)
+}
+
+func TestQueueClockTracksHead(t *testing.T) {
+	c := &queueClock{}
+	start := time.Now()
+	first := c.push(start)
+	second := c.push(start.Add(time.Second))
+	if age := c.oldestAge(start.Add(3 * time.Second)); age != 3*time.Second {
+		t.Errorf("oldest age %v, want 3s", age)
+	}
+	if c.position(first) != 1 || c.position(second) != 2 {
+		t.Errorf("positions %d and %d, want 1 and 2", c.position(first), c.position(second))
+	}
+	c.pop()
+	if age := c.oldestAge(start.Add(3 * time.Second)); age != 2*time.Second {
+		t.Errorf("oldest age after pop %v, want 2s", age)
+	}
+	if c.position(first) != 0 || c.position(second) != 1 {
+		t.Errorf("positions after pop %d and %d, want 0 and 1", c.position(first), c.position(second))
+	}
+}
+
+// panicOnceHook panics the first time it sees each transaction, so every
+// transfer is requeued once by the worker running it.
+type panicOnceHook struct {
+	mu   sync.Mutex
+	seen map[ID]bool
+}
+
+func (h *panicOnceHook) BeforeProcess(ctx context.Context, t *Transaction) error {
+	h.mu.Lock()
+	first := !h.seen[t.ID]
+	h.seen[t.ID] = true
+	h.mu.Unlock()
+	if first {
+		panic("test panic")
+	}
+	return nil
+}
+
+func (h *panicOnceHook) AfterProcess(ctx context.Context, t Transaction, result error) {}
+
+// Workers requeueing onto the full queue they drain keep making progress.
+func TestRequeueOntoFullQueue(t *testing.T) {
+	resetStore(t)
+	transactionQueue = make(chan Transaction, 4)
+	registerTransactionHook(&panicOnceHook{seen: make(map[ID]bool)})
+	receiver := newUser(t, true)
+	var senders []User
+	for i := 0; i < 8; i++ {
+		senders = append(senders, newUser(t, true))
+	}
+	startWorkers(t, 2)
+
+	var ids []ID
+	for i := 0; i < 40; i++ {
+		tx := addTransaction(Transaction{SenderID: senders[i%len(senders)].ID, ReceiverID: receiver.ID, Amount: 1, Currency: defaultCurrency})
+		ids = append(ids, tx.ID)
+		enqueueTransaction(tx)
+	}
+	for _, id := range ids {
+		waitFor(t, "transaction "+string(id), hasStatus(id, statusCompleted))
+	}
+	if balance(t, receiver.ID) != 1040 {
+		t.Errorf("receiver balance %v, want 1040", balance(t, receiver.ID))
+	}
+}
+
+// Releasing parked transfers onto a full queue doesn't block the
+// verification that releases them, which holds mu while it does.
+func TestReleaseOntoFullQueue(t *testing.T) {
+	resetStore(t)
+	transactionQueue = make(chan Transaction, 2)
+	sender, receiver := newUser(t, false), newUser(t, true)
+	var parked []ID
+	for i := 0; i < 3; i++ {
+		tx := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10, Currency: defaultCurrency})
+		parked = append(parked, tx.ID)
+		enqueueTransaction(tx)
+		drainQueue(t)
+	}
+	for i := 0; i < cap(transactionQueue); i++ {
+		tx := addTransaction(Transaction{SenderID: receiver.ID, ReceiverID: sender.ID, Amount: 1, Currency: defaultCurrency})
+		parked = append(parked, tx.ID)
+		enqueueTransaction(tx)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- verifyUser(sender) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("verification blocked releasing onto a full queue")
+	}
+	if _, ok := getUser(receiver.ID); !ok {
+		t.Fatal("store is still locked after the release")
+	}
+
+	startWorkers(t, 1)
+	for _, id := range parked {
+		waitFor(t, "transaction "+string(id), hasStatus(id, statusCompleted))
+	}
+	if balance(t, sender.ID) != 1000-30+2 {
+		t.Errorf("sender balance %v, want %v", balance(t, sender.ID), 1000-30+2)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+// userBalances fetches id's balance and available balance from GET
+// /user/{id}, GET /user and POST /users/balances, failing unless they agree.
+func userBalances(t *testing.T, id ID) (balance, available float64) {
+	t.Helper()
+	var one struct {
+		Balance   float64 `json:"balance"`
+		Available float64 `json:"available_balance"`
+		Held      float64 `json:"held"`
+	}
+	decode(t, serve(t, "GET", "/user/"+string(id), nil), &one)
+
+	var list struct {
+		Data []struct {
+			ID        ID      `json:"id"`
+			Balance   float64 `json:"balance"`
+			Available float64 `json:"available_balance"`
+		}
+	}
+	decode(t, serve(t, "GET", "/user?limit=100", nil), &list)
+	found := false
+	for _, u := range list.Data {
+		if u.ID == id {
+			found = true
+			if u.Balance != one.Balance || u.Available != one.Available {
+				t.Errorf("GET /user has %v/%v for %s, GET /user/%s has %v/%v", u.Balance, u.Available, id, id, one.Balance, one.Available)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("user %s missing from GET /user", id)
+	}
+
+	var bulk BalanceResult
+	decode(t, serve(t, "POST", "/users/balances", BalanceQuery{IDs: []ID{id}}), &bulk)
+	if b := bulk.Balances[id]; b.Balance != one.Balance || b.Available != one.Available {
+		t.Errorf("bulk balances have %v/%v for %s, GET /user/%s has %v/%v", b.Balance, b.Available, id, id, one.Balance, one.Available)
+	}
+	if one.Balance-one.Held != one.Available {
+		t.Errorf("user %s: balance %v held %v available %v", id, one.Balance, one.Held, one.Available)
+	}
+	return one.Balance, one.Available
+}
+
+func TestHoldsInUserResponses(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	if b, a := userBalances(t, sender.ID); b != 1000 || a != 1000 {
+		t.Fatalf("before the hold: balance %v available %v", b, a)
+	}
+
+	held := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 250, RequireAcceptance: true})
+	if b, a := userBalances(t, sender.ID); b != 1000 || a != 750 {
+		t.Errorf("with the hold: balance %v available %v, want 1000 and 750", b, a)
+	}
+	if b, a := userBalances(t, receiver.ID); b != 1000 || a != 1000 {
+		t.Errorf("receiver with the hold pending: balance %v available %v", b, a)
+	}
+
+	wantStatus(t, serve(t, "POST", "/transaction/"+string(held.ID)+"/accept", nil), 200)
+	if b, a := userBalances(t, sender.ID); b != 750 || a != 750 {
+		t.Errorf("after capture: balance %v available %v, want 750 and 750", b, a)
+	}
+	if b, a := userBalances(t, receiver.ID); b != 1250 || a != 1250 {
+		t.Errorf("receiver after capture: balance %v available %v, want 1250 and 1250", b, a)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// TransactionHook lets custom logic such as fraud scoring, logging or
+// enrichment run around each transaction without changing the worker.
+type TransactionHook interface {
+	// BeforeProcess runs before the transfer is checked and applied. Changes
+	// to t's metadata are kept, and must still pass the metadata limits;
+	// other changes are ignored. Returning an error fails the transaction
+	// with that reason, except *ReviewRequired, which parks it for an admin
+	// to approve or reject.
+	BeforeProcess(ctx context.Context, t *Transaction) error
+	// AfterProcess runs once the transaction has reached a terminal status,
+	// with the error it failed with, if any: when a worker finishes it, or
+	// later, when a transfer held for acceptance is accepted, rejected or
+	// expires, or one held for review is rejected. Transfers that never got
+	// as far as BeforeProcess, such as those parked until their sender's
+	// verification is rejected, don't run it, and nor do those dead-lettered
+	// by a panic, which may have come from a hook.
+	AfterProcess(ctx context.Context, t Transaction, result error)
+}
+
+// ReviewRequired is returned by a BeforeProcess hook that wants a human
+// to look at the transaction before it is applied.
+type ReviewRequired struct {
+	Note string
+}
+
+func (e *ReviewRequired) Error() string {
+	return string(CodeFlaggedForReview)
+}
+
+var hooksMu sync.RWMutex
+var transactionHooks []TransactionHook
+
+// registerTransactionHook adds h to the hooks run for every transaction,
+// in registration order. Call it at startup before workers start.
+func registerTransactionHook(h TransactionHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	transactionHooks = append(transactionHooks, h)
+}
+
+func registeredHooks() []TransactionHook {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	return transactionHooks
+}
+
+// runBeforeHooks stops at the first hook that rejects t or leaves its
+// metadata invalid. Hooks see a copy, and only the metadata they set is
+// copied back and stored.
+func runBeforeHooks(ctx context.Context, t *Transaction) error {
+	hooks := registeredHooks()
+	if len(hooks) == 0 {
+		return nil
+	}
+	hooked := *t
+	hooked.Metadata = make(map[string]string, len(t.Metadata))
+	for k, v := range t.Metadata {
+		hooked.Metadata[k] = v
+	}
+	for _, h := range hooks {
+		if err := h.BeforeProcess(ctx, &hooked); err != nil {
+			return err
+		}
+		if err := checkMetadata(hooked.Metadata); err != nil {
+			return err
+		}
+	}
+	t.Metadata = hooked.Metadata
+	setTransactionMetadata(t.ID, t.Metadata)
+	return nil
+}
+
+// runAfterHooks runs the AfterProcess hooks once id is terminal. While it
+// is still queued, held for acceptance or in review it does nothing; the
+// accept, reject, expiry or review path that finishes it runs them then.
+// It must be called without mu held, since hooks may read the store.
+func runAfterHooks(ctx context.Context, id ID, result error) {
+	hooks := registeredHooks()
+	if len(hooks) == 0 {
+		return
+	}
+	t, ok := getTransaction(id)
+	if !ok || !isTerminal(t.Status) {
+		return
+	}
+	for _, h := range hooks {
+		h.AfterProcess(ctx, t, result)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// limitHook rejects transfers over limit, tags the rest and records the
+// result of every transfer it sees finish.
+type limitHook struct {
+	limit   float64
+	mu      sync.Mutex
+	results map[ID]error
+}
+
+func (h *limitHook) BeforeProcess(ctx context.Context, t *Transaction) error {
+	if t.Amount > h.limit {
+		return errors.New("over_hook_limit")
+	}
+	t.Metadata["hooked"] = "yes"
+	t.Amount = 0
+	return nil
+}
+
+func (h *limitHook) AfterProcess(ctx context.Context, t Transaction, result error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results[t.ID] = result
+}
+
+func TestHookRejectsOverThreshold(t *testing.T) {
+	resetStore(t)
+	hook := &limitHook{limit: 100, results: make(map[ID]error)}
+	registerTransactionHook(hook)
+	sender, receiver := newUser(t, true), newUser(t, true)
+
+	over := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 150})
+	if over.Status != statusFailed || over.Reason != "over_hook_limit" {
+		t.Errorf("over the limit: status %s reason %q", over.Status, over.Reason)
+	}
+	under := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 60})
+	if under.Status != statusCompleted {
+		t.Fatalf("under the limit: status %s reason %q", under.Status, under.Reason)
+	}
+	if under.Metadata["hooked"] != "yes" {
+		t.Errorf("hook metadata not kept: %v", under.Metadata)
+	}
+	if under.Amount != 60 || balance(t, sender.ID) != 940 || balance(t, receiver.ID) != 1060 {
+		t.Errorf("hook changed the amount: %v, balances %v and %v", under.Amount, balance(t, sender.ID), balance(t, receiver.ID))
+	}
+
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if err, ok := hook.results[over.ID]; !ok || err == nil {
+		t.Errorf("AfterProcess for the rejected transfer got %v (seen %v)", err, ok)
+	}
+	if err, ok := hook.results[under.ID]; !ok || err != nil {
+		t.Errorf("AfterProcess for the completed transfer got %v (seen %v)", err, ok)
+	}
+}
+
+// bloatHook adds more metadata than a transfer may carry.
+type bloatHook struct{}
+
+func (bloatHook) BeforeProcess(ctx context.Context, t *Transaction) error {
+	for i := 0; i <= maxMetadataKeys; i++ {
+		t.Metadata[fmt.Sprintf("key%d", i)] = "value"
+	}
+	return nil
+}
+
+func (bloatHook) AfterProcess(context.Context, Transaction, error) {}
+
+func TestHookMetadataIsValidated(t *testing.T) {
+	resetStore(t)
+	registerTransactionHook(bloatHook{})
+	sender, receiver := newUser(t, true), newUser(t, true)
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10, Metadata: map[string]string{"order": "1"}})
+	if got.Status != statusFailed || got.Reason != string(CodeInvalidMetadata) {
+		t.Errorf("transfer with bloated metadata: status %s reason %q", got.Status, got.Reason)
+	}
+	if len(got.Metadata) != 1 || balance(t, receiver.ID) != 1000 {
+		t.Errorf("stored metadata %v, receiver %v", got.Metadata, balance(t, receiver.ID))
+	}
+}
+
+// Transfers finished outside the worker, by the receiver or a reviewer,
+// still reach AfterProcess.
+func TestAfterHooksRunForHeldTransfers(t *testing.T) {
+	resetStore(t)
+	registerTransactionHook(newFraudHook())
+	hook := &limitHook{limit: 1e9, results: make(map[ID]error)}
+	registerTransactionHook(hook)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	seen := func(id ID) (error, bool) {
+		hook.mu.Lock()
+		defer hook.mu.Unlock()
+		err, ok := hook.results[id]
+		return err, ok
+	}
+
+	accepted := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10, RequireAcceptance: true})
+	rejected := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10, RequireAcceptance: true})
+	approved := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: fraudNewAccountLimit + 1})
+	refused := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: fraudNewAccountLimit + 1})
+	for _, id := range []ID{accepted.ID, rejected.ID, approved.ID, refused.ID} {
+		if _, ok := seen(id); ok {
+			t.Errorf("AfterProcess ran for %s while it was held", id)
+		}
+	}
+
+	wantStatus(t, serve(t, "POST", "/transaction/"+string(accepted.ID)+"/accept", nil), 200)
+	wantStatus(t, serve(t, "POST", "/transaction/"+string(rejected.ID)+"/reject", nil), 200)
+	wantStatus(t, serve(t, "POST", "/admin/transaction/"+string(approved.ID)+"/approve", nil), 200)
+	wantStatus(t, serve(t, "POST", "/admin/transaction/"+string(refused.ID)+"/reject", nil), 200)
+	drainQueue(t)
+	for _, c := range []struct {
+		id   ID
+		fail bool
+	}{{accepted.ID, false}, {rejected.ID, true}, {approved.ID, false}, {refused.ID, true}} {
+		if err, ok := seen(c.id); !ok || (err != nil) != c.fail {
+			t.Errorf("AfterProcess for %s got %v (seen %v)", c.id, err, ok)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// ID identifies users and transactions. With the sequential strategy IDs
+// are decimal integers and are still encoded as JSON numbers, so existing
+// clients keep working; with the uuid strategy they are JSON strings.
+// Anything that isn't a canonical integer ("01", "+5", "-0") is a string
+// too, since it isn't a valid JSON number.
+type ID string
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	if n, err := strconv.ParseInt(string(id), 10, 64); err == nil && strconv.FormatInt(n, 10) == string(id) {
+		return []byte(id), nil
+	}
+	return json.Marshal(string(id))
+}
+
+// UnmarshalJSON accepts either a number or a string.
+func (id *ID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = ID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("id must be a string or number: %s", data)
+	}
+	*id = ID(n.String())
+	return nil
+}
+
+// less orders numeric IDs numerically and anything else lexically.
+func (id ID) less(other ID) bool {
+	a, errA := strconv.ParseInt(string(id), 10, 64)
+	b, errB := strconv.ParseInt(string(other), 10, 64)
+	if errA == nil && errB == nil {
+		return a < b
+	}
+	return id < other
+}
+
+// IDGenerator hands out new user and transaction IDs.
+type IDGenerator interface {
+	NewID() ID
+	// Observe tells the generator about an existing ID, e.g. one restored
+	// from saved state, so it is never handed out again.
+	Observe(ID)
+}
+
+// idStrategy selects the generator: "sequential" or "uuid".
+var idStrategy = "sequential"
+
+var userIDs IDGenerator = &sequentialIDs{}
+var transactionIDs IDGenerator = &sequentialIDs{}
+
+func newIDGenerator(strategy string) (IDGenerator, error) {
+	switch strategy {
+	case "sequential":
+		return &sequentialIDs{}, nil
+	case "uuid":
+		return uuidIDs{}, nil
+	}
+	return nil, fmt.Errorf("unknown id strategy %q", strategy)
+}
+
+type sequentialIDs struct {
+	mu   sync.Mutex
+	last int64
+}
+
+func (g *sequentialIDs) NewID() ID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.last++
+	return ID(strconv.FormatInt(g.last, 10))
+}
+
+func (g *sequentialIDs) Observe(id ID) {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if n > g.last {
+		g.last = n
+	}
+}
+
+// uuidIDs generates random (version 4) UUIDs.
+type uuidIDs struct{}
+
+func (uuidIDs) NewID() ID {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return ID(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+}
+
+func (uuidIDs) Observe(ID) {}
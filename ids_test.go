@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestSequentialIDs(t *testing.T) {
+	resetStore(t)
+	alice, bob := newUser(t, true), newUser(t, true)
+	if alice.ID != "1" || bob.ID != "2" {
+		t.Fatalf("ids %s and %s, want 1 and 2", alice.ID, bob.ID)
+	}
+	b, _ := json.Marshal(alice)
+	var raw map[string]interface{}
+	json.Unmarshal(b, &raw)
+	if _, ok := raw["id"].(float64); !ok {
+		t.Errorf("sequential id encoded as %T, want a JSON number", raw["id"])
+	}
+
+	userIDs.Observe("41")
+	if carol := newUser(t, true); carol.ID != "42" {
+		t.Errorf("id after observing 41 is %s, want 42", carol.ID)
+	}
+
+	var u User
+	decode(t, serve(t, "GET", "/user/"+string(bob.ID), nil), &u)
+	if u.ID != bob.ID {
+		t.Errorf("GET /user/%s returned user %s", bob.ID, u.ID)
+	}
+}
+
+func TestUUIDIDs(t *testing.T) {
+	resetStore(t)
+	userIDs, _ = newIDGenerator("uuid")
+	transactionIDs, _ = newIDGenerator("uuid")
+	alice, bob := newUser(t, true), newUser(t, true)
+	if !uuidPattern.MatchString(string(alice.ID)) || alice.ID == bob.ID {
+		t.Fatalf("uuid ids %s and %s", alice.ID, bob.ID)
+	}
+
+	tx := transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 25})
+	if !uuidPattern.MatchString(string(tx.ID)) || tx.Status != statusCompleted {
+		t.Fatalf("transfer %s: status %s reason %q", tx.ID, tx.Status, tx.Reason)
+	}
+
+	w := serve(t, "GET", "/user/"+string(alice.ID), nil)
+	wantStatus(t, w, 200)
+	var raw map[string]interface{}
+	decode(t, w, &raw)
+	if raw["id"] != string(alice.ID) {
+		t.Errorf("uuid id encoded as %v, want the string %s", raw["id"], alice.ID)
+	}
+	var got Transaction
+	decode(t, serve(t, "GET", "/transaction/"+string(tx.ID), nil), &got)
+	if got.ID != tx.ID || got.SenderID != alice.ID || got.ReceiverID != bob.ID {
+		t.Errorf("GET /transaction/%s: %+v", tx.ID, got)
+	}
+	wantStatus(t, serve(t, "GET", "/user/00000000-0000-4000-8000-000000000000", nil), 404)
+
+	w = serve(t, "POST", "/transaction", `{"sender_id":"`+string(bob.ID)+`","receiver_id":"`+string(alice.ID)+`","amount":5}`)
+	if w.Code >= 300 {
+		t.Fatalf("transfer with string ids: %d %s", w.Code, w.Body.String())
+	}
+	drainQueue(t)
+	if balance(t, alice.ID) != 980 {
+		t.Errorf("alice balance %v, want 980", balance(t, alice.ID))
+	}
+}
+
+func TestUnknownIDStrategy(t *testing.T) {
+	if _, err := newIDGenerator("ulid"); err == nil {
+		t.Error("unknown strategy was accepted")
+	}
+}
+
+// IDs that parse as integers without being canonical aren't valid JSON
+// numbers, so they must come back out as strings.
+func TestNonCanonicalNumericIDs(t *testing.T) {
+	resetStore(t)
+	odd := []ID{"01", "+5", "-0"}
+	for _, id := range odd {
+		b, err := json.Marshal(id)
+		if err != nil || string(b) != `"`+string(id)+`"` {
+			t.Errorf("%s encoded as %s (%v), want a JSON string", id, b, err)
+		}
+	}
+
+	bob := newUser(t, true)
+	w := serve(t, "POST", "/transaction", `{"sender_id":"01","receiver_id":"`+string(bob.ID)+`","amount":5}`)
+	wantStatus(t, w, 200)
+	var queued Transaction
+	decode(t, w, &queued)
+	if queued.SenderID != "01" {
+		t.Errorf("queued transfer from %q, want 01", queued.SenderID)
+	}
+	drainQueue(t)
+	var page struct {
+		Data []Transaction `json:"data"`
+	}
+	decode(t, serve(t, "GET", "/transactions", nil), &page)
+	if len(page.Data) != 1 || page.Data[0].SenderID != "01" {
+		t.Errorf("listed transactions %+v, want the one from 01", page.Data)
+	}
+
+	for _, id := range odd {
+		wantStatus(t, serve(t, "PUT", "/admin/blocklist/"+string(id), nil), 204)
+	}
+	var blocked struct{ Data []ID }
+	decode(t, serve(t, "GET", "/admin/blocklist", nil), &blocked)
+	if len(blocked.Data) != len(odd) {
+		t.Errorf("blocklist %v, want %v", blocked.Data, odd)
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := saveState(path); err != nil {
+		t.Fatal(err)
+	}
+	s, err := readState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Transactions) != 1 || s.Transactions[0].SenderID != "01" || s.Transactions[0].ReceiverID != bob.ID {
+		t.Errorf("saved transactions %+v", s.Transactions)
+	}
+	if len(s.Users) != len(snapshotState().Users) {
+		t.Errorf("saved %d users", len(s.Users))
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "sync"
+
+// maxInFlightPerAccount bounds how many of one sender's transactions are
+// processed at once; the default of 1 fully serializes each account.
+// Transactions over the cap wait their turn. Zero disables the cap.
+var maxInFlightPerAccount = 1
+
+var senderSlots *accountLimiter
+
+// accountLimiter never blocks a worker, like currencyLimiter. A
+// transaction over its sender's cap is parked, and the worker that
+// finishes one of that sender's transactions runs it next, so a burst
+// from one sender can't tie up the pool.
+type accountLimiter struct {
+	mu     sync.Mutex
+	max    int
+	active map[ID]int
+	parked map[ID][]Transaction
+}
+
+func newAccountLimiter(max int) *accountLimiter {
+	return &accountLimiter{max: max, active: make(map[ID]int), parked: make(map[ID][]Transaction)}
+}
+
+// admit takes a slot for t, or parks it and returns false. Anything
+// already parked goes first so a sender's transfers keep their order.
+func (l *accountLimiter) admit(t Transaction) bool {
+	if l == nil || l.max <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[t.SenderID] < l.max && len(l.parked[t.SenderID]) == 0 {
+		l.active[t.SenderID]++
+		return true
+	}
+	l.parked[t.SenderID] = append(l.parked[t.SenderID], t)
+	return false
+}
+
+// done frees the slot held for sender. If a transaction is parked it
+// inherits the slot and is returned for the caller to run.
+func (l *accountLimiter) done(sender ID) (Transaction, bool) {
+	if l == nil || l.max <= 0 {
+		return Transaction{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if queue := l.parked[sender]; len(queue) > 0 {
+		next := queue[0]
+		if len(queue) == 1 {
+			delete(l.parked, sender)
+		} else {
+			l.parked[sender] = queue[1:]
+		}
+		return next, true
+	}
+	if l.active[sender]--; l.active[sender] <= 0 {
+		delete(l.active, sender)
+	}
+	return Transaction{}, false
+}
+
+func (l *accountLimiter) parkedCount() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, q := range l.parked {
+		n += len(q)
+	}
+	return n
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestInFlightCapPerSender(t *testing.T) {
+	resetStore(t)
+	maxInFlightPerAccount = 1
+	senderSlots = newAccountLimiter(maxInFlightPerAccount)
+	busy, other, receiver := newUser(t, true), newUser(t, true), newUser(t, true)
+	hook := &gateHook{sender: busy.ID, open: make(chan struct{})}
+	registerTransactionHook(hook)
+	startWorkers(t, 2)
+
+	var queued []Transaction
+	for i := 1; i <= 4; i++ {
+		tx := addTransaction(Transaction{SenderID: busy.ID, ReceiverID: receiver.ID, Amount: float64(i), Currency: defaultCurrency})
+		enqueueTransaction(tx)
+		queued = append(queued, tx)
+	}
+	waitFor(t, "the first transfer to start", func() bool { return hook.held() == 1 })
+	waitFor(t, "the rest to be parked", func() bool { return senderSlots.parkedCount() == 3 })
+
+	// Both workers would be stuck if over-cap transfers blocked them
+	free := addTransaction(Transaction{SenderID: other.ID, ReceiverID: receiver.ID, Amount: 5, Currency: defaultCurrency})
+	enqueueTransaction(free)
+	waitFor(t, "another sender's transfer", hasStatus(free.ID, statusCompleted))
+
+	close(hook.open)
+	for _, tx := range queued {
+		waitFor(t, "transfer "+string(tx.ID), hasStatus(tx.ID, statusCompleted))
+	}
+	if hook.most != 1 {
+		t.Errorf("%d of one sender's transfers ran at once, want 1", hook.most)
+	}
+	if balance(t, busy.ID) != 990 {
+		t.Errorf("sender balance %v, want 990", balance(t, busy.ID))
+	}
+}
+
+func TestAccountLimiterKeepsOrder(t *testing.T) {
+	l := newAccountLimiter(1)
+	if !l.admit(Transaction{ID: "1", SenderID: "a"}) {
+		t.Fatal("first transfer was parked")
+	}
+	if l.admit(Transaction{ID: "2", SenderID: "a"}) || l.admit(Transaction{ID: "3", SenderID: "a"}) {
+		t.Fatal("over-cap transfers were admitted")
+	}
+	if !l.admit(Transaction{ID: "4", SenderID: "b"}) {
+		t.Error("another sender was parked")
+	}
+	for _, want := range []ID{"2", "3"} {
+		next, ok := l.done("a")
+		if !ok || next.ID != want {
+			t.Fatalf("done handed over %v %v, want %s", next.ID, ok, want)
+		}
+	}
+	if _, ok := l.done("a"); ok || len(l.active) != 1 {
+		t.Errorf("slots left active: %v", l.active)
+	}
+}
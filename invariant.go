@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// checkInvariants verifies every applied transfer conserves money across
+// the accounts it touches. Meant for test and dev; it costs a few map
+// reads per transfer.
+var checkInvariants bool
+
+// rollbackOnViolation undoes a transfer that fails the check instead of
+// only reporting it.
+var rollbackOnViolation bool
+
+// invariantViolations counts failed checks; it is exposed in /admin/debug.
+var invariantViolations int32
+
+// conservationCheck snapshots the accounts a transfer can touch: sender,
+// receiver and the currency reserve, where fees would land.
+type conservationCheck struct {
+	t      Transaction
+	before map[ID]User
+}
+
+// beginConservationCheck must be called with mu held, before the
+// transfer's events are recorded. It returns nil when checks are off.
+func beginConservationCheck(t Transaction) *conservationCheck {
+	if !checkInvariants {
+		return nil
+	}
+	return &conservationCheck{t: t, before: touchedAccounts(t)}
+}
+
+// touchedAccounts copies the accounts t can touch. A conversion nets out
+// per currency, so counting both reserves makes the combined total come
+// out unchanged too. It must be called with mu held.
+func touchedAccounts(t Transaction) map[ID]User {
+	accounts := make(map[ID]User)
+	for _, id := range []ID{t.SenderID, t.ReceiverID, systemAccounts[t.Currency], systemAccounts[t.ConvertedCurrency]} {
+		if u, ok := db[id]; ok {
+			accounts[id] = u
+		}
+	}
+	return accounts
+}
+
+// total sums the balances in users of the accounts c covers.
+func (c *conservationCheck) total(users map[ID]User) float64 {
+	total := 0.0
+	for id := range c.before {
+		total += users[id].Balance
+	}
+	return total
+}
+
+// verify reports a violation, rolling the transfer back if configured.
+// It must be called with mu still held. A nil check always passes.
+func (c *conservationCheck) verify() *APIError {
+	if c == nil {
+		return nil
+	}
+	before := c.total(c.before)
+	after := c.total(db)
+	if math.Abs(after-before) <= 1e-9*math.Max(1, math.Abs(before)) {
+		return nil
+	}
+	atomic.AddInt32(&invariantViolations, 1)
+	log.Printf("INVARIANT VIOLATION: transaction %s changed total balance of its accounts from %v to %v",
+		c.t.ID, before, after)
+	if !rollbackOnViolation {
+		return nil
+	}
+	rollBack(c.before, c.t.ID)
+	return newError(CodeInvariantViolation, "Transfer did not conserve money and was rolled back")
+}
+
+// rollBack puts every account in before back the way it was, on behalf of
+// transaction id. The log is append-only, so what was applied stays in it
+// and a compensating event per changed account undoes it. It must be
+// called with mu held.
+func rollBack(before map[ID]User, id ID) {
+	ids := make([]ID, 0, len(before))
+	for id := range before {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	for _, account := range ids {
+		was, now := before[account], db[account]
+		if was.Balance != now.Balance || was.Unsettled != now.Unsettled {
+			recordEvent(Event{Type: eventRolledBack, UserID: account, TransactionID: id,
+				Amount: was.Balance - now.Balance, UnsettledAmount: was.Unsettled - now.Unsettled})
+		}
+	}
+}
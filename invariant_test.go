@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// injectFault runs fault after each event applied to an existing account,
+// live and in replays alike, until the test ends.
+func injectFault(t *testing.T, fault func(users map[ID]User, e Event)) {
+	testHookApplyEvent = fault
+	t.Cleanup(func() { testHookApplyEvent = nil })
+}
+
+// skimReceiver loses a unit of every transferred credit, like the old
+// receiver-not-found bug that destroyed money.
+func skimReceiver(users map[ID]User, e Event) {
+	if e.Type == eventTransferred {
+		u := users[e.ReceiverID]
+		u.Balance--
+		users[e.ReceiverID] = u
+	}
+}
+
+func TestInvariantViolationIsDetected(t *testing.T) {
+	resetStore(t)
+	checkInvariants = true
+	injectFault(t, skimReceiver)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	violations := atomic.LoadInt32(&invariantViolations)
+
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	if n := atomic.LoadInt32(&invariantViolations) - violations; n != 1 {
+		t.Errorf("%d violations counted, want 1", n)
+	}
+	// Without rollback the transfer stands
+	if got.Status != statusCompleted || balance(t, receiver.ID) != 1009 {
+		t.Errorf("status %s, receiver %v", got.Status, balance(t, receiver.ID))
+	}
+}
+
+func TestInvariantViolationRollsBack(t *testing.T) {
+	resetStore(t)
+	checkInvariants, rollbackOnViolation = true, true
+	injectFault(t, skimReceiver)
+	sender, receiver := newUser(t, true), newUser(t, true)
+
+	seq := len(events)
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	if got.Status != statusFailed || got.Reason != string(CodeInvariantViolation) {
+		t.Fatalf("status %s reason %q", got.Status, got.Reason)
+	}
+	if balance(t, sender.ID) != 1000 || balance(t, receiver.ID) != 1000 {
+		t.Errorf("after rollback: sender %v, receiver %v", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+
+	// The transfer stays in the log, followed by its compensation
+	logged := events[seq:]
+	if len(logged) != 3 || logged[0].Type != eventTransferred || logged[1].Type != eventRolledBack || logged[2].Type != eventRolledBack {
+		t.Fatalf("events after the transfer: %+v", logged)
+	}
+	for id, u := range Replay(events) {
+		if u.Balance != balance(t, id) {
+			t.Errorf("replay gives user %s %v, store has %v", id, u.Balance, balance(t, id))
+		}
+	}
+	if problems := checkLedger(snapshotState()); len(problems) > 0 {
+		t.Errorf("self-test problems after rollback: %v", problems)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// GetTopUsers lists users by balance, highest first, ties broken by ID.
+// ?n= is shorthand for limit; offset/cursor page further down the list.
+func GetTopUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	opts, err := parseResponseOptions(r, userFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	if v := r.URL.Query().Get("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			writeError(w, 400, CodeBadRequest, "Bad request")
+			return
+		}
+		limit = n
+	}
+
+	mu.RLock()
+	users := make([]User, 0, len(db))
+	for _, u := range db {
+		users = append(users, u)
+	}
+	mu.RUnlock()
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].Balance != users[j].Balance {
+			return users[i].Balance > users[j].Balance
+		}
+		return users[i].ID.less(users[j].ID)
+	})
+	start, end, p := paginate(len(users), limit, offset)
+
+	writeResponse(w, opts, Envelope{Data: users[start:end], Pagination: p})
+}
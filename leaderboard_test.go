@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopUsers(t *testing.T) {
+	resetStore(t)
+	var u []User
+	for i := 0; i < 10; i++ {
+		u = append(u, newUser(t, true))
+	}
+	transfer(t, Transaction{SenderID: u[0].ID, ReceiverID: u[4].ID, Amount: 300})
+	transfer(t, Transaction{SenderID: u[2].ID, ReceiverID: u[3].ID, Amount: 100})
+
+	top := func(query string) []ID {
+		var page struct{ Data []User }
+		decode(t, serve(t, "GET", "/users/top?"+query, nil), &page)
+		var ids []ID
+		for _, x := range page.Data {
+			ids = append(ids, x.ID)
+		}
+		return ids
+	}
+	// ties at 1000 go by ID, so 10 sorts after 9
+	want := []ID{u[4].ID, u[3].ID, u[1].ID, u[5].ID, u[6].ID, u[7].ID, u[8].ID, u[9].ID, u[2].ID, u[0].ID}
+	if got := top("n=10"); !reflect.DeepEqual(got, want) {
+		t.Errorf("top 10 %v, want %v", got, want)
+	}
+	if got := top("n=3"); !reflect.DeepEqual(got, want[:3]) {
+		t.Errorf("top 3 %v, want %v", got, want[:3])
+	}
+	if got := top("n=3&offset=3"); !reflect.DeepEqual(got, want[3:6]) {
+		t.Errorf("next 3 %v, want %v", got, want[3:6])
+	}
+	wantStatus(t, serve(t, "GET", "/users/top?n=0", nil), 400)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// displayLocale formats amounts when ?formatted=true is passed without a
+// ?locale= and Accept-Language names no supported locale.
+var displayLocale = "en-US"
+
+type numberFormat struct {
+	group   string
+	decimal string
+}
+
+// localeFormats is keyed by lower-case language tag; a bare language such
+// as "de" covers every region without its own entry.
+var localeFormats = map[string]numberFormat{
+	"en":    {",", "."},
+	"en-in": {",", "."},
+	"ja":    {",", "."},
+	"zh":    {",", "."},
+	"de":    {".", ","},
+	"de-ch": {"'", "."},
+	"es":    {".", ","},
+	"it":    {".", ","},
+	"nl":    {".", ","},
+	"pt":    {".", ","},
+	"fr":    {" ", ","},
+	"ru":    {" ", ","},
+	"pl":    {" ", ","},
+	"sv":    {" ", ","},
+}
+
+// amountFields are the numeric fields that get a <name>_formatted sibling.
+var amountFields = []string{"amount", "balance", "available_balance", "held", "unsettled"}
+
+func lookupLocale(tag string) (numberFormat, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if f, ok := localeFormats[tag]; ok {
+		return f, true
+	}
+	f, ok := localeFormats[strings.SplitN(tag, "-", 2)[0]]
+	return f, ok
+}
+
+// acceptLanguage lists the tags in an Accept-Language header, highest
+// quality first.
+func acceptLanguage(header string) []string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		t := tag{name: fields[0], q: 1}
+		for _, p := range fields[1:] {
+			if v := strings.TrimPrefix(strings.TrimSpace(p), "q="); v != p {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					t.q = q
+				}
+			}
+		}
+		if t.name != "" && t.name != "*" {
+			tags = append(tags, t)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.name
+	}
+	return names
+}
+
+// parseNumberFormat returns nil unless formatted amounts were asked for.
+// An explicit ?locale= must be supported; Accept-Language falls back to
+// displayLocale.
+func parseNumberFormat(r *http.Request) (*numberFormat, error) {
+	q := r.URL.Query()
+	if v := q.Get("locale"); v != "" {
+		f, ok := lookupLocale(v)
+		if !ok {
+			return nil, fmt.Errorf("unsupported locale %q", v)
+		}
+		return &f, nil
+	}
+	if q.Get("formatted") != "true" {
+		return nil, nil
+	}
+	for _, tag := range acceptLanguage(r.Header.Get("Accept-Language")) {
+		if f, ok := lookupLocale(tag); ok {
+			return &f, nil
+		}
+	}
+	f, _ := lookupLocale(displayLocale)
+	return &f, nil
+}
+
+// format renders amount with the currency's number of decimals.
+func (f numberFormat) format(amount float64, currency string) string {
+	digits := strconv.FormatFloat(math.Abs(amount), 'f', currencyDecimals[currency], 64)
+	whole, frac := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		whole, frac = digits[:i], digits[i+1:]
+	}
+	var b strings.Builder
+	if amount < 0 {
+		b.WriteByte('-')
+	}
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(f.group)
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(f.decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// addFormattedAmounts sets <name>_formatted next to each amount in a
+// decoded user or transaction, leaving the raw value as it is.
+func addFormattedAmounts(m map[string]interface{}, f numberFormat) {
+	currency, _ := m["currency"].(string)
+	for _, name := range amountFields {
+		n, ok := m[name].(json.Number)
+		if !ok {
+			continue
+		}
+		v, err := n.Float64()
+		if err != nil {
+			continue
+		}
+		m[name+"_formatted"] = f.format(v, currency)
+	}
+}
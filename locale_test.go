@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNumberFormats(t *testing.T) {
+	for _, c := range []struct {
+		locale   string
+		amount   float64
+		currency string
+		want     string
+	}{
+		{"en-US", 1234567.5, "USD", "1,234,567.50"},
+		{"de-DE", 1234567.5, "EUR", "1.234.567,50"},
+		{"fr", 1000.5, "EUR", "1\u202f000,50"},
+		{"de-CH", 1000.5, "USD", "1'000.50"},
+		{"en", 1234567, "JPY", "1,234,567"},
+		{"en", -999.125, "KWD", "-999.125"},
+		{"en", 0.5, "USD", "0.50"},
+	} {
+		f, ok := lookupLocale(c.locale)
+		if !ok {
+			t.Fatalf("locale %s not found", c.locale)
+		}
+		if got := f.format(c.amount, c.currency); got != c.want {
+			t.Errorf("%s %v %s: %q, want %q", c.locale, c.amount, c.currency, got, c.want)
+		}
+	}
+}
+
+func TestAcceptLanguageOrder(t *testing.T) {
+	got := acceptLanguage("fr;q=0.5, de-DE, *;q=0.1, en;q=0.8")
+	want := []string{"de-DE", "en", "fr"}
+	if len(got) != len(want) {
+		t.Fatalf("tags %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("tags %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFormattedAmountsKeepRawValues(t *testing.T) {
+	resetStore(t)
+	u, other := newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: other.ID, ReceiverID: u.ID, Amount: 0.5})
+	path := "/user/" + string(u.ID)
+
+	for _, c := range []struct {
+		query, language, want string
+	}{
+		{"?locale=de-DE", "", "1.000,50"},
+		{"?locale=en-US", "de", "1,000.50"},
+		{"?formatted=true", "de-AT, en;q=0.5", "1.000,50"},
+		{"?formatted=true", "xx", "1,000.50"},
+	} {
+		w := serve(t, "GET", path+c.query, nil, "Accept-Language", c.language)
+		wantStatus(t, w, 200)
+		var m map[string]interface{}
+		decode(t, w, &m)
+		if m["balance_formatted"] != c.want || m["balance"] != 1000.5 {
+			t.Errorf("%s with %q: balance %v formatted %v, want 1000.5 and %s", c.query, c.language, m["balance"], m["balance_formatted"], c.want)
+		}
+	}
+
+	var raw map[string]json.RawMessage
+	decode(t, serve(t, "GET", path, nil, "Accept-Language", "de"), &raw)
+	if _, ok := raw["balance_formatted"]; ok {
+		t.Error("amounts were formatted without being asked for")
+	}
+	var m map[string]interface{}
+	decode(t, serve(t, "GET", path+"?locale=fr&fields=balance", nil), &m)
+	if len(m) != 2 || m["balance_formatted"] != "1\u202f000,50" {
+		t.Errorf("filtered formatted user %v, want balance and balance_formatted", m)
+	}
+	wantStatus(t, serve(t, "GET", path+"?locale=tlh", nil), 400)
+}
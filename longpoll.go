@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// longPollTimeout caps how long GET /transaction/{id}/wait may block. Keep
+// it under -write-timeout or the response will be cut off.
+var longPollTimeout = 10 * time.Second
+
+// waiters are signalled when a transaction reaches a terminal status.
+// Guarded by txMu.
+var waiters = make(map[ID][]chan struct{})
+
+// wakeWaiters must be called with txMu held.
+func wakeWaiters(id ID) {
+	for _, ch := range waiters[id] {
+		close(ch)
+	}
+	delete(waiters, id)
+}
+
+// waitForTransaction returns a channel closed once id is terminal, or nil
+// if it already is. ok is false if the transaction doesn't exist.
+func waitForTransaction(id ID) (ch chan struct{}, ok bool) {
+	txMu.Lock()
+	defer txMu.Unlock()
+	t, ok := transactions[id]
+	if !ok || isTerminal(t.Status) {
+		return nil, ok
+	}
+	ch = make(chan struct{})
+	waiters[id] = append(waiters[id], ch)
+	return ch, true
+}
+
+func stopWaiting(id ID, ch chan struct{}) {
+	txMu.Lock()
+	defer txMu.Unlock()
+	list := waiters[id]
+	for i, c := range list {
+		if c == ch {
+			waiters[id] = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(waiters[id]) == 0 {
+		delete(waiters, id)
+	}
+}
+
+// WaitTransaction long-polls until the transaction finishes or ?timeout=
+// (default and maximum longPollTimeout) passes, then answers 204 so the
+// client can poll again.
+func WaitTransaction(w http.ResponseWriter, r *http.Request) {
+	id := ID(mux.Vars(r)["id"])
+	opts, err := parseResponseOptions(r, transactionFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	expand, err := parseExpand(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	timeout := longPollTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, 400, CodeBadRequest, "Bad request")
+			return
+		}
+		if d < timeout {
+			timeout = d
+		}
+	}
+
+	ch, ok := waitForTransaction(id)
+	if !ok {
+		writeError(w, 404, CodeTransactionNotFound, "Transaction not found")
+		return
+	}
+	if ch != nil {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-ch:
+		case <-timer.C:
+			stopWaiting(id, ch)
+			w.WriteHeader(204)
+			return
+		case <-r.Context().Done():
+			stopWaiting(id, ch)
+			return
+		}
+	}
+
+	t, _ := getTransaction(id)
+	if expand {
+		writeResponse(w, opts, expandCounterparties([]Transaction{t})[0])
+		return
+	}
+	writeResponse(w, opts, t)
+}
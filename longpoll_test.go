@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLongPollReturnsOnCompletion(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	tx := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10, Currency: defaultCurrency})
+	enqueueTransaction(tx)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve(t, "GET", "/transaction/"+string(tx.ID)+"/wait?timeout=5s", nil) }()
+	waitFor(t, "the waiter", func() bool {
+		txMu.Lock()
+		defer txMu.Unlock()
+		return len(waiters[tx.ID]) == 1
+	})
+	start := time.Now()
+	drainQueue(t)
+
+	select {
+	case w := <-done:
+		wantStatus(t, w, 200)
+		var got Transaction
+		decode(t, w, &got)
+		if got.Status != statusCompleted {
+			t.Errorf("long-poll returned status %s", got.Status)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("long-poll took %v after completion", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("long-poll did not return on completion")
+	}
+	wantStatus(t, serve(t, "GET", "/transaction/"+string(tx.ID)+"/wait", nil), 200)
+}
+
+func TestLongPollTimesOut(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	tx := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10, Currency: defaultCurrency})
+
+	wantStatus(t, serve(t, "GET", "/transaction/"+string(tx.ID)+"/wait?timeout=20ms", nil), 204)
+	if n := len(waiters); n != 0 {
+		t.Errorf("%d waiters left after timing out", n)
+	}
+	wantStatus(t, serve(t, "GET", "/transaction/999/wait?timeout=20ms", nil), 404)
+	wantStatus(t, serve(t, "GET", "/transaction/"+string(tx.ID)+"/wait?timeout=soon", nil), 400)
+}
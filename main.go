@@ -1,108 +1,490 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
-var mu sync.Mutex
-var db map[int]User
+// mu guards db. Every transfer applies its debit and credit under one
+// write lock, so readers holding the read lock always see whole transfers.
+var mu sync.RWMutex
+var db map[ID]User
 var verificationQueue chan User
+
+// verifying holds IDs of users queued or in verification.
+var verifyingMu sync.Mutex
+var verifying = make(map[ID]bool)
 var transactionQueue chan Transaction
 
+// verificationEnabled can be turned off for demo or trusted deployments:
+// users are then created verified and the verification queue is skipped.
+var verificationEnabled = true
+
+// requireVerifiedReceiver rejects transfers to unverified accounts.
+var requireVerifiedReceiver bool
+
 func init() {
-	db = make(map[int]User)
+	db = make(map[ID]User)
 	verificationQueue = make(chan User, 1000)
 	transactionQueue = make(chan Transaction, 1000)
+	blocklist = make(map[ID]bool)
+	transactions = make(map[ID]Transaction)
+	recentTransfers = newTTLStore(time.Minute)
+	pendingConfirmations = newTTLStore(time.Minute)
+	usedNonces = newTTLStore(time.Minute)
 }
 
 func main() {
-	r := mux.NewRouter()
+	flag.StringVar(&blocklistFile, "blocklist-file", "blocklist.json", "file the account blocklist is persisted to")
+	flag.DurationVar(&duplicateWindow, "duplicate-window", duplicateWindow, "window for rejecting identical transfers, 0 to disable")
+	flag.Float64Var(&lowBalanceThreshold, "low-balance-threshold", 0, "default balance below which users are alerted")
+	flag.IntVar(&poolMinWorkers, "workers-min", poolMinWorkers, "minimum transaction workers")
+	flag.IntVar(&poolMaxWorkers, "workers-max", poolMaxWorkers, "maximum transaction workers")
+	flag.IntVar(&poolScaleThreshold, "workers-scale-threshold", poolScaleThreshold, "queue depth above which another worker is added")
+	flag.DurationVar(&poolScaleCooldown, "workers-scale-cooldown", poolScaleCooldown, "minimum time between worker pool scaling steps")
+	flag.BoolVar(&requireVerifiedReceiver, "require-verified-receiver", false, "reject transfers to unverified receivers")
+	flag.Float64Var(&userRatePerMinute, "user-rate", userRatePerMinute, "transfers a user may start per minute, 0 to disable")
+	flag.IntVar(&userRateBurst, "user-rate-burst", userRateBurst, "transfers a user may start at once")
+	flag.StringVar(&apiPrefix, "api-prefix", apiPrefix, "path prefix for versioned routes, empty to disable")
+	flag.BoolVar(&serveUnprefixed, "serve-unprefixed", serveUnprefixed, "also serve routes without the version prefix")
+	flag.Float64Var(&confirmationThreshold, "confirmation-threshold", 0, "amount above which transfers need a second confirmation, 0 to disable")
+	flag.DurationVar(&confirmationTTL, "confirmation-ttl", confirmationTTL, "how long a transfer confirmation token stays valid")
+	flag.StringVar(&stateFile, "state-file", stateFile, "file users and queued work are saved to on shutdown, e.g. state.json; empty keeps them in memory only")
+	flag.StringVar(&adminKey, "admin-key", os.Getenv("LEMONADE_ADMIN_KEY"), "key required in X-Admin-Key for /admin routes")
+	flag.StringVar(&adminKeyList, "admin-keys", os.Getenv("LEMONADE_ADMIN_KEYS"), "named admin keys, e.g. alice=key1,bob=key2, each accepted in X-Admin-Key and recorded as that admin")
+	flag.DurationVar(&longPollTimeout, "long-poll-timeout", longPollTimeout, "maximum time a transaction wait request blocks")
+	flag.BoolVar(&verificationEnabled, "verification", verificationEnabled, "verify new users before they can send")
+	flag.DurationVar(&maxQueueAge, "max-queue-age", maxQueueAge, "oldest queued item age at which /healthz reports unhealthy")
+	flag.BoolVar(&orderBySender, "order-by-sender", false, "process each sender's transfers in submission order")
+	flag.IntVar(&senderPartitions, "sender-partitions", senderPartitions, "worker partitions used with -order-by-sender")
+	flag.DurationVar(&roundingInterval, "rounding-interval", 0, "how often to round balances to currency precision, 0 to disable")
+	flag.IntVar(&maxInFlightPerAccount, "max-in-flight-per-account", maxInFlightPerAccount, "transactions per sender processed at once, 0 for no cap")
+	flag.DurationVar(&settlementWindow, "settlement-window", 0, "how long received funds stay unspendable, 0 for immediately")
+	flag.StringVar(&auditFile, "admin-audit-file", "", "file admin actions are appended to as JSON lines, empty to keep them in memory only")
+	flag.DurationVar(&readTimeout, "read-timeout", readTimeout, "maximum time to read a whole request")
+	flag.DurationVar(&readHeaderTimeout, "read-header-timeout", readHeaderTimeout, "maximum time to read request headers")
+	flag.DurationVar(&writeTimeout, "write-timeout", writeTimeout, "maximum time to write a response")
+	flag.DurationVar(&idleTimeout, "idle-timeout", idleTimeout, "how long an idle keep-alive connection stays open")
+	flag.IntVar(&maxHeaderBytes, "max-header-bytes", maxHeaderBytes, "maximum size of request headers")
+	flag.DurationVar(&drainTimeout, "drain-timeout", drainTimeout, "how long shutdown waits for open connections to finish")
+	flag.DurationVar(&maxQueueWait, "max-queue-wait", 0, "estimated queue wait above which new transfers get 503, 0 to never shed")
+	flag.DurationVar(&acceptanceTimeout, "acceptance-timeout", acceptanceTimeout, "how long a transfer waits for the receiver to accept before the hold is released")
+	flag.StringVar(&displayLocale, "display-locale", displayLocale, "locale for ?formatted=true amounts when the request names none")
+	flag.BoolVar(&debugEnvelopes, "debug-envelope", false, "wrap every JSON response with request_id, timestamp and duration")
+	flag.BoolVar(&checkInvariants, "check-invariants", false, "verify each transfer conserves money across the accounts it touches")
+	flag.BoolVar(&rollbackOnViolation, "rollback-on-violation", false, "with -check-invariants, undo transfers that fail the check")
+	flag.StringVar(&currencyLimits, "currency-limits", "", `per-currency worker caps: "even", or e.g. "USD=6,EUR=2"; empty for none`)
+	flag.StringVar(&pushgatewayURL, "pushgateway-url", "", "Prometheus Pushgateway to push final metrics to on shutdown, empty to disable")
+	flag.StringVar(&pushgatewayJob, "pushgateway-job", pushgatewayJob, "job name metrics are pushed under")
+	flag.DurationVar(&outboundTimeout, "outbound-timeout", outboundTimeout, "how long each call to another service, such as the Pushgateway, may take")
+	flag.StringVar(&signingSecret, "signing-secret", os.Getenv("LEMONADE_SIGNING_SECRET"), "shared secret for HMAC-signed transfers")
+	flag.StringVar(&verificationSecret, "verification-secret", os.Getenv("LEMONADE_VERIFICATION_SECRET"), "shared secret for signed verification provider callbacks; when set, only callbacks verify users")
+	flag.BoolVar(&requireSignature, "require-signature", false, "with -signing-secret, refuse unsigned transfers")
+	flag.Float64Var(&transferFeePercent, "transfer-fee-percent", 0, "percentage of each transfer charged to the sender and booked to the currency reserve")
+	flag.DurationVar(&signatureSkew, "signature-skew", signatureSkew, "how far a signed transfer's signed_at may be from the server clock")
+	flag.StringVar(&durability, "durability", durability, "when transfers are saved to -state-file: shutdown, async (periodic snapshots) or sync (journaled before answering)")
+	flag.DurationVar(&flushInterval, "flush-interval", flushInterval, "how often -durability async or sync snapshots the whole state")
+	flag.IntVar(&maxPageLimit, "max-page-limit", maxPageLimit, "most records a list endpoint returns per request")
+	flag.BoolVar(&fraudCheck, "fraud-check", false, "hold unusually large transfers for admin review")
+	flag.Float64Var(&fraudAverageMultiple, "fraud-average-multiple", fraudAverageMultiple, "with -fraud-check, flag transfers over this multiple of the sender's average")
+	flag.DurationVar(&fraudMinAccountAge, "fraud-min-account-age", fraudMinAccountAge, "with -fraud-check, accounts younger than this are limited to -fraud-new-account-limit")
+	flag.Float64Var(&fraudNewAccountLimit, "fraud-new-account-limit", fraudNewAccountLimit, "with -fraud-check, largest transfer a new account makes without review")
+	flag.IntVar(&maxExportLimit, "max-export-limit", maxExportLimit, "most transactions one /transactions/export page streams")
+	flag.Float64Var(&adjustmentApprovalThreshold, "adjustment-approval-threshold", adjustmentApprovalThreshold, "largest balance adjustment one admin may apply without a second admin's approval")
+	flag.BoolVar(&selfTest, "self-test", selfTest, "check -state-file is writable and its ledger balances before loading it")
+	flag.StringVar(&selfTestFailure, "self-test-failure", selfTestFailure, "what a failed self-test does: exit, or read-only to serve reads only")
+	flag.StringVar(&fxRates, "fx-rates", "", `rates for cross-currency transfers, e.g. "USD/EUR=0.92,USD/JPY=150"; empty rejects them`)
+	flag.StringVar(&idStrategy, "id-strategy", idStrategy, "user and transaction ID format: sequential or uuid")
+	flag.Parse()
 
-	r.HandleFunc("/user", CreateUser).Methods("POST")
-	r.HandleFunc("/user", GetUser).Methods("GET")
-	r.HandleFunc("/transaction", Transfer).Methods("POST")
+	var err error
+	if userIDs, err = newIDGenerator(idStrategy); err != nil {
+		log.Fatal(err)
+	}
+	transactionIDs, _ = newIDGenerator(idStrategy)
+	if maxPageLimit < 1 || maxExportLimit < 1 {
+		log.Fatal("-max-page-limit and -max-export-limit must be at least 1")
+	}
+	if adminKeys, err = parseAdminKeys(adminKeyList); err != nil {
+		log.Fatal(err)
+	}
+	if selfTestFailure != selfTestExit && selfTestFailure != selfTestReadOnly {
+		log.Fatalf("unknown -self-test-failure %q", selfTestFailure)
+	}
+	if !validDurability(durability) {
+		log.Fatalf("unknown durability mode %q", durability)
+	}
+	if durability != durabilityShutdown && stateFile == "" {
+		log.Fatal("-durability needs -state-file")
+	}
+	if requireSignature && signingSecret == "" {
+		log.Fatal("-require-signature needs -signing-secret")
+	}
+	if transferFeePercent < 0 || transferFeePercent >= 100 {
+		log.Fatalf("-transfer-fee-percent %v is out of range", transferFeePercent)
+	}
+	if fxRates != "" {
+		rates, err := parseFixedRates(fxRates)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rateProvider = rates
+	}
+	if _, ok := lookupLocale(displayLocale); !ok {
+		log.Fatalf("unsupported display locale %q", displayLocale)
+	}
+
+	if fraudCheck {
+		registerTransactionHook(newFraudHook())
+	}
+	transferLimiter = newUserLimiter(userRatePerMinute, userRateBurst)
+	senderSlots = newAccountLimiter(maxInFlightPerAccount)
+	limits, err := parseCurrencyLimits(currencyLimits, poolMaxWorkers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if limits != nil {
+		currencySlots = newCurrencyLimiter(limits)
+	}
 
-	srv := &http.Server{
-		Handler: r,
-		Addr:    "127.0.0.1:8000",
-		// Good practice: enforce timeouts for servers you create!
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+	if err := loadBlocklist(blocklistFile); err != nil {
+		log.Fatal(err)
 	}
 
-	// Note: x=2 used here. Running 2 worker go routines per time
-	go processVerificationQueue(2, verifyUser)
-	go processTransactionQueue(2, processTransaction)
-	log.Fatal(srv.ListenAndServe())
+	r := newRouter(apiPrefix, serveUnprefixed)
+
+	srv := newServer("127.0.0.1:8000", r)
+
+	if err := startupSelfTest(); err != nil {
+		log.Fatalf("self-test: %v", err)
+	}
+	// Workers are running before the state is loaded, since restoring it
+	// requeues whatever was still queued
+	for _, job := range workers() {
+		go job.run()
+	}
+	if stateFile != "" {
+		if err := loadState(stateFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	ensureReserves()
+	for _, job := range backgroundJobs() {
+		go job.run()
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	waitForShutdown(srv)
+	finishShutdown()
+}
+
+// backgroundJob is a loop main starts in its own goroutine.
+type backgroundJob struct {
+	name string
+	run  func()
+}
+
+// workers drain the verification and transaction queues. Read-only mode
+// changes nothing, so it runs none.
+func workers() []backgroundJob {
+	if readOnly {
+		return nil
+	}
+	// Note: x=2 used here. Running 2 verification go routines per time
+	verify := verifyUser
+	if verificationSecret != "" {
+		verify = awaitVerificationCallback
+	}
+	jobs := []backgroundJob{{"verification workers", func() { processVerificationQueue(2, verify) }}}
+	if orderBySender {
+		d := newPartitionedDispatcher(transactionQueue, handleTransaction, senderPartitions)
+		return append(jobs, backgroundJob{"transaction dispatcher", d.run})
+	}
+	transactionPool = newWorkerPool(transactionQueue, processQueuedTransaction,
+		poolMinWorkers, poolMaxWorkers, poolScaleThreshold, poolScaleCooldown)
+	return append(jobs, backgroundJob{"transaction workers", func() { transactionPool.run(time.Second) }})
+}
+
+// backgroundJobs are the periodic jobs enabled by the flags. Each one
+// changes the store, so read-only mode runs none of them either.
+func backgroundJobs() []backgroundJob {
+	if readOnly {
+		return nil
+	}
+	var jobs []backgroundJob
+	if durability == durabilityAsync || durability == durabilitySync {
+		jobs = append(jobs, backgroundJob{"state flusher", func() { runStateFlusher(flushInterval) }})
+	}
+	if settlementWindow > 0 {
+		jobs = append(jobs, backgroundJob{"settlement sweeper", func() { runSettlementSweeper(time.Second) }})
+	}
+	if roundingInterval > 0 {
+		jobs = append(jobs, backgroundJob{"rounding job", func() { runRoundingJob(roundingInterval) }})
+	}
+	return append(jobs, backgroundJob{"acceptance sweeper", func() { runAcceptanceSweeper(holdSweepInterval()) }})
 }
 
 type User struct {
-	ID       int     `json:"id"`
+	ID       ID      `json:"id"`
 	Balance  float64 `json:"balance"`
 	Verified bool    `json:"verified"`
+	Currency string  `json:"currency"`
+	System   bool    `json:"system,omitempty"`
+	// VerificationRejected is set by a provider's rejected callback. The
+	// user can't send until a later callback approves them.
+	VerificationRejected bool `json:"verification_rejected,omitempty"`
+	// DisplayName is shown to counterparties; it is set at creation.
+	DisplayName string `json:"display_name,omitempty"`
+	// CreatedAt is unset for reserves and for users restored from state
+	// saved before it was recorded.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// Unsettled is the part of Balance received but not yet spendable.
+	Unsettled float64 `json:"unsettled,omitempty"`
+	// Held is the part of Balance reserved for transfers awaiting the
+	// receiver's acceptance.
+	Held                float64  `json:"held,omitempty"`
+	LowBalanceThreshold *float64 `json:"low_balance_threshold,omitempty"`
+	// NotificationPreferences maps notification event types to whether
+	// the user wants them; a missing type means yes.
+	NotificationPreferences map[string]bool `json:"notification_preferences,omitempty"`
+	// Frozen accounts can't send or receive until an admin unfreezes them.
+	Frozen bool `json:"frozen,omitempty"`
+	// Closed accounts were merged into MergedInto and can't transact.
+	Closed     bool `json:"closed,omitempty"`
+	MergedInto ID   `json:"merged_into,omitempty"`
+
+	lowBalanceAlerted bool
 }
 
 type Transaction struct {
-	SenderID   int     `json:"sender_id" binding:"required"`
-	ReceiverID int     `json:"receiver_id" binding:"required"`
+	ID         ID      `json:"id"`
+	SenderID   ID      `json:"sender_id" binding:"required"`
+	ReceiverID ID      `json:"receiver_id,omitempty" binding:"required"`
 	Amount     float64 `json:"amount" binding:"required"`
+	Currency   string  `json:"currency"`
+	// Fee is charged to the sender on top of Amount and booked to the
+	// currency's reserve; see transferFee.
+	Fee float64 `json:"fee,omitempty"`
+	// A transfer to an account in another currency is converted: the
+	// receiver is credited ConvertedAmount of ConvertedCurrency at FXRate,
+	// rounded down, and FXResidual is the part rounded off.
+	ConvertedAmount   float64 `json:"converted_amount,omitempty"`
+	ConvertedCurrency string  `json:"converted_currency,omitempty"`
+	FXRate            string  `json:"fx_rate,omitempty"`
+	FXResidual        float64 `json:"fx_residual,omitempty"`
+	Category          string  `json:"category,omitempty"`
+	Status            string  `json:"status"`
+	Reason            string  `json:"reason,omitempty"`
+	Attempts          int     `json:"attempts"`
+	// Settlement is "settling" until the receiver may spend the credit at
+	// SettlesAt, then "settled". Empty when settlement is disabled.
+	Settlement string     `json:"settlement,omitempty"`
+	SettlesAt  *time.Time `json:"settles_at,omitempty"`
+	// RequireAcceptance holds the sender's funds until the receiver accepts
+	// or rejects the transfer, or AcceptBy passes.
+	RequireAcceptance bool       `json:"require_acceptance,omitempty"`
+	AcceptBy          *time.Time `json:"accept_by,omitempty"`
+	// RetryOf links an admin retry to the failed original, which points
+	// back with RetriedBy.
+	RetryOf   ID `json:"retry_of,omitempty"`
+	RetriedBy ID `json:"retried_by,omitempty"`
+	// ReviewNote says why a hook flagged the transfer for review, and
+	// ReviewedBy is the admin who then approved or rejected it.
+	ReviewNote string `json:"review_note,omitempty"`
+	ReviewedBy string `json:"reviewed_by,omitempty"`
+	// ReviewContext is gathered for the reviewer once the transfer is
+	// held; see enrichReview.
+	ReviewContext *ReviewContext `json:"review_context,omitempty"`
+	// Legs makes this the parent of a split transfer; each leg is paid by
+	// a child transaction that points back with SplitOf.
+	Legs    []SplitLeg `json:"legs,omitempty"`
+	SplitOf ID         `json:"split_of,omitempty"`
+	// Signature is an upstream service's HMAC of the transfer; it is
+	// checked on submission and not stored. SignedAt (Unix seconds) and
+	// Nonce are signed with it so a captured request can't be replayed.
+	Signature string `json:"signature,omitempty"`
+	SignedAt  int64  `json:"signed_at,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+	// Metadata is free-form client data, e.g. order_id, returned as-is.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Optional conditions checked against the sender's balance at
+	// processing time. MinBalanceBefore requires the current balance to be
+	// at least the value, MinBalanceAfter that the balance left after the
+	// transfer is.
+	MinBalanceBefore *float64 `json:"min_balance_before,omitempty"`
+	MinBalanceAfter  *float64 `json:"min_balance_after,omitempty"`
+	// Timestamps are always UTC. CompletedAt is set once the transaction
+	// reaches a terminal status.
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
 }
 
 func GetUser(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	json.NewEncoder(w).Encode(db)
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	opts, err := parseResponseOptions(r, userFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	mu.RLock()
+	users := make([]User, 0, len(db))
+	for _, u := range db {
+		users = append(users, u)
+	}
+	mu.RUnlock()
+	sort.Slice(users, func(i, j int) bool { return users[i].ID.less(users[j].ID) })
+	start, end, p := paginate(len(users), limit, offset)
+
+	writeResponse(w, opts, Envelope{Data: users[start:end], Pagination: p})
+}
+
+func GetUserByID(w http.ResponseWriter, r *http.Request) {
+	id := ID(mux.Vars(r)["id"])
+	opts, err := parseResponseOptions(r, userFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	user, ok := getUser(id)
+	if !ok {
+		writeError(w, 404, CodeUserNotFound, "User not found")
+		return
+	}
+	writeResponse(w, opts, user)
 }
 
 func CreateUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Accept", "application/json")
-	w.WriteHeader(200)
+	opts, err := parseResponseOptions(r, userFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
 	var user User
-	err := json.NewDecoder(r.Body).Decode(&user)
+	err = json.NewDecoder(r.Body).Decode(&user)
 	if err != nil {
-		http.Error(w, "Bad request", 400)
+		writeError(w, 400, CodeBadRequest, "Bad request")
 		return
 	}
 	fmt.Println("User: ", user)
+	if user.Currency == "" {
+		user.Currency = defaultCurrency
+	}
+	if !knownCurrency(user.Currency) {
+		writeError(w, 400, CodeUnknownCurrency, "Unknown currency")
+		return
+	}
+	user.DisplayName = strings.TrimSpace(user.DisplayName)
+	if len(user.DisplayName) > maxDisplayNameLen {
+		writeError(w, 400, CodeBadRequest, "display_name is too long")
+		return
+	}
 	user, err = addUser(user)
 	if err != nil {
-		http.Error(w, "Error occured. Try again later", 500)
+		writeError(w, 500, CodeInternal, "Error occured. Try again later")
 		return
 	}
+	mu.RLock()
 	fmt.Println("DB: ", db)
-	addToVerificationQueue(user)
-	err = json.NewEncoder(w).Encode(user)
-	if err != nil {
-		http.Error(w, "Error occured. Try again later", 500)
-		return
+	mu.RUnlock()
+	if verificationEnabled {
+		addToVerificationQueue(user)
 	}
+	writeResponse(w, opts, user)
+}
+
+func getUser(id ID) (User, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	user, ok := db[id]
+	return user, ok
 }
 
 func addUser(user User) (User, error) {
-	id := len(db) + 1
+	mu.Lock()
+	defer mu.Unlock()
+	id := userIDs.NewID()
 	user.ID = id
+	user.System = false
+	user.Unsettled = 0
+	user.Closed = false
+	user.VerificationRejected = false
+	user.Frozen = false
+	user.MergedInto = ""
+	user.NotificationPreferences = nil
 	user.Balance = float64(1000)
-	db[id] = user
+	now := time.Now().UTC()
+	user.CreatedAt = &now
+	user.Verified = !verificationEnabled
+	recordEvent(Event{Type: eventUserCreated, UserID: id, User: &user})
 	return user, nil
 }
 
+// addToVerificationQueue skips users that are already verified or already
+// queued or being verified, so each user is only verified once even when
+// several of their transfers bounce. Transaction workers call it, so it
+// never blocks on a full queue; the send finishes in the background.
 func addToVerificationQueue(user User) error {
-	verificationQueue <- user
+	if current, ok := getUser(user.ID); ok && (current.Verified || current.VerificationRejected) {
+		return nil
+	}
+	verifyingMu.Lock()
+	if verifying[user.ID] {
+		verifyingMu.Unlock()
+		return nil
+	}
+	verifying[user.ID] = true
+	verifyingMu.Unlock()
+
+	verificationClock.push(time.Now())
+	select {
+	case verificationQueue <- user:
+	default:
+		go func() { verificationQueue <- user }()
+	}
 	return nil
 }
 
+func doneVerifying(id ID) {
+	verifyingMu.Lock()
+	defer verifyingMu.Unlock()
+	delete(verifying, id)
+}
+
+// verifyUser only flips Verified on the stored user. The queued copy may be
+// stale, and writing it back would undo any balance change made since.
 func verifyUser(user User) error {
-	user.Verified = true
-	db[user.ID] = user
+	mu.Lock()
+	defer mu.Unlock()
+	current, ok := db[user.ID]
+	if !ok {
+		return newError(CodeUserNotFound, "User not found")
+	}
+	if !current.Verified && !current.VerificationRejected {
+		recordEvent(Event{Type: eventVerified, UserID: user.ID})
+		notifyUser(db[user.ID], eventVerificationDone, "your account is verified")
+		releaseAwaiting(user.ID, true)
+	}
 	return nil
 }
 
@@ -118,64 +500,194 @@ func processVerificationQueue(x int, f func(User) error) {
 			if len(verificationQueue) > 0 { // Added check to avoid spinning too many idle goroutines
 				for i := 0; i < x; i++ {
 					fmt.Println("new goroutine")
-					go f(<-verificationQueue)
+					user := <-verificationQueue
+					verificationClock.pop()
+					go func(user User) {
+						f(user)
+						doneVerifying(user.ID)
+					}(user)
 				}
 			}
 		}
 	}
 }
 
-func processTransactionQueue(x int, f func(Transaction) error) {
-	// Every 30 seconds
-	ticker := time.NewTicker(10 * time.Second)
-	done := make(chan bool)
+// processQueuedTransaction is the pool's worker func. Currency limits only
+// apply here: with -order-by-sender, running a parked transfer on another
+// partition's worker would break the sender's ordering.
+func processQueuedTransaction(worker string, t Transaction) error {
+	transactionClock.pop()
+	if !currencySlots.admit(t) {
+		return nil
+	}
 	for {
-		select {
-		case <-done:
-			return
-		case <-ticker.C:
-			if len(transactionQueue) > 0 { // Added check to avoid spinning too many idle goroutines
-				for i := 0; i < x; i++ {
-					go f(<-transactionQueue)
-				}
-			}
+		err := handleTransaction(worker, t)
+		next, ok := currencySlots.done(t.Currency)
+		if !ok {
+			return err
 		}
+		t = next
 	}
 }
 
-func processTransaction(t Transaction) error {
-	user, ok := db[t.SenderID]
+func processTransaction(t Transaction) (err error) {
+	ctx := context.Background()
+	defer func() { runAfterHooks(ctx, t.ID, err) }()
+
+	if err := rejectMalformed(t); err != nil {
+		return err
+	}
+	if isBlocked(t.SenderID) || isBlocked(t.ReceiverID) {
+		return failTransaction(t, newError(CodeBlockedAccount, "Sender or receiver is blocked"))
+	}
+	for _, leg := range t.Legs {
+		if isBlocked(leg.ReceiverID) {
+			return failTransaction(t, newError(CodeBlockedAccount, "A split receiver is blocked"))
+		}
+	}
+	user, ok := getUser(t.SenderID)
 	if !ok {
-		return errors.New("user not found")
+		return failTransaction(t, newError(CodeUserNotFound, "Sender not found"))
 	}
-	if !user.Verified {
-		verificationQueue <- user
-		transactionQueue <- t
-		return nil
+	// Senders awaiting verification were parked by handleTransaction
+	if verificationEnabled && (user.VerificationRejected || !user.Verified) {
+		return failTransaction(t, newError(CodeSenderUnverified, "Sender failed verification"))
+	}
+	t, apiErr := quoteConversion(t)
+	if apiErr != nil {
+		return failTransaction(t, apiErr)
+	}
+	if err := runBeforeHooks(ctx, &t); err != nil {
+		if review, ok := err.(*ReviewRequired); ok {
+			holdForReview(t, review)
+			return nil
+		}
+		return failTransaction(t, err)
 	}
 
 	mu.Lock()
 	defer mu.Unlock()
-	if user.Balance >= t.Amount {
-		user.Balance -= t.Amount
-		db[user.ID] = user
-
-		rec := db[t.ReceiverID]
-		rec.Balance += t.Amount
-		db[rec.ID] = rec
+	if t.isSplit() {
+		return processSplit(t)
+	}
+	if err := checkTransfer(db, t); err != nil {
+		return failTransaction(t, err)
+	}
+	if t.RequireAcceptance {
+		holdForAcceptance(t)
+		return nil
+	}
+	if err := commitTransfer(t); err != nil {
+		return err
 	}
+	return nil
+}
 
+// commitTransfer moves the funds for an already checked transfer and
+// completes it, or fails it if the move didn't conserve money and was
+// rolled back. It must be called with mu held.
+func commitTransfer(t Transaction) *APIError {
+	check := beginConservationCheck(t)
+	if t.ConvertedCurrency != "" {
+		recordEvent(conversionEvent(t))
+	} else {
+		recordEvent(transferEvent(t))
+	}
+	if err := check.verify(); err != nil {
+		failTransaction(t, err)
+		return err
+	}
+	startSettlement(t)
+	db[t.SenderID] = checkLowBalance(db[t.SenderID])
+	db[t.ReceiverID] = checkLowBalance(db[t.ReceiverID])
+	if t.ReceiverID != t.SenderID {
+		currency := t.Currency
+		if t.ConvertedCurrency != "" {
+			currency = t.ConvertedCurrency
+		}
+		notifyUser(db[t.ReceiverID], eventTransferReceived, fmt.Sprintf("received %g %s from %s", t.credited(), currency, t.SenderID))
+	}
+	completeTransaction(t)
 	return nil
 }
 
 func Transfer(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseResponseOptions(r, transactionFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
 	var t Transaction
-	err := json.NewDecoder(r.Body).Decode(&t)
+	err = json.NewDecoder(r.Body).Decode(&t)
 	if err != nil {
-		http.Error(w, "Bad request", 400)
+		writeError(w, 400, CodeBadRequest, "Bad request")
+		return
+	}
+	if err := checkSignature(t); err != nil {
+		writeAPIError(w, 401, err)
+		return
+	}
+	t.Signature, t.SignedAt, t.Nonce = "", 0, ""
+	// Splits are only accepted from /transaction/split, which checks legs
+	t.Legs = nil
+	if !(t.Amount > 0) || math.IsInf(t.Amount, 0) {
+		writeError(w, 400, CodeInvalidAmount, "Amount must be a positive number")
+		return
+	}
+	if t.Currency == "" {
+		if sender, ok := getUser(t.SenderID); ok {
+			t.Currency = sender.Currency
+		} else {
+			t.Currency = defaultCurrency
+		}
+	}
+	if err := checkPrecision(t.Amount, t.Currency); err != nil {
+		writeAPIError(w, 400, err)
 		return
 	}
+	t.Fee = transferFee(t.Amount, t.Currency)
+	if err := checkMetadata(t.Metadata); err != nil {
+		writeAPIError(w, 400, err)
+		return
+	}
+	if t.Category != "" && !categories[t.Category] {
+		writeError(w, 400, CodeInvalidCategory, "Unknown category")
+		return
+	}
+
+	if isShuttingDown() {
+		writeError(w, 503, CodeShuttingDown, "Server is shutting down. Try again later")
+		return
+	}
+	if retryAfter, shed := shedLoad(time.Now()); shed {
+		w.Header().Set("Retry-After", retryAfter)
+		writeError(w, 503, CodeOverloaded, "Transaction queue is backed up. Try again later")
+		return
+	}
+	// Clients can resubmit a deliberate repeat with X-Allow-Duplicate: true
+	if r.Header.Get("X-Allow-Duplicate") != "true" && isDuplicateTransfer(t, time.Now()) {
+		writeError(w, 409, CodePossibleDuplicate, "An identical transfer was just submitted; set X-Allow-Duplicate: true to send it anyway")
+		return
+	}
+	if !transferLimiter.allow(t.SenderID, time.Now()) {
+		writeError(w, 429, CodeUserRateLimited, "Too many transfers from this user. Try again later")
+		return
+	}
+	if needsConfirmation(t) {
+		requestConfirmation(w, t)
+		return
+	}
+	enqueueTransfer(w, opts, t)
+}
 
-	transactionQueue <- t
-	w.Write([]byte("Transaction is being processed"))
+// enqueueTransfer only answers once t meets the durability guarantee; in
+// sync mode it is saved before it is queued.
+func enqueueTransfer(w http.ResponseWriter, opts responseOptions, t Transaction) {
+	t = addTransaction(t)
+	if err := persistAccepted(t); err != nil {
+		writeAPIError(w, 503, err)
+		return
+	}
+	seq := enqueueTransaction(t)
+	writeResponse(w, opts, queuedTransaction(t, seq, time.Now()))
 }
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetStore gives a test an empty store, fresh queues and the default
+// configuration, with the reserves created as on startup.
+func resetStore(t *testing.T) {
+	t.Helper()
+	mu.Lock()
+	db = make(map[ID]User)
+	events = nil
+	systemAccounts = make(map[string]ID)
+	mu.Unlock()
+	txMu.Lock()
+	transactions = make(map[ID]Transaction)
+	transactionOrder = nil
+	waiters = make(map[ID][]chan struct{})
+	txMu.Unlock()
+	blocklistMu.Lock()
+	blocklist = make(map[ID]bool)
+	blocklistMu.Unlock()
+	verifyingMu.Lock()
+	verifying = make(map[ID]bool)
+	verifyingMu.Unlock()
+	awaitingMu.Lock()
+	awaitingVerification = make(map[ID][]Transaction)
+	awaitingMu.Unlock()
+	failuresMu.Lock()
+	failures = nil
+	failuresMu.Unlock()
+	auditMu.Lock()
+	adminAudit = nil
+	auditMu.Unlock()
+	adjustmentsMu.Lock()
+	adjustments = nil
+	adjustmentsMu.Unlock()
+	hooksMu.Lock()
+	transactionHooks = nil
+	hooksMu.Unlock()
+	panickedMu.Lock()
+	panicked = make(map[ID]bool)
+	panickedMu.Unlock()
+	processedMu.Lock()
+	recentProcessed = nil
+	processedMu.Unlock()
+
+	transactionQueue = make(chan Transaction, 1000)
+	verificationQueue = make(chan User, 1000)
+	transactionClock = &queueClock{}
+	verificationClock = &queueClock{}
+	transactionThroughput = &throughputMeter{}
+	userIDs = &sequentialIDs{}
+	transactionIDs = &sequentialIDs{}
+	recentTransfers = newTTLStore(time.Minute)
+	pendingConfirmations = newTTLStore(time.Minute)
+	usedNonces = newTTLStore(time.Minute)
+
+	blocklistFile = ""
+	stateFile = ""
+	auditFile = ""
+	pushgatewayURL = ""
+	adminKey = "test-key"
+	adminKeys = nil
+	verificationEnabled = true
+	verificationSecret = ""
+	signingSecret, requireSignature = "", false
+	signatureSkew = 5 * time.Minute
+	requireVerifiedReceiver = false
+	duplicateWindow = 0
+	maxPageLimit = 1000
+	userRatePerMinute, userRateBurst = 30, 10
+	confirmationThreshold = 0
+	settlementWindow = 0
+	roundingInterval = 0
+	transactionPool = nil
+	transferFeePercent = 0
+	maxInFlightPerAccount = 1
+	currencySlots = nil
+	checkInvariants, rollbackOnViolation = false, false
+	rateProvider = nil
+	readOnly = false
+	notifier = logNotifier{}
+	lowBalanceThreshold = 0
+	debugEnvelopes = false
+	durability = durabilityShutdown
+	selfTest, selfTestFailure = true, selfTestExit
+	maxQueueWait = 0
+	maxQueueAge = time.Minute
+	atomic.StoreInt32(&shuttingDown, 0)
+
+	transferLimiter = newUserLimiter(userRatePerMinute, userRateBurst)
+	senderSlots = newAccountLimiter(maxInFlightPerAccount)
+	ensureReserves()
+}
+
+// newUser creates a user holding the starting balance, verified unless
+// verified is false.
+func newUser(t *testing.T, verified bool) User {
+	t.Helper()
+	u, err := addUser(User{Currency: defaultCurrency})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified && !u.Verified {
+		if err := verifyUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, _ = getUser(u.ID)
+	return u
+}
+
+// drainQueue runs everything on transactionQueue the way a worker would,
+// including anything requeued meanwhile, and returns once it is empty.
+func drainQueue(t *testing.T) {
+	t.Helper()
+	for {
+		select {
+		case tx := <-transactionQueue:
+			processQueuedTransaction("test", tx)
+		default:
+			return
+		}
+	}
+}
+
+// transfer queues a transfer as the Transfer handler would and processes
+// it, returning the stored result.
+func transfer(t *testing.T, tx Transaction) Transaction {
+	t.Helper()
+	if tx.Currency == "" {
+		tx.Currency = defaultCurrency
+	}
+	tx = addTransaction(tx)
+	enqueueTransaction(tx)
+	drainQueue(t)
+	stored, _ := getTransaction(tx.ID)
+	return stored
+}
+
+func balance(t *testing.T, id ID) float64 {
+	t.Helper()
+	u, ok := getUser(id)
+	if !ok {
+		t.Fatalf("user %s not found", id)
+	}
+	return u.Balance
+}
+
+// serve sends a request through the full router. A non-nil body is sent
+// as JSON, and admin requests carry the test admin key.
+func serve(t *testing.T, method, path string, body interface{}, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if s, ok := body.(string); ok {
+			buf.WriteString(s)
+		} else if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, path, &buf)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Admin-Key", adminKey)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	newRouter(apiPrefix, serveUnprefixed).ServeHTTP(w, r)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+func wantStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+}
+
+// startWorkers runs n pool workers on transactionQueue until the test
+// ends, then waits for any transaction they are still running.
+func startWorkers(t *testing.T, n int) *workerPool {
+	t.Helper()
+	var running sync.WaitGroup
+	p := newWorkerPool(transactionQueue, func(worker string, tx Transaction) error {
+		running.Add(1)
+		defer running.Done()
+		return processQueuedTransaction(worker, tx)
+	}, n, n, poolScaleThreshold, time.Hour)
+	p.mu.Lock()
+	for len(p.stops) < n {
+		p.spawn()
+	}
+	p.mu.Unlock()
+	t.Cleanup(func() {
+		p.mu.Lock()
+		for len(p.stops) > 0 {
+			p.retire()
+		}
+		p.mu.Unlock()
+		running.Wait()
+	})
+	return p
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func hasStatus(id ID, status string) func() bool {
+	return func() bool {
+		t, _ := getTransaction(id)
+		return t.Status == status
+	}
+}
+
+// gateHook holds every transfer from sender in BeforeProcess until open is
+// closed, tracking how many it holds at once.
+type gateHook struct {
+	sender  ID
+	open    chan struct{}
+	mu      sync.Mutex
+	holding int
+	most    int
+}
+
+func (h *gateHook) BeforeProcess(ctx context.Context, t *Transaction) error {
+	if t.SenderID != h.sender {
+		return nil
+	}
+	h.mu.Lock()
+	h.holding++
+	if h.holding > h.most {
+		h.most = h.holding
+	}
+	h.mu.Unlock()
+	<-h.open
+	h.mu.Lock()
+	h.holding--
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *gateHook) AfterProcess(ctx context.Context, t Transaction, result error) {}
+
+func (h *gateHook) held() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.holding
+}
+
+// panicHook panics in BeforeProcess for the first times transfers it sees.
+type panicHook struct {
+	times int32
+}
+
+func (h *panicHook) BeforeProcess(ctx context.Context, t *Transaction) error {
+	if atomic.AddInt32(&h.times, -1) >= 0 {
+		panic("test panic")
+	}
+	return nil
+}
+
+func (h *panicHook) AfterProcess(ctx context.Context, t Transaction, result error) {}
+
+// fakeClock is a settable time source for the TTL stores.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// newClockedStore returns a ttlStore on clock with no janitor running.
+func newClockedStore(clock *fakeClock) *ttlStore {
+	return &ttlStore{items: make(map[string]ttlItem), now: clock.now, done: make(chan struct{})}
+}
+
+// recordingNotifier keeps every notification it is sent.
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (n *recordingNotifier) Notify(userID ID, event, message string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, string(userID)+" "+event)
+	return nil
+}
+
+// count returns how many event notifications userID has been sent.
+func (n *recordingNotifier) count(userID ID, event string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	c := 0
+	for _, s := range n.sent {
+		if s == string(userID)+" "+event {
+			c++
+		}
+	}
+	return c
+}
+
+// settled waits for notifications still being sent in the background.
+func (n *recordingNotifier) settled(t *testing.T) {
+	t.Helper()
+	waitFor(t, "notifications to be sent", func() bool { return atomic.LoadInt64(&pendingNotifications) == 0 })
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"math"
+)
+
+// validateQueued re-checks what the HTTP layer should already have
+// enforced, so a transaction that reached the queue some other way, e.g.
+// from an edited state file, is never applied with impossible data.
+func validateQueued(t Transaction) *APIError {
+	malformed := func(msg string) *APIError {
+		return newError(CodeMalformedTransaction, msg)
+	}
+	positive := func(a float64) bool {
+		return a > 0 && !math.IsInf(a, 0)
+	}
+	if t.SenderID == "" {
+		return malformed("Missing sender_id")
+	}
+	if !positive(t.Amount) {
+		return malformed("Amount is not a positive number")
+	}
+	if !knownCurrency(t.Currency) {
+		return malformed("Unknown currency")
+	}
+	if !t.isSplit() {
+		if t.ReceiverID == "" {
+			return malformed("Missing receiver_id")
+		}
+		return nil
+	}
+	total := 0.0
+	for _, leg := range t.Legs {
+		if leg.ReceiverID == "" || !positive(leg.Amount) {
+			return malformed("Split leg is missing a receiver or amount")
+		}
+		total += leg.Amount
+	}
+	if math.Abs(total-t.Amount) > 1e-9*math.Max(1, t.Amount) {
+		return malformed("Split legs don't add up to the amount")
+	}
+	return nil
+}
+
+// rejectMalformed marks t failed if it is malformed. One without an ID
+// can't be recorded anywhere, so it is only logged and dropped.
+func rejectMalformed(t Transaction) error {
+	err := validateQueued(t)
+	if err == nil {
+		return nil
+	}
+	if t.ID == "" {
+		log.Printf("dropping malformed queue item: %s: %+v", err.Message, t)
+		return err
+	}
+	return failTransaction(t, err)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMalformedQueueItems(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	seq := len(events)
+
+	var ids []ID
+	for _, tx := range []Transaction{
+		{ReceiverID: receiver.ID, Amount: 10, Currency: defaultCurrency},
+		{SenderID: sender.ID, Amount: 10, Currency: defaultCurrency},
+		{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: math.NaN(), Currency: defaultCurrency},
+		{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: math.Inf(1), Currency: defaultCurrency},
+		{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: -10, Currency: defaultCurrency},
+		{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10, Currency: "XYZ"},
+		{SenderID: sender.ID, Amount: 30, Currency: defaultCurrency, Legs: []SplitLeg{{ReceiverID: receiver.ID, Amount: 10}}},
+		{SenderID: sender.ID, Amount: 10, Currency: defaultCurrency, Legs: []SplitLeg{{Amount: 10}}},
+	} {
+		tx = addTransaction(tx)
+		ids = append(ids, tx.ID)
+		enqueueTransaction(tx)
+	}
+	// one with no ID can't be marked anything, only dropped
+	enqueueTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Currency: defaultCurrency})
+	drainQueue(t)
+
+	for i, id := range ids {
+		got, _ := getTransaction(id)
+		if got.Status != statusFailed || got.Reason != string(CodeMalformedTransaction) {
+			t.Errorf("malformed item %d: status %s reason %q", i, got.Status, got.Reason)
+		}
+	}
+	if len(events) != seq {
+		t.Errorf("malformed items recorded %d events", len(events)-seq)
+	}
+	if balance(t, sender.ID) != 1000 || balance(t, receiver.ID) != 1000 {
+		t.Errorf("balances %v and %v, want 1000 each", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+	unknown := transfer(t, Transaction{SenderID: "999", ReceiverID: receiver.ID, Amount: 10})
+	if unknown.Status != statusFailed || unknown.Reason != string(CodeUserNotFound) {
+		t.Errorf("transfer from an unknown sender: status %s reason %q", unknown.Status, unknown.Reason)
+	}
+	// the failed items don't stop the saved state passing the self-test
+	if problems := checkLedger(snapshotState()); len(problems) > 0 {
+		t.Errorf("self-test problems: %v", problems)
+	}
+
+	if got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10}); got.Status != statusCompleted {
+		t.Errorf("valid transfer after the malformed ones: status %s reason %q", got.Status, got.Reason)
+	}
+}
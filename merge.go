@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type MergeRequest struct {
+	SourceID ID `json:"source_id"`
+	TargetID ID `json:"target_id"`
+}
+
+// mergeUsers moves everything the source holds to the target in a single
+// merged event and closes the source, so total money is unchanged.
+// It returns both accounts as they were before the merge and the target after.
+func mergeUsers(sourceID, targetID ID) (before []User, after User, err *APIError) {
+	if sourceID == targetID {
+		return nil, User{}, newError(CodeBadRequest, "Can't merge an account into itself")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	source, ok := db[sourceID]
+	if !ok {
+		return nil, User{}, newError(CodeUserNotFound, "Source user not found")
+	}
+	target, ok := db[targetID]
+	if !ok {
+		return nil, User{}, newError(CodeUserNotFound, "Target user not found")
+	}
+	if source.System || target.System {
+		return nil, User{}, newError(CodeSystemAccount, "Reserve accounts can't be merged")
+	}
+	if source.Closed || target.Closed {
+		return nil, User{}, newError(CodeAccountClosed, "Account is closed")
+	}
+	if source.Frozen || target.Frozen {
+		return nil, User{}, newError(CodeAccountFrozen, "Frozen accounts can't be merged")
+	}
+	if source.Held > 0 {
+		return nil, User{}, newError(CodeFundsHeld, "Source has funds held for transfers awaiting acceptance")
+	}
+	if source.Currency != target.Currency {
+		return nil, User{}, newError(CodeCurrencyMismatch, "Accounts hold different currencies")
+	}
+	recordEvent(Event{Type: eventMerged, UserID: sourceID, ReceiverID: targetID, Amount: source.Balance})
+	return []User{source, target}, db[targetID], nil
+}
+
+// mergedAccounts returns id and every account merged into it, directly or
+// through earlier merges, so history can be read across all of them.
+func mergedAccounts(id ID) map[ID]bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	ids := map[ID]bool{id: true}
+	for grew := true; grew; {
+		grew = false
+		for _, u := range db {
+			if u.Closed && ids[u.MergedInto] && !ids[u.ID] {
+				ids[u.ID] = true
+				grew = true
+			}
+		}
+	}
+	return ids
+}
+
+func MergeUsers(w http.ResponseWriter, r *http.Request) {
+	var req MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SourceID == "" || req.TargetID == "" {
+		writeError(w, 400, CodeBadRequest, "source_id and target_id are required")
+		return
+	}
+	before, user, err := mergeUsers(req.SourceID, req.TargetID)
+	if err != nil {
+		status := 400
+		if err.Code == CodeUserNotFound {
+			status = 404
+		} else if err.Code == CodeAccountClosed || err.Code == CodeAccountFrozen || err.Code == CodeFundsHeld {
+			status = 409
+		}
+		writeAPIError(w, status, err)
+		return
+	}
+	recordAudit(r, "users.merge", string(req.SourceID)+","+string(req.TargetID), before, user)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeUsers(t *testing.T) {
+	resetStore(t)
+	source, target, other := newUser(t, true), newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: source.ID, ReceiverID: other.ID, Amount: 100})
+	transfer(t, Transaction{SenderID: other.ID, ReceiverID: target.ID, Amount: 50})
+
+	if _, _, err := mergeUsers(source.ID, source.ID); err == nil {
+		t.Error("self-merge was allowed")
+	}
+	w := serve(t, "POST", "/admin/users/merge", MergeRequest{SourceID: source.ID, TargetID: target.ID})
+	wantStatus(t, w, 200)
+	var merged User
+	decode(t, w, &merged)
+	if merged.Balance != 900+1050 {
+		t.Errorf("target balance %v, want %v", merged.Balance, 900+1050)
+	}
+	closed, _ := getUser(source.ID)
+	if !closed.Closed || closed.MergedInto != target.ID || closed.Balance != 0 {
+		t.Errorf("source after merge: %+v", closed)
+	}
+
+	var page struct{ Data []Transaction }
+	decode(t, serve(t, "GET", "/transactions?user_id="+string(target.ID), nil), &page)
+	if len(page.Data) != 2 {
+		t.Errorf("target history has %d transactions, want both accounts' 2", len(page.Data))
+	}
+}
+
+func TestMergeRejectsOtherCurrency(t *testing.T) {
+	resetStore(t)
+	source := newUser(t, true)
+	target, _ := addUser(User{Currency: "EUR"})
+	if _, _, err := mergeUsers(source.ID, target.ID); err == nil || err.Code != CodeCurrencyMismatch {
+		t.Errorf("cross-currency merge: %v", err)
+	}
+}
+
+// Credits still settling when their receiver is merged away settle in the
+// account they moved to.
+func TestMergeThenSettle(t *testing.T) {
+	resetStore(t)
+	settlementWindow = time.Hour
+	sender, source, target := newUser(t, true), newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: source.ID, Amount: 40})
+	if _, _, err := mergeUsers(source.ID, target.ID); err != nil {
+		t.Fatal(err)
+	}
+	merged, _ := getUser(target.ID)
+	if merged.Unsettled != 40 {
+		t.Fatalf("target unsettled %v after merge, want 40", merged.Unsettled)
+	}
+
+	if n := settleDue(time.Now().Add(2 * time.Hour)); n != 1 {
+		t.Fatalf("settled %d, want 1", n)
+	}
+	merged, _ = getUser(target.ID)
+	closed, _ := getUser(source.ID)
+	if merged.Unsettled != 0 || closed.Unsettled != 0 {
+		t.Errorf("unsettled after settling: target %v, source %v", merged.Unsettled, closed.Unsettled)
+	}
+	if merged.available() != merged.Balance {
+		t.Errorf("target can spend %v of %v", merged.available(), merged.Balance)
+	}
+	if problems := checkLedger(snapshotState()); len(problems) > 0 {
+		t.Errorf("self-test problems: %v", problems)
+	}
+}
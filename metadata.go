@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+const maxMetadataKeys = 20
+const maxMetadataKeyLen = 40
+const maxMetadataValueLen = 500
+
+func checkMetadata(meta map[string]string) *APIError {
+	if len(meta) > maxMetadataKeys {
+		return newError(CodeInvalidMetadata, fmt.Sprintf("metadata may have at most %d keys", maxMetadataKeys))
+	}
+	for k, v := range meta {
+		if k == "" || len(k) > maxMetadataKeyLen {
+			return newError(CodeInvalidMetadata, fmt.Sprintf("metadata keys must be 1-%d characters", maxMetadataKeyLen))
+		}
+		if len(v) > maxMetadataValueLen {
+			return newError(CodeInvalidMetadata, fmt.Sprintf("metadata values may be at most %d characters", maxMetadataValueLen))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransactionMetadata(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	send := func(meta map[string]string) *httptest.ResponseRecorder {
+		return serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 1, Metadata: meta})
+	}
+
+	w := send(map[string]string{"order_id": "123", "dept": "ops"})
+	wantStatus(t, w, 200)
+	var tagged Transaction
+	decode(t, w, &tagged)
+	drainQueue(t)
+	var got Transaction
+	decode(t, serve(t, "GET", "/transaction/"+string(tagged.ID), nil), &got)
+	if got.Metadata["order_id"] != "123" || got.Metadata["dept"] != "ops" {
+		t.Errorf("stored metadata %v", got.Metadata)
+	}
+	wantStatus(t, send(map[string]string{"order_id": "456"}), 200)
+	wantStatus(t, send(nil), 200)
+	drainQueue(t)
+
+	var page struct{ Data []Transaction }
+	decode(t, serve(t, "GET", "/transactions?meta.order_id=123", nil), &page)
+	if len(page.Data) != 1 || page.Data[0].ID != tagged.ID {
+		t.Errorf("filter by order_id=123: %+v", page.Data)
+	}
+	decode(t, serve(t, "GET", "/transactions?meta.order_id=123&meta.dept=sales", nil), &page)
+	if len(page.Data) != 0 {
+		t.Errorf("filter on two keys matched %+v", page.Data)
+	}
+
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxMetadataKeys; i++ {
+		tooMany[fmt.Sprint("k", i)] = "v"
+	}
+	for _, meta := range []map[string]string{
+		tooMany,
+		{strings.Repeat("k", maxMetadataKeyLen+1): "v"},
+		{"": "v"},
+		{"k": strings.Repeat("v", maxMetadataValueLen+1)},
+	} {
+		w := send(meta)
+		wantStatus(t, w, 400)
+		var apiErr APIError
+		decode(t, w, &apiErr)
+		if apiErr.Code != CodeInvalidMetadata {
+			t.Errorf("oversized metadata: code %q", apiErr.Code)
+		}
+	}
+}
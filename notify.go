@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+)
+
+// Notification event types. Users receive all of them unless they opt
+// out of one in their NotificationPreferences.
+const (
+	eventLowBalance       = "low_balance"
+	eventVerificationDone = "verification_done"
+	eventTransferReceived = "transfer_received"
+)
+
+var notificationEvents = map[string]bool{
+	eventLowBalance:       true,
+	eventVerificationDone: true,
+	eventTransferReceived: true,
+}
+
+// Notifier delivers user-facing alerts. The default just logs them.
+type Notifier interface {
+	Notify(userID ID, event, message string) error
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(userID ID, event, message string) error {
+	log.Printf("notify user=%s event=%s: %s", userID, event, message)
+	return nil
+}
+
+var notifier Notifier = logNotifier{}
+
+// wantsNotification is true unless u opted out of event.
+func (u User) wantsNotification(event string) bool {
+	enabled, set := u.NotificationPreferences[event]
+	return !set || enabled
+}
+
+// pendingNotifications counts sends still running in the background.
+var pendingNotifications int64
+
+// notifyUser sends in the background, so callers holding mu don't wait on
+// the notifier.
+func notifyUser(u User, event, message string) {
+	if !u.wantsNotification(event) {
+		return
+	}
+	n := notifier
+	atomic.AddInt64(&pendingNotifications, 1)
+	go func() {
+		defer atomic.AddInt64(&pendingNotifications, -1)
+		n.Notify(u.ID, event, message)
+	}()
+}
+
+// notificationPreferences fills in the default for every event type.
+func notificationPreferences(u User) map[string]bool {
+	prefs := make(map[string]bool, len(notificationEvents))
+	for event := range notificationEvents {
+		prefs[event] = u.wantsNotification(event)
+	}
+	return prefs
+}
+
+// lowBalanceThreshold applies to users without their own threshold.
+var lowBalanceThreshold float64
+
+func (u User) threshold() float64 {
+	if u.LowBalanceThreshold != nil {
+		return *u.LowBalanceThreshold
+	}
+	return lowBalanceThreshold
+}
+
+// checkLowBalance fires one alert when u drops below its threshold and
+// re-arms once the balance recovers. Must be called with mu held; the
+// returned user carries the updated alert state and should be stored.
+func checkLowBalance(u User) User {
+	below := u.Balance < u.threshold()
+	if below && !u.lowBalanceAlerted {
+		msg := fmt.Sprintf("balance %.2f is below %.2f", u.Balance, u.threshold())
+		notifyUser(u, eventLowBalance, msg)
+	}
+	u.lowBalanceAlerted = below
+	return u
+}
+
+func SetLowBalanceThreshold(w http.ResponseWriter, r *http.Request) {
+	id := ID(mux.Vars(r)["id"])
+	var body struct {
+		Threshold *float64 `json:"threshold"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, 400, CodeBadRequest, "Bad request")
+		return
+	}
+
+	mu.Lock()
+	user, ok := db[id]
+	if ok {
+		recordEvent(Event{Type: eventThresholdSet, UserID: id, Threshold: body.Threshold})
+		user = checkLowBalance(db[id])
+		db[id] = user
+	}
+	mu.Unlock()
+	if !ok {
+		writeError(w, 404, CodeUserNotFound, "User not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// GetNotificationPreferences lists every notification event type and
+// whether the user receives it.
+func GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := getUser(ID(mux.Vars(r)["id"]))
+	if !ok {
+		writeError(w, 404, CodeUserNotFound, "User not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notificationPreferences(user))
+}
+
+// SetNotificationPreferences opts the user in (true) or out (false) of
+// each event type in the body; types left out keep their setting.
+func SetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	id := ID(mux.Vars(r)["id"])
+	var prefs map[string]bool
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil || len(prefs) == 0 {
+		writeError(w, 400, CodeBadRequest, "Body must map event types to true or false")
+		return
+	}
+	for event := range prefs {
+		if !notificationEvents[event] {
+			writeError(w, 400, CodeBadRequest, fmt.Sprintf("unknown notification event %q", event))
+			return
+		}
+	}
+
+	mu.Lock()
+	user, ok := db[id]
+	if ok {
+		recordEvent(Event{Type: eventNotificationsSet, UserID: id, Preferences: prefs})
+		user = db[id]
+	}
+	mu.Unlock()
+	if !ok {
+		writeError(w, 404, CodeUserNotFound, "User not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notificationPreferences(user))
+}
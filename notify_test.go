@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestLowBalanceAlertFiresOncePerDip(t *testing.T) {
+	resetStore(t)
+	rec := &recordingNotifier{}
+	notifier = rec
+	sender, receiver := newUser(t, true), newUser(t, true)
+	wantStatus(t, serve(t, "PUT", "/user/"+string(sender.ID)+"/threshold", map[string]float64{"threshold": 900}), 200)
+
+	alerts := func(want int, after string) {
+		t.Helper()
+		rec.settled(t)
+		if n := rec.count(sender.ID, eventLowBalance); n != want {
+			t.Errorf("%d low-balance alerts %s, want %d", n, after, want)
+		}
+	}
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 50})
+	alerts(0, "above the threshold")
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 100})
+	alerts(1, "after crossing it")
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	alerts(1, "while staying below")
+
+	transfer(t, Transaction{SenderID: receiver.ID, ReceiverID: sender.ID, Amount: 200})
+	alerts(1, "after recovering")
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 200})
+	alerts(2, "after crossing again")
+	if n := rec.count(receiver.ID, eventLowBalance); n != 0 {
+		t.Errorf("receiver without a threshold got %d alerts", n)
+	}
+}
+
+func TestThresholdForUnknownUser(t *testing.T) {
+	resetStore(t)
+	wantStatus(t, serve(t, "PUT", "/user/42/threshold", map[string]float64{"threshold": 10}), 404)
+}
+
+func TestTransferReceivedOptOut(t *testing.T) {
+	resetStore(t)
+	rec := &recordingNotifier{}
+	notifier = rec
+	sender, optedOut, optedIn := newUser(t, true), newUser(t, true), newUser(t, true)
+
+	w := serve(t, "PUT", "/user/"+string(optedOut.ID)+"/notifications", map[string]bool{eventTransferReceived: false})
+	wantStatus(t, w, 200)
+	var prefs map[string]bool
+	decode(t, w, &prefs)
+	if prefs[eventTransferReceived] || !prefs[eventLowBalance] || !prefs[eventVerificationDone] {
+		t.Errorf("preferences after opting out: %v", prefs)
+	}
+	prefs = nil
+	decode(t, serve(t, "GET", "/user/"+string(optedIn.ID)+"/notifications", nil), &prefs)
+	if len(prefs) != len(notificationEvents) || !prefs[eventTransferReceived] {
+		t.Errorf("default preferences: %v, want every event on", prefs)
+	}
+
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: optedOut.ID, Amount: 10})
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: optedIn.ID, Amount: 10})
+	rec.settled(t)
+	if n := rec.count(optedOut.ID, eventTransferReceived); n != 0 {
+		t.Errorf("opted-out user got %d transfer notifications", n)
+	}
+	if n := rec.count(optedIn.ID, eventTransferReceived); n != 1 {
+		t.Errorf("opted-in user got %d transfer notifications, want 1", n)
+	}
+
+	// opting back in, and the preference surviving a replay
+	wantStatus(t, serve(t, "PUT", "/user/"+string(optedOut.ID)+"/notifications", map[string]bool{eventTransferReceived: true}), 200)
+	if u := Replay(events)[optedOut.ID]; !u.wantsNotification(eventTransferReceived) {
+		t.Error("replayed user is still opted out")
+	}
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: optedOut.ID, Amount: 10})
+	rec.settled(t)
+	if n := rec.count(optedOut.ID, eventTransferReceived); n != 1 {
+		t.Errorf("user who opted back in got %d transfer notifications, want 1", n)
+	}
+
+	wantStatus(t, serve(t, "PUT", "/user/"+string(optedIn.ID)+"/notifications", map[string]bool{"marketing": false}), 400)
+	wantStatus(t, serve(t, "PUT", "/user/999/notifications", map[string]bool{eventLowBalance: false}), 404)
+}
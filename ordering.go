@@ -0,0 +1,52 @@
+package main
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// orderBySender trades the autoscaling pool for a fixed set of partitions,
+// one worker each, with every sender hashed to a single partition. A
+// sender's transfers are then applied in the order they were queued while
+// different senders still run in parallel.
+var orderBySender bool
+var senderPartitions = 4
+
+type partitionedDispatcher struct {
+	queue      chan Transaction
+	partitions []chan Transaction
+	f          func(worker string, t Transaction) error
+}
+
+func newPartitionedDispatcher(queue chan Transaction, f func(worker string, t Transaction) error, n int) *partitionedDispatcher {
+	if n < 1 {
+		n = 1
+	}
+	d := &partitionedDispatcher{queue: queue, f: f}
+	for i := 0; i < n; i++ {
+		d.partitions = append(d.partitions, make(chan Transaction, cap(queue)))
+	}
+	return d
+}
+
+func (d *partitionedDispatcher) partition(senderID ID) int {
+	h := fnv.New32a()
+	h.Write([]byte(senderID))
+	return int(h.Sum32() % uint32(len(d.partitions)))
+}
+
+func (d *partitionedDispatcher) run() {
+	for i, p := range d.partitions {
+		go d.work("partition-"+strconv.Itoa(i), p)
+	}
+	for t := range d.queue {
+		transactionClock.pop()
+		d.partitions[d.partition(t.SenderID)] <- t
+	}
+}
+
+func (d *partitionedDispatcher) work(name string, p chan Transaction) {
+	for t := range p {
+		d.f(name, t)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPartitionsKeepSenderOrder(t *testing.T) {
+	resetStore(t)
+	var senders []User
+	for i := 0; i < 6; i++ {
+		senders = append(senders, newUser(t, true))
+	}
+	receiver := newUser(t, true)
+
+	queue := make(chan Transaction, 1000)
+	var handled int32
+	d := newPartitionedDispatcher(queue, func(worker string, tx Transaction) error {
+		defer atomic.AddInt32(&handled, 1)
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+		return handleTransaction(worker, tx)
+	}, 3)
+	go d.run()
+	defer func() {
+		close(queue)
+		for _, p := range d.partitions {
+			close(p)
+		}
+	}()
+
+	sent := make(map[ID][]ID)
+	for i := 0; i < 20; i++ {
+		for _, s := range senders {
+			tx := addTransaction(Transaction{SenderID: s.ID, ReceiverID: receiver.ID, Amount: float64(i + 1), Currency: defaultCurrency})
+			sent[s.ID] = append(sent[s.ID], tx.ID)
+			transactionClock.push(time.Now())
+			queue <- tx
+		}
+	}
+	waitFor(t, "every transfer", func() bool { return atomic.LoadInt32(&handled) == 20*int32(len(senders)) })
+
+	applied := make(map[ID][]ID)
+	mu.RLock()
+	for _, e := range events {
+		if e.Type == eventTransferred {
+			applied[e.UserID] = append(applied[e.UserID], e.TransactionID)
+		}
+	}
+	mu.RUnlock()
+	for _, s := range senders {
+		want, got := sent[s.ID], applied[s.ID]
+		if len(got) != len(want) {
+			t.Fatalf("sender %s has %d transfers applied, want %d", s.ID, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("sender %s applied %v, want %v", s.ID, got, want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// outboundTimeout bounds each call this server makes to another service,
+// so a stalled endpoint can't hold up shutdown or a worker indefinitely.
+var outboundTimeout = 5 * time.Second
+
+// outboundClient is shared by every outbound call. Its transport gives up
+// on connecting early; the call as a whole is bounded by outboundCall.
+var outboundClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// outboundCall sends req with a deadline of outboundTimeout from now,
+// derived from the request's own context so the caller can still cancel
+// it sooner. The returned cancel must be called once the body is read.
+func outboundCall(req *http.Request) (*http.Response, context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), outboundTimeout)
+	resp, err := outboundClient.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return resp, cancel, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stalledServer never answers until its caller gives up.
+func stalledServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestOutboundCallAbortsAtTimeout(t *testing.T) {
+	outboundTimeout = 50 * time.Millisecond
+	defer func() { outboundTimeout = 5 * time.Second }()
+	req, _ := http.NewRequest("GET", stalledServer(t).URL, nil)
+
+	start := time.Now()
+	_, _, err := outboundCall(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("call to a stalled server: %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call took %v, want about %v", elapsed, outboundTimeout)
+	}
+}
+
+// A caller's own, shorter deadline still applies, and a call that answers
+// in time can be read in full.
+func TestOutboundCallKeepsCallerDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", stalledServer(t).URL, nil)
+	start := time.Now()
+	if _, _, err := outboundCall(req); err == nil {
+		t.Error("call to a stalled server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call took %v after the caller's 50ms deadline", elapsed)
+	}
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer fast.Close()
+	req, _ = http.NewRequest("GET", fast.URL, nil)
+	resp, done, err := outboundCall(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "ok" {
+		t.Errorf("body %q, %v", body, err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const defaultPageLimit = 100
+
+// maxPageLimit is the most records any list endpoint returns at once.
+// Asking for more gets a page of maxPageLimit, whose pagination block
+// reports the limit used and the cursor to the rest.
+var maxPageLimit = 1000
+
+// Envelope is the response shape shared by every list endpoint.
+type Envelope struct {
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// parsePage reads limit and offset from the query string. A cursor taken
+// from a previous response's next_cursor can be passed instead of offset.
+func parsePage(r *http.Request) (limit, offset int, err error) {
+	q := r.URL.Query()
+	limit = defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			return 0, 0, errors.New("invalid limit")
+		}
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	v := q.Get("offset")
+	if c := q.Get("cursor"); c != "" {
+		v = c
+	}
+	if v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
+
+// paginate returns the [start, end) bounds of the requested page within
+// total items and the matching Pagination block.
+func paginate(total, limit, offset int) (start, end int, p Pagination) {
+	start = offset
+	if start > total {
+		start = total
+	}
+	end = start + limit
+	if end > total {
+		end = total
+	}
+	p = Pagination{Limit: limit, Offset: offset, Total: total}
+	if end < total {
+		p.NextCursor = strconv.Itoa(end)
+	}
+	return start, end, p
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	for _, c := range []struct {
+		total, limit, offset int
+		start, end           int
+		next                 string
+	}{
+		{total: 5, limit: 2, offset: 0, start: 0, end: 2, next: "2"},
+		{total: 5, limit: 2, offset: 4, start: 4, end: 5},
+		{total: 5, limit: 10, offset: 0, start: 0, end: 5},
+		{total: 5, limit: 2, offset: 9, start: 5, end: 5},
+		{total: 0, limit: 2, offset: 0, start: 0, end: 0},
+	} {
+		start, end, p := paginate(c.total, c.limit, c.offset)
+		if start != c.start || end != c.end || p.NextCursor != c.next || p.Total != c.total || p.Limit != c.limit || p.Offset != c.offset {
+			t.Errorf("paginate(%d, %d, %d) = %d, %d, %+v", c.total, c.limit, c.offset, start, end, p)
+		}
+	}
+}
+
+// Every list endpoint answers with the same data and pagination keys.
+func TestListEndpointsShareEnvelope(t *testing.T) {
+	resetStore(t)
+	a, b := newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: a.ID, ReceiverID: b.ID, Amount: 1})
+	transfer(t, Transaction{SenderID: b.ID, ReceiverID: a.ID, Amount: 2})
+
+	for _, path := range []string{"/user", "/transactions", "/users/top", "/admin/events", "/admin/audit", "/admin/failures", "/admin/reviews", "/admin/adjustments"} {
+		w := serve(t, "GET", path+"?limit=1", nil)
+		wantStatus(t, w, 200)
+		var raw map[string]json.RawMessage
+		decode(t, w, &raw)
+		var data []json.RawMessage
+		var p Pagination
+		if len(raw) != 2 || json.Unmarshal(raw["data"], &data) != nil || json.Unmarshal(raw["pagination"], &p) != nil {
+			t.Errorf("%s: not an envelope: %s", path, w.Body.String())
+			continue
+		}
+		if p.Limit != 1 || len(data) > 1 || (p.Total > 1) != (p.NextCursor == "1") {
+			t.Errorf("%s: %d items with pagination %+v", path, len(data), p)
+		}
+	}
+}
+
+func TestUserListCursor(t *testing.T) {
+	resetStore(t)
+	for i := 0; i < 5; i++ {
+		newUser(t, true)
+	}
+	// the list includes the reserve accounts
+	want := make(map[ID]bool)
+	for id := range db {
+		want[id] = true
+	}
+
+	seen := make(map[ID]bool)
+	cursor, pages := "0", 0
+	for cursor != "" {
+		var page struct {
+			Data       []User
+			Pagination Pagination
+		}
+		decode(t, serve(t, "GET", "/user?limit=2&cursor="+cursor, nil), &page)
+		if page.Pagination.Total != len(want) {
+			t.Fatalf("total %d, want %d", page.Pagination.Total, len(want))
+		}
+		for _, u := range page.Data {
+			if seen[u.ID] || !want[u.ID] {
+				t.Errorf("page %d has unexpected or repeated user %s", pages, u.ID)
+			}
+			seen[u.ID] = true
+		}
+		cursor = page.Pagination.NextCursor
+		pages++
+	}
+	if pages != (len(want)+1)/2 || len(seen) != len(want) {
+		t.Errorf("%d pages covering %d users, want %d covering %d", pages, len(seen), (len(want)+1)/2, len(want))
+	}
+}
+
+func TestListCap(t *testing.T) {
+	resetStore(t)
+	maxPageLimit = 5
+	for i := 0; i < 2*maxPageLimit; i++ {
+		newUser(t, true)
+	}
+
+	// a limit over the cap gets a capped page and the cursor to the rest
+	for _, path := range []string{"/user?limit=6", "/transactions?limit=6", "/admin/audit?limit=6"} {
+		w := serve(t, "GET", path, nil)
+		wantStatus(t, w, 200)
+		var page struct {
+			Data       []json.RawMessage
+			Pagination Pagination
+		}
+		decode(t, w, &page)
+		if page.Pagination.Limit != maxPageLimit || len(page.Data) > maxPageLimit {
+			t.Errorf("GET %s over the cap: %d records with %+v, want at most %d", path, len(page.Data), page.Pagination, maxPageLimit)
+		}
+	}
+
+	// without a limit the default is held to the cap
+	var page struct {
+		Data       []User
+		Pagination Pagination
+	}
+	decode(t, serve(t, "GET", "/user", nil), &page)
+	if len(page.Data) != maxPageLimit || page.Pagination.Limit != maxPageLimit || page.Pagination.NextCursor == "" {
+		t.Errorf("unpaginated GET /user returned %d users with %+v, want %d and a cursor", len(page.Data), page.Pagination, maxPageLimit)
+	}
+	wantStatus(t, serve(t, "GET", "/user?limit=5", nil), 200)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// workerPanics counts recovered panics; it is exposed in /admin/debug.
+var workerPanics int32
+
+// panicked holds transactions that panicked once and were requeued for
+// their one retry.
+var panickedMu sync.Mutex
+var panicked = make(map[ID]bool)
+
+// safeProcess runs processTransaction and recovers a panic into an error,
+// so the worker goroutine keeps draining the queue. Locks taken in
+// processTransaction are released by their defers as the panic unwinds.
+func safeProcess(t Transaction) (err error) {
+	defer func() {
+		p := recover()
+		if p == nil {
+			panickedMu.Lock()
+			delete(panicked, t.ID)
+			panickedMu.Unlock()
+			return
+		}
+		atomic.AddInt32(&workerPanics, 1)
+		log.Printf("panic processing transaction %s: %v\n%s", t.ID, p, debug.Stack())
+		err = recoverFromPanic(t)
+	}()
+	return processTransaction(t)
+}
+
+// recoverFromPanic gives t one more attempt, but only if the panic left
+// nothing behind: a transfer that already recorded events or created
+// split legs could be applied twice. Anything else is dead-lettered as
+// failed with processing_panic, where an admin can inspect and retry it.
+func recoverFromPanic(t Transaction) error {
+	// Past the queue (finished, or held for acceptance) the status
+	// already says what happened; leave it alone.
+	if stored, ok := getTransaction(t.ID); !ok || stored.Status != statusQueued {
+		return newError(CodeProcessingPanic, "Processing panicked after the transaction left the queue")
+	}
+	panickedMu.Lock()
+	again := panicked[t.ID]
+	if again {
+		delete(panicked, t.ID)
+	} else {
+		panicked[t.ID] = true
+	}
+	panickedMu.Unlock()
+
+	if !again && !leftState(t.ID) && !isShuttingDown() {
+		requeueTransaction(t)
+		return newError(CodeProcessingPanic, "Processing panicked; requeued for one retry")
+	}
+	return failTransaction(t, newError(CodeProcessingPanic, "Processing panicked; dead-lettered"))
+}
+
+// leftState reports whether any event or split leg refers to id.
+func leftState(id ID) bool {
+	mu.RLock()
+	for _, e := range events {
+		if e.TransactionID == id {
+			mu.RUnlock()
+			return true
+		}
+	}
+	mu.RUnlock()
+
+	txMu.Lock()
+	defer txMu.Unlock()
+	for _, t := range transactions {
+		if t.SplitOf == id {
+			return true
+		}
+	}
+	return false
+}
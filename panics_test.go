@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+// poisonHook panics on every transfer of the poison amount, before or
+// after it is applied.
+type poisonHook struct {
+	amount float64
+	after  bool
+}
+
+func (h *poisonHook) BeforeProcess(ctx context.Context, t *Transaction) error {
+	if !h.after && t.Amount == h.amount {
+		var m map[string]int
+		m["boom"]++
+	}
+	return nil
+}
+
+func (h *poisonHook) AfterProcess(ctx context.Context, t Transaction, result error) {
+	if h.after && t.Amount == h.amount {
+		panic("poisoned after processing")
+	}
+}
+
+func TestPoisonTransactionIsDeadLettered(t *testing.T) {
+	resetStore(t)
+	registerTransactionHook(&poisonHook{amount: 13})
+	sender, receiver := newUser(t, true), newUser(t, true)
+	panics := atomic.LoadInt32(&workerPanics)
+	startWorkers(t, 1)
+
+	poison := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 13, Currency: defaultCurrency})
+	enqueueTransaction(poison)
+	waitFor(t, "the poison transaction to be dead-lettered", hasStatus(poison.ID, statusFailed))
+	got, _ := getTransaction(poison.ID)
+	if got.Reason != string(CodeProcessingPanic) || got.Attempts != 2 {
+		t.Errorf("poison transaction: reason %q after %d attempts, want %s after 2", got.Reason, got.Attempts, CodeProcessingPanic)
+	}
+	if n := atomic.LoadInt32(&workerPanics) - panics; n != 2 {
+		t.Errorf("%d panics recovered, want 2", n)
+	}
+
+	// the same worker carries on
+	next := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 20, Currency: defaultCurrency})
+	enqueueTransaction(next)
+	waitFor(t, "the next transaction", hasStatus(next.ID, statusCompleted))
+	if balance(t, sender.ID) != 980 || balance(t, receiver.ID) != 1020 {
+		t.Errorf("balances %v and %v, want 980 and 1020", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+
+	// an admin can retry it once the bug is fixed
+	hooksMu.Lock()
+	transactionHooks = nil
+	hooksMu.Unlock()
+	var retry Transaction
+	decode(t, serve(t, "POST", "/admin/transaction/"+string(poison.ID)+"/retry", nil), &retry)
+	waitFor(t, "the retried transaction", hasStatus(retry.ID, statusCompleted))
+}
+
+func TestPanicOnceIsRetried(t *testing.T) {
+	resetStore(t)
+	registerTransactionHook(&panicHook{times: 1})
+	sender, receiver := newUser(t, true), newUser(t, true)
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	if got.Status != statusCompleted || got.Attempts != 2 {
+		t.Errorf("transfer that panicked once: status %s after %d attempts", got.Status, got.Attempts)
+	}
+	if balance(t, receiver.ID) != 1010 {
+		t.Errorf("receiver balance %v, want 1010", balance(t, receiver.ID))
+	}
+}
+
+// A panic once the transfer has been applied keeps its outcome; running
+// it again could move the money twice.
+func TestPanicAfterApplyIsNotRetried(t *testing.T) {
+	resetStore(t)
+	registerTransactionHook(&poisonHook{amount: 13, after: true})
+	sender, receiver := newUser(t, true), newUser(t, true)
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 13})
+	if got.Status != statusCompleted || got.Attempts != 1 {
+		t.Errorf("transfer that panicked after applying: status %s after %d attempts", got.Status, got.Attempts)
+	}
+	if balance(t, sender.ID) != 987 || balance(t, receiver.ID) != 1013 {
+		t.Errorf("balances %v and %v, want the transfer applied once", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// pushgatewayURL, if set, gets the final metrics pushed on shutdown so
+// short-lived runs such as seeding are recorded even though nothing
+// scraped them.
+var pushgatewayURL string
+var pushgatewayJob = "lemonade"
+
+// pushAttempts is how many times a push is tried, each within
+// outboundTimeout, before the metrics are given up on.
+const pushAttempts = 3
+
+// finalMetrics renders the run's totals in the Prometheus text format.
+func finalMetrics() []byte {
+	mu.RLock()
+	users := 0
+	for _, u := range db {
+		if !u.System {
+			users++
+		}
+	}
+	mu.RUnlock()
+
+	byStatus := map[string]int{statusCompleted: 0, statusFailed: 0}
+	txMu.Lock()
+	for _, t := range transactions {
+		byStatus[t.Status]++
+	}
+	txMu.Unlock()
+	statuses := make([]string, 0, len(byStatus))
+	for s := range byStatus {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "# TYPE lemonade_users_created_total counter")
+	fmt.Fprintf(&b, "lemonade_users_created_total %d\n", users)
+	fmt.Fprintln(&b, "# TYPE lemonade_transactions_total counter")
+	for _, s := range statuses {
+		fmt.Fprintf(&b, "lemonade_transactions_total{status=%q} %d\n", s, byStatus[s])
+	}
+	return b.Bytes()
+}
+
+// pushMetrics replaces the job's metrics on the Pushgateway, retrying a
+// failed or timed-out push until pushAttempts or ctx runs out.
+func pushMetrics(ctx context.Context, gateway, job string) error {
+	endpoint := strings.TrimRight(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	body := finalMetrics()
+	var err error
+	for attempt := 1; attempt <= pushAttempts; attempt++ {
+		if err = pushOnce(ctx, endpoint, body); err == nil || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("pushing metrics, attempt %d of %d: %v", attempt, pushAttempts, err)
+	}
+	return err
+}
+
+func pushOnce(ctx context.Context, endpoint string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, cancel, err := outboundCall(req)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("pushgateway answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPushAbortsAtOutboundTimeout(t *testing.T) {
+	resetStore(t)
+	outboundTimeout = 50 * time.Millisecond
+	defer func() { outboundTimeout = 5 * time.Second }()
+	var calls int32
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer gateway.Close()
+
+	start := time.Now()
+	err := pushMetrics(context.Background(), gateway.URL, "test")
+	elapsed := time.Since(start)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("push to a stalled gateway: %v, want a deadline error", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != pushAttempts {
+		t.Errorf("gateway saw %d attempts, want %d", n, pushAttempts)
+	}
+	if elapsed > pushAttempts*outboundTimeout+time.Second {
+		t.Errorf("push took %v, want about %v", elapsed, pushAttempts*outboundTimeout)
+	}
+}
+
+func TestPushStopsWhenCallerCancels(t *testing.T) {
+	resetStore(t)
+	var calls int32
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer gateway.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := pushMetrics(ctx, gateway.URL, "test"); err == nil {
+		t.Error("push succeeded against a stalled gateway")
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("gateway saw %d attempts after the caller gave up, want 1", n)
+	}
+}
+
+func TestMetricsPushedOnShutdown(t *testing.T) {
+	resetStore(t)
+	var mu sync.Mutex
+	var pushes []string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		pushes = append(pushes, r.Method+" "+r.URL.Path+" "+r.Header.Get("Content-Type")+"\n"+string(body))
+	}))
+	defer gateway.Close()
+
+	alice, bob := newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 10})
+	transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 5000})
+	transfer(t, Transaction{SenderID: bob.ID, ReceiverID: alice.ID, Amount: 1})
+
+	// off unless a gateway is configured
+	finishShutdown()
+	mu.Lock()
+	if len(pushes) != 0 {
+		t.Fatalf("pushed with no gateway configured: %v", pushes)
+	}
+	mu.Unlock()
+
+	pushgatewayURL = gateway.URL + "/"
+	pushgatewayJob = "seed run"
+	defer func() { pushgatewayJob = "lemonade" }()
+	finishShutdown()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pushes) != 1 {
+		t.Fatalf("%d pushes, want 1", len(pushes))
+	}
+	lines := strings.Split(pushes[0], "\n")
+	if lines[0] != "PUT /metrics/job/seed run text/plain; version=0.0.4" {
+		t.Errorf("pushed with %q", lines[0])
+	}
+	for _, want := range []string{
+		"lemonade_users_created_total 2",
+		`lemonade_transactions_total{status="completed"} 2`,
+		`lemonade_transactions_total{status="failed"} 1`,
+	} {
+		if !strings.Contains(pushes[0], "\n"+want+"\n") {
+			t.Errorf("pushed metrics are missing %q:\n%s", want, pushes[0])
+		}
+	}
+}
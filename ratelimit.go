@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// userRatePerMinute caps how many transfers a sender can start per minute,
+// with up to userRateBurst at once. Zero disables the limit.
+var userRatePerMinute = 30.0
+var userRateBurst = 10
+
+var transferLimiter *userLimiter
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// userLimiter is a token bucket per user ID.
+type userLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[ID]*tokenBucket
+}
+
+func newUserLimiter(perMinute float64, burst int) *userLimiter {
+	return &userLimiter{rate: perMinute / 60, burst: float64(burst), buckets: make(map[ID]*tokenBucket)}
+}
+
+func (l *userLimiter) allow(id ID, now time.Time) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[id] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
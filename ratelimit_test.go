@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserRateLimit(t *testing.T) {
+	resetStore(t)
+	transferLimiter = newUserLimiter(60, 3)
+	greedy, other, receiver := newUser(t, true), newUser(t, true), newUser(t, true)
+
+	for i := 1; i <= 3; i++ {
+		tx := Transaction{SenderID: greedy.ID, ReceiverID: receiver.ID, Amount: float64(i)}
+		wantStatus(t, serve(t, "POST", "/transaction", tx), 200)
+	}
+	w := serve(t, "POST", "/transaction", Transaction{SenderID: greedy.ID, ReceiverID: receiver.ID, Amount: 4})
+	wantStatus(t, w, 429)
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if apiErr.Code != CodeUserRateLimited {
+		t.Errorf("throttled transfer: code %q", apiErr.Code)
+	}
+	wantStatus(t, serve(t, "POST", "/transaction", Transaction{SenderID: other.ID, ReceiverID: receiver.ID, Amount: 5}), 200)
+}
+
+func TestUserLimiterRefills(t *testing.T) {
+	l := newUserLimiter(60, 2)
+	now := time.Now()
+	if !l.allow("1", now) || !l.allow("1", now) || l.allow("1", now) {
+		t.Fatal("burst of 2 not enforced")
+	}
+	if l.allow("1", now.Add(500*time.Millisecond)) {
+		t.Error("allowed before a token refilled")
+	}
+	if !l.allow("1", now.Add(time.Second)) {
+		t.Error("refused after a token refilled")
+	}
+	if !newUserLimiter(0, 0).allow("1", now) {
+		t.Error("a zero rate should disable the limit")
+	}
+}
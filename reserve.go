@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+)
+
+// systemAccounts maps each currency to its reserve account: the house
+// account that fees and corrections flow into. Reserves get negative numeric
+// IDs so they never collide with generated user IDs. Guarded by mu.
+var systemAccounts = make(map[string]ID)
+
+// ensureReserves creates any missing reserve accounts and re-indexes the
+// existing ones, e.g. after state has been restored.
+func ensureReserves() {
+	mu.Lock()
+	defer mu.Unlock()
+	systemAccounts = make(map[string]ID)
+	lowest := 0
+	for _, u := range db {
+		if !u.System {
+			continue
+		}
+		systemAccounts[u.Currency] = u.ID
+		if n, err := strconv.Atoi(string(u.ID)); err == nil && n < lowest {
+			lowest = n
+		}
+	}
+
+	codes := make([]string, 0, len(currencyDecimals))
+	for c := range currencyDecimals {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	for _, c := range codes {
+		if _, ok := systemAccounts[c]; ok {
+			continue
+		}
+		lowest--
+		id := ID(strconv.Itoa(lowest))
+		reserve := User{ID: id, Currency: c, Verified: true, System: true}
+		recordEvent(Event{Type: eventUserCreated, UserID: id, User: &reserve})
+		systemAccounts[c] = id
+	}
+}
+
+// transferFeePercent of each transfer is charged to the sender on top of
+// the amount. Zero, the default, charges nothing.
+var transferFeePercent float64
+
+// transferFee is the fee for sending amount: transferFeePercent of it,
+// rounded half away from zero to the currency's precision so the reserve
+// only ever holds whole minor units. Splits pay no fee.
+func transferFee(amount float64, currency string) float64 {
+	if transferFeePercent <= 0 {
+		return 0
+	}
+	return roundToPrecision(amount*transferFeePercent/100, currency)
+}
+
+// creditReserve books amount (which may be negative) to the currency's
+// reserve. It must be called with mu held.
+func creditReserve(currency string, amount float64) {
+	id, ok := systemAccounts[currency]
+	if !ok {
+		return
+	}
+	recordEvent(Event{Type: eventAdjusted, UserID: id, Amount: amount})
+}
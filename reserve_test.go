@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestReservesPerCurrency(t *testing.T) {
+	resetStore(t)
+	for c := range currencyDecimals {
+		r, ok := getUser(systemAccounts[c])
+		if !ok || !r.System || r.Currency != c {
+			t.Errorf("%s reserve: %+v", c, r)
+		}
+	}
+	before := len(db)
+	ensureReserves()
+	if len(db) != before {
+		t.Errorf("ensureReserves created %d more accounts on a second run", len(db)-before)
+	}
+
+	usd := newUser(t, true)
+	eur, _ := addUser(User{Currency: "EUR"})
+	adjust := func(id ID, amount float64) {
+		t.Helper()
+		if _, err := proposeAdjustment(Adjustment{UserID: id, Amount: amount, Reason: "correction", ProposedBy: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	adjust(usd.ID, 40)
+	adjust(eur.ID, -15)
+	if r := balance(t, systemAccounts["USD"]); r != -40 {
+		t.Errorf("USD reserve %v, want -40", r)
+	}
+	if r := balance(t, systemAccounts["EUR"]); r != 15 {
+		t.Errorf("EUR reserve %v, want 15", r)
+	}
+}
+
+func TestReservesAreProtected(t *testing.T) {
+	resetStore(t)
+	u := newUser(t, true)
+	reserve := systemAccounts[defaultCurrency]
+
+	for _, tx := range []Transaction{
+		{SenderID: u.ID, ReceiverID: reserve, Amount: 1},
+		{SenderID: reserve, ReceiverID: u.ID, Amount: 1},
+	} {
+		if got := transfer(t, tx); got.Status != statusFailed || got.Reason != string(CodeSystemAccount) {
+			t.Errorf("transfer %s -> %s: status %s reason %q", tx.SenderID, tx.ReceiverID, got.Status, got.Reason)
+		}
+	}
+	if _, _, err := mergeUsers(reserve, u.ID); err == nil || err.Code != CodeSystemAccount {
+		t.Errorf("merging the reserve away: %v", err)
+	}
+	wantStatus(t, serve(t, "PUT", "/admin/users/"+string(reserve)+"/freeze", nil), 400)
+	if _, err := proposeAdjustment(Adjustment{UserID: reserve, Amount: 1, ProposedBy: "test"}); err == nil || err.Code != CodeSystemAccount {
+		t.Errorf("adjusting the reserve: %v", err)
+	}
+	if r, ok := getUser(reserve); !ok || r.Balance != 0 || r.Closed {
+		t.Errorf("reserve after attempts: %+v", r)
+	}
+}
+
+func TestFeesAccumulateInReserve(t *testing.T) {
+	resetStore(t)
+	transferFeePercent = 1
+	sender, receiver := newUser(t, true), newUser(t, true)
+	yen, _ := addUser(User{Currency: "JPY"})
+	verifyUser(yen)
+	yenReceiver, _ := addUser(User{Currency: "JPY"})
+	verifyUser(yenReceiver)
+
+	send := func(tx Transaction) Transaction {
+		t.Helper()
+		w := serve(t, "POST", "/transaction", tx, "X-Allow-Duplicate", "true")
+		wantStatus(t, w, 200)
+		var queued Transaction
+		decode(t, w, &queued)
+		drainQueue(t)
+		got, _ := getTransaction(queued.ID)
+		return got
+	}
+	for _, amount := range []float64{100, 33.35} {
+		if got := send(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: amount}); got.Status != statusCompleted {
+			t.Fatalf("transfer of %v: status %s reason %q", amount, got.Status, got.Reason)
+		}
+	}
+	// 1% of 33.35 is 0.3335, charged as 0.33
+	if got := send(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 1}); got.Fee != 0.01 {
+		t.Errorf("fee on 1 USD is %v, want 0.01", got.Fee)
+	}
+	if b := balance(t, sender.ID); math.Abs(b-(1000-134.35-1.34)) > 1e-9 {
+		t.Errorf("sender has %v, want the amounts and 1.34 in fees taken", b)
+	}
+	if b := balance(t, receiver.ID); math.Abs(b-1134.35) > 1e-9 {
+		t.Errorf("receiver has %v, want the amounts without fees", b)
+	}
+	if r := balance(t, systemAccounts["USD"]); math.Abs(r-1.34) > 1e-9 {
+		t.Errorf("USD reserve %v, want the 1.34 in fees", r)
+	}
+
+	// yen has no minor unit: 1% of 150 rounds to 2
+	if got := send(Transaction{SenderID: yen.ID, ReceiverID: yenReceiver.ID, Amount: 150}); got.Fee != 2 {
+		t.Errorf("fee on 150 JPY is %v, want 2", got.Fee)
+	}
+	if r := balance(t, systemAccounts["JPY"]); r != 2 {
+		t.Errorf("JPY reserve %v, want 2", r)
+	}
+	if r := balance(t, systemAccounts["EUR"]); r != 0 {
+		t.Errorf("EUR reserve %v, want nothing from USD and JPY fees", r)
+	}
+
+	// the fee has to be covered too
+	if got := send(Transaction{SenderID: yenReceiver.ID, ReceiverID: yen.ID, Amount: 1150}); got.Status != statusFailed || got.Reason != string(CodeInsufficientFunds) {
+		t.Errorf("transfer of the whole balance plus fee: status %s reason %q", got.Status, got.Reason)
+	}
+	if problems := checkLedger(snapshotState()); len(problems) > 0 {
+		t.Errorf("self-test problems: %v", problems)
+	}
+}
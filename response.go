@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// userFields and transactionFields are the names ?fields= may select on
+// user and transaction responses.
+var userFields = mergeFields(jsonFields(User{}), map[string]bool{"available_balance": true})
+var transactionFields = mergeFields(jsonFields(ExpandedTransaction{}), jsonFields(QueuedTransaction{}))
+
+func mergeFields(sets ...map[string]bool) map[string]bool {
+	fields := make(map[string]bool)
+	for _, set := range sets {
+		for name := range set {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+func jsonFields(v interface{}) map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			fields = mergeFields(fields, jsonFields(reflect.Zero(f.Type).Interface()))
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = true
+	}
+	return fields
+}
+
+// responseOptions are the ?pretty=, ?fields= and amount formatting query
+// parameters.
+type responseOptions struct {
+	pretty bool
+	fields map[string]bool
+	format *numberFormat
+}
+
+// parseResponseOptions reads the response options, rejecting any field
+// that isn't in known. Handlers call it before doing any work so a bad
+// field list fails without side effects.
+func parseResponseOptions(r *http.Request, known map[string]bool) (responseOptions, error) {
+	q := r.URL.Query()
+	opts := responseOptions{pretty: q.Get("pretty") == "true"}
+	format, err := parseNumberFormat(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.format = format
+	v := q.Get("fields")
+	if v == "" {
+		return opts, nil
+	}
+	opts.fields = make(map[string]bool)
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			return opts, fmt.Errorf("unknown field %q", name)
+		}
+		opts.fields[name] = true
+	}
+	return opts, nil
+}
+
+// writeResponse encodes v as JSON with opts applied. For an Envelope the
+// field filter and amount formatting apply to each item in data;
+// pagination is kept whole. A selected field keeps its _formatted sibling.
+func writeResponse(w http.ResponseWriter, opts responseOptions, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, 500, CodeInternal, "Error occured. Try again later")
+		return
+	}
+	if opts.fields != nil || opts.format != nil {
+		var doc map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err == nil {
+			objects := []map[string]interface{}{doc}
+			if _, isEnvelope := v.(Envelope); isEnvelope {
+				objects = nil
+				items, _ := doc["data"].([]interface{})
+				for _, item := range items {
+					if m, ok := item.(map[string]interface{}); ok {
+						objects = append(objects, m)
+					}
+				}
+			}
+			for _, m := range objects {
+				if opts.format != nil {
+					addFormattedAmounts(m, *opts.format)
+				}
+				if opts.fields != nil {
+					selectFields(m, opts.fields)
+				}
+			}
+			body, _ = json.Marshal(doc)
+		}
+	}
+	if opts.pretty {
+		var buf bytes.Buffer
+		if json.Indent(&buf, body, "", "  ") == nil {
+			body = buf.Bytes()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
+
+func selectFields(m map[string]interface{}, fields map[string]bool) {
+	for k := range m {
+		if !fields[k] && !fields[strings.TrimSuffix(k, "_formatted")] {
+			delete(m, k)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrettyResponse(t *testing.T) {
+	resetStore(t)
+	u := newUser(t, true)
+	compact := serve(t, "GET", "/user/"+string(u.ID), nil).Body.String()
+	if strings.Contains(compact, "\n  ") {
+		t.Errorf("default response is indented: %s", compact)
+	}
+	w := serve(t, "GET", "/user/"+string(u.ID)+"?pretty=true", nil)
+	wantStatus(t, w, 200)
+	if !strings.HasPrefix(w.Body.String(), "{\n  \"") {
+		t.Errorf("pretty response is not indented: %s", w.Body.String())
+	}
+	var got User
+	decode(t, w, &got)
+	if got.ID != u.ID || got.Balance != 1000 {
+		t.Errorf("pretty response decodes to %+v", got)
+	}
+}
+
+func TestFieldFilter(t *testing.T) {
+	resetStore(t)
+	u, other := newUser(t, true), newUser(t, true)
+	w := serve(t, "GET", "/user/"+string(u.ID)+"?fields=id,balance", nil)
+	wantStatus(t, w, 200)
+	var m map[string]interface{}
+	decode(t, w, &m)
+	if len(m) != 2 || m["id"] == nil || m["balance"] != 1000.0 {
+		t.Errorf("filtered user %v, want only id and balance", m)
+	}
+
+	tx := transfer(t, Transaction{SenderID: u.ID, ReceiverID: other.ID, Amount: 10})
+	m = nil
+	decode(t, serve(t, "GET", "/transaction/"+string(tx.ID)+"?fields=status", nil), &m)
+	if len(m) != 1 || m["status"] != statusCompleted {
+		t.Errorf("filtered transaction %v, want only status", m)
+	}
+
+	var page struct {
+		Data       []map[string]interface{}
+		Pagination map[string]interface{}
+	}
+	decode(t, serve(t, "GET", "/transactions?fields=id,amount", nil), &page)
+	if len(page.Data) != 1 || len(page.Data[0]) != 2 || page.Data[0]["amount"] != 10.0 || page.Pagination == nil {
+		t.Errorf("filtered list %+v, want items with only id and amount", page)
+	}
+
+	w = serve(t, "GET", "/user/"+string(u.ID)+"?fields=id,password", nil)
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if w.Code != 400 || apiErr.Code != CodeBadRequest || !strings.Contains(apiErr.Message, "password") {
+		t.Errorf("unknown field: %d %+v", w.Code, apiErr)
+	}
+}
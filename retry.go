@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// retryTransaction queues a fresh copy of a failed transaction. The
+// original keeps its failed status and records the retry's ID, so each
+// failure can be retried at most once and a completed transfer never is.
+// Nothing is retried once shutdown has begun.
+func retryTransaction(id ID) (orig, retry Transaction, err *APIError) {
+	if isShuttingDown() {
+		return orig, retry, newError(CodeShuttingDown, "Server is shutting down. Try again later")
+	}
+	txMu.Lock()
+	orig, ok := transactions[id]
+	if !ok {
+		txMu.Unlock()
+		return orig, retry, newError(CodeTransactionNotFound, "Transaction not found")
+	}
+	if orig.Status != statusFailed {
+		txMu.Unlock()
+		return orig, retry, newError(CodeNotRetryable, "Only failed transactions can be retried")
+	}
+	if orig.RetriedBy != "" {
+		txMu.Unlock()
+		return orig, retry, newError(CodeNotRetryable, "Transaction was already retried as "+string(orig.RetriedBy))
+	}
+	retry = insertTransaction(orig)
+	retry.RetryOf = orig.ID
+	transactions[retry.ID] = retry
+	linked := orig
+	linked.RetriedBy = retry.ID
+	transactions[orig.ID] = linked
+	txMu.Unlock()
+
+	enqueueTransaction(retry)
+	return orig, retry, nil
+}
+
+func RetryTransaction(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseResponseOptions(r, transactionFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	id := ID(mux.Vars(r)["id"])
+	orig, retry, apiErr := retryTransaction(id)
+	if apiErr != nil {
+		status := 409
+		switch apiErr.Code {
+		case CodeTransactionNotFound:
+			status = 404
+		case CodeShuttingDown:
+			status = 503
+		}
+		writeAPIError(w, status, apiErr)
+		return
+	}
+	recordAudit(r, "transaction.retry", string(id), orig, retry)
+	writeResponse(w, opts, retry)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestRetryAfterSenderIsVerified(t *testing.T) {
+	resetStore(t)
+	verificationSecret = "provider-secret"
+	sender, receiver := newUser(t, false), newUser(t, true)
+	orig := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 75, Category: "groceries"})
+	wantStatus(t, verificationCallback(t, sender.ID, decisionRejected, verificationSecret), 200)
+	if orig, _ = getTransaction(orig.ID); orig.Status != statusFailed || orig.Reason != string(CodeSenderUnverified) {
+		t.Fatalf("rejected sender's transfer: status %s reason %q", orig.Status, orig.Reason)
+	}
+
+	// the provider clears the sender on appeal
+	wantStatus(t, verificationCallback(t, sender.ID, decisionApproved, verificationSecret), 200)
+	w := serve(t, "POST", "/admin/transaction/"+string(orig.ID)+"/retry", nil)
+	wantStatus(t, w, 200)
+	var retry Transaction
+	decode(t, w, &retry)
+	if retry.ID == orig.ID || retry.RetryOf != orig.ID {
+		t.Fatalf("retry %s links to %q, want a new transaction linked to %s", retry.ID, retry.RetryOf, orig.ID)
+	}
+	drainQueue(t)
+
+	retry, _ = getTransaction(retry.ID)
+	if retry.Status != statusCompleted {
+		t.Fatalf("retry: status %s reason %q", retry.Status, retry.Reason)
+	}
+	if retry.SenderID != sender.ID || retry.ReceiverID != receiver.ID || retry.Amount != 75 || retry.Category != "groceries" {
+		t.Errorf("retry doesn't reuse the original's details: %+v", retry)
+	}
+	if balance(t, sender.ID) != 925 || balance(t, receiver.ID) != 1075 {
+		t.Errorf("balances %v and %v, want 925 and 1075", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+	if orig, _ = getTransaction(orig.ID); orig.Status != statusFailed || orig.RetriedBy != retry.ID {
+		t.Errorf("original after retry: status %s retried by %q", orig.Status, orig.RetriedBy)
+	}
+
+	// neither the original again nor a completed transfer can be retried
+	for _, id := range []ID{orig.ID, retry.ID} {
+		w := serve(t, "POST", "/admin/transaction/"+string(id)+"/retry", nil)
+		var apiErr APIError
+		decode(t, w, &apiErr)
+		if w.Code != 409 || apiErr.Code != CodeNotRetryable {
+			t.Errorf("retrying %s: %d %+v", id, w.Code, apiErr)
+		}
+	}
+}
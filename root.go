@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+const apiVersion = "1"
+
+type Endpoint struct {
+	Methods []string `json:"methods"`
+	Path    string   `json:"path"`
+}
+
+type Landing struct {
+	Name      string     `json:"name"`
+	Version   string     `json:"version"`
+	Prefix    string     `json:"prefix,omitempty"`
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// listEndpoints walks r so the landing page can't drift from the routes
+// actually registered.
+func listEndpoints(r *mux.Router) []Endpoint {
+	var list []Endpoint
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		list = append(list, Endpoint{Methods: methods, Path: path})
+		return nil
+	})
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+func rootHandler(r *mux.Router, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Landing{
+			Name:      "lemonade",
+			Version:   apiVersion,
+			Prefix:    prefix,
+			Endpoints: listEndpoints(r),
+		})
+	}
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, 404, CodeNotFound, "No route for "+r.Method+" "+r.URL.Path)
+}
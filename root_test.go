@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestRootLanding(t *testing.T) {
+	resetStore(t)
+	w := serve(t, "GET", "/", nil)
+	wantStatus(t, w, 200)
+	var landing Landing
+	decode(t, w, &landing)
+	if landing.Version != apiVersion || landing.Prefix != apiPrefix {
+		t.Errorf("landing %+v", landing)
+	}
+	found := make(map[string]bool)
+	for _, e := range landing.Endpoints {
+		for _, m := range e.Methods {
+			found[m+" "+e.Path] = true
+		}
+	}
+	for _, want := range []string{"POST /transaction", "POST /v1/transaction", "GET /v1/user/{id}", "GET /v1/admin/debug"} {
+		if !found[want] {
+			t.Errorf("landing page doesn't list %s", want)
+		}
+	}
+}
+
+func TestUnknownRouteIsJSON404(t *testing.T) {
+	resetStore(t)
+	w := serve(t, "GET", "/v1/nothing/here", nil)
+	wantStatus(t, w, 404)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type %q, want application/json", ct)
+	}
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if apiErr.Code != CodeNotFound || apiErr.Message != "No route for GET /v1/nothing/here" {
+		t.Errorf("404 body %+v", apiErr)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// roundingInterval is how often balances are rounded to their currency's
+// precision to clear float drift. Zero disables the job.
+var roundingInterval time.Duration
+
+// roundBalances rounds every user balance and books the residual to the
+// currency reserve, so the total held in each currency is unchanged. It
+// returns the number of balances adjusted.
+func roundBalances() int {
+	mu.Lock()
+	defer mu.Unlock()
+	adjusted := 0
+	for id, u := range db {
+		if u.System || !knownCurrency(u.Currency) {
+			continue
+		}
+		rounded := roundToPrecision(u.Balance, u.Currency)
+		residual := u.Balance - rounded
+		if residual == 0 {
+			continue
+		}
+		recordEvent(Event{Type: eventAdjusted, UserID: id, Amount: -residual})
+		creditReserve(u.Currency, residual)
+		adjusted++
+	}
+	return adjusted
+}
+
+func runRoundingJob(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if n := roundBalances(); n > 0 {
+			log.Printf("rounding: adjusted %d balances", n)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRoundingBooksResidualToReserve(t *testing.T) {
+	resetStore(t)
+	a, b, c := newUser(t, true), newUser(t, true), newUser(t, true)
+	yen, _ := addUser(User{Currency: "JPY"})
+	mu.Lock()
+	for id, drift := range map[ID]float64{a.ID: 0.004, b.ID: -0.0031, yen.ID: 0.4} {
+		recordEvent(Event{Type: eventAdjusted, UserID: id, Amount: drift})
+	}
+	mu.Unlock()
+	total := func(currency string) float64 {
+		mu.RLock()
+		defer mu.RUnlock()
+		sum := 0.0
+		for _, u := range db {
+			if u.Currency == currency {
+				sum += u.Balance
+			}
+		}
+		return sum
+	}
+	usdBefore, jpyBefore := total("USD"), total("JPY")
+
+	if n := roundBalances(); n != 3 {
+		t.Errorf("rounded %d balances, want 3", n)
+	}
+	for id, want := range map[ID]float64{a.ID: 1000, b.ID: 1000, c.ID: 1000, yen.ID: 1000} {
+		if got := balance(t, id); got != want {
+			t.Errorf("user %s balance %v, want %v", id, got, want)
+		}
+	}
+	if r := balance(t, systemAccounts["USD"]); math.Abs(r-(0.004-0.0031)) > 1e-9 {
+		t.Errorf("USD reserve %v, want the net residual %v", r, 0.004-0.0031)
+	}
+	if r := balance(t, systemAccounts["JPY"]); math.Abs(r-0.4) > 1e-9 {
+		t.Errorf("JPY reserve %v, want 0.4", r)
+	}
+	if math.Abs(total("USD")-usdBefore) > 1e-9 || math.Abs(total("JPY")-jpyBefore) > 1e-9 {
+		t.Errorf("totals moved: USD %v -> %v, JPY %v -> %v", usdBefore, total("USD"), jpyBefore, total("JPY"))
+	}
+	if n := roundBalances(); n != 0 {
+		t.Errorf("second run rounded %d balances, want none", n)
+	}
+	if problems := checkLedger(snapshotState()); len(problems) > 0 {
+		t.Errorf("self-test problems: %v", problems)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// apiPrefix mounts every route under a version prefix such as /v1.
+// serveUnprefixed keeps the original unversioned paths working too.
+var apiPrefix = "/v1"
+var serveUnprefixed = true
+
+func newRouter(prefix string, unprefixed bool) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(accessLog, debugEnvelope, rejectWrites)
+	if prefix != "" {
+		registerRoutes(r.PathPrefix(prefix).Subrouter())
+	}
+	if prefix == "" || unprefixed {
+		registerRoutes(r)
+	}
+	r.HandleFunc("/", rootHandler(r, prefix)).Methods("GET")
+	r.NotFoundHandler = accessLog(debugEnvelope(http.HandlerFunc(notFound)))
+	return r
+}
+
+func registerRoutes(r *mux.Router) {
+	r.HandleFunc("/healthz", Healthz).Methods("GET")
+	r.HandleFunc("/user", CreateUser).Methods("POST")
+	r.HandleFunc("/user", GetUser).Methods("GET")
+	r.HandleFunc("/user/{id}", GetUserByID).Methods("GET")
+	r.HandleFunc("/user/{id}/summary", GetUserSummary).Methods("GET")
+	r.HandleFunc("/user/{id}/balance", GetBalanceAsOf).Methods("GET")
+	r.HandleFunc("/user/{id}/threshold", SetLowBalanceThreshold).Methods("PUT")
+	r.HandleFunc("/user/{id}/notifications", GetNotificationPreferences).Methods("GET")
+	r.HandleFunc("/user/{id}/notifications", SetNotificationPreferences).Methods("PUT")
+	r.HandleFunc("/users/top", GetTopUsers).Methods("GET")
+	r.HandleFunc("/users/balances", GetBalances).Methods("POST")
+	r.HandleFunc("/transaction", Transfer).Methods("POST")
+	r.HandleFunc("/transaction/split", SplitTransfer).Methods("POST")
+	r.HandleFunc("/transactions", ListTransactions).Methods("GET")
+	r.HandleFunc("/transactions/export", ExportTransactions).Methods("GET")
+	r.HandleFunc("/transaction/{id}", GetTransaction).Methods("GET")
+	r.HandleFunc("/transaction/{id}/wait", WaitTransaction).Methods("GET")
+	r.HandleFunc("/transaction/{token}/confirm", ConfirmTransfer).Methods("POST")
+	r.HandleFunc("/transaction/{id}/accept", AcceptTransfer).Methods("POST")
+	r.HandleFunc("/transaction/{id}/reject", RejectTransfer).Methods("POST")
+	r.HandleFunc("/stats/volume", GetVolumeStats).Methods("GET")
+	r.HandleFunc("/verification/callback", VerificationCallback).Methods("POST")
+
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(requireAdminKey)
+	admin.HandleFunc("/blocklist", GetBlocklist).Methods("GET")
+	admin.HandleFunc("/blocklist/{id}", BlockUser).Methods("PUT")
+	admin.HandleFunc("/blocklist/{id}", UnblockUser).Methods("DELETE")
+	admin.HandleFunc("/debug", GetDebugVars).Methods("GET")
+	admin.HandleFunc("/failures", GetFailures).Methods("GET")
+	admin.HandleFunc("/simulate", Simulate).Methods("POST")
+	admin.HandleFunc("/events", GetEvents).Methods("GET")
+	admin.HandleFunc("/export", ExportState).Methods("GET")
+	admin.HandleFunc("/import", ImportState).Methods("POST")
+	admin.HandleFunc("/users/merge", MergeUsers).Methods("POST")
+	admin.HandleFunc("/users/{id}/freeze", FreezeUser).Methods("PUT")
+	admin.HandleFunc("/users/{id}/freeze", UnfreezeUser).Methods("DELETE")
+	admin.HandleFunc("/audit", GetAdminAudit).Methods("GET")
+	admin.HandleFunc("/transaction/{id}/retry", RetryTransaction).Methods("POST")
+	admin.HandleFunc("/reviews", GetReviews).Methods("GET")
+	admin.HandleFunc("/transaction/{id}/approve", ApproveReview).Methods("POST")
+	admin.HandleFunc("/transaction/{id}/reject", RejectReview).Methods("POST")
+	admin.HandleFunc("/adjustments", GetAdjustments).Methods("GET")
+	admin.HandleFunc("/adjustments", ProposeAdjustment).Methods("POST")
+	admin.HandleFunc("/adjustments/{id}/approve", ApproveAdjustment).Methods("POST")
+}
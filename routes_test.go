@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionPrefix(t *testing.T) {
+	resetStore(t)
+	u := newUser(t, true)
+	get := func(prefix string, unprefixed bool, path string) int {
+		w := httptest.NewRecorder()
+		newRouter(prefix, unprefixed).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	for _, c := range []struct {
+		prefix     string
+		unprefixed bool
+		path       string
+		status     int
+	}{
+		{"/v1", false, "/v1/user/" + string(u.ID), 200},
+		{"/v1", false, "/v1/healthz", 200},
+		{"/v1", false, "/v2/healthz", 404},
+		{"/v1", false, "/healthz", 404},
+		{"/v1", true, "/healthz", 200},
+		{"/v2", false, "/v2/healthz", 200},
+		{"/v2", false, "/v1/healthz", 404},
+		{"", false, "/healthz", 200},
+	} {
+		if got := get(c.prefix, c.unprefixed, c.path); got != c.status {
+			t.Errorf("prefix %q unprefixed %v: GET %s = %d, want %d", c.prefix, c.unprefixed, c.path, got, c.status)
+		}
+	}
+}
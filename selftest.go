@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// selfTest checks stateFile before it is loaded: that it can be read and
+// written, and that the saved ledger balances. selfTestFailure decides what
+// a failed check does: "exit" refuses to start, "read-only" serves reads
+// only and never saves over the file.
+var selfTest = true
+var selfTestFailure = selfTestExit
+
+const (
+	selfTestExit     = "exit"
+	selfTestReadOnly = "read-only"
+)
+
+// readOnly is set at startup and never cleared; restart once the state
+// has been repaired.
+var readOnly bool
+
+const ledgerTolerance = 1e-6
+
+// startupSelfTest runs the self-test on stateFile if it is enabled. It
+// returns an error only if the server should refuse to start; in
+// read-only mode a failure sets readOnly instead.
+func startupSelfTest() error {
+	if stateFile == "" || !selfTest {
+		return nil
+	}
+	err := runSelfTest(stateFile)
+	if err == nil {
+		return nil
+	}
+	if selfTestFailure != selfTestReadOnly {
+		return err
+	}
+	log.Printf("self-test: %v; starting read-only", err)
+	readOnly = true
+	return nil
+}
+
+// runSelfTest logs every discrepancy it finds and returns an error if
+// there were any.
+func runSelfTest(path string) error {
+	s, err := readState(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", path, err)
+	}
+	probe := path + ".selftest"
+	if err := os.WriteFile(probe, nil, 0644); err != nil {
+		return fmt.Errorf("%s is not writable: %v", path, err)
+	}
+	os.Remove(probe)
+
+	problems := checkLedger(s)
+	for _, p := range problems {
+		log.Println("self-test:", p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s failed %d integrity checks", path, len(problems))
+	}
+	return nil
+}
+
+// checkLedger reconciles a snapshot. With an event log it checks the
+// saved balances against a replay, that each currency holds exactly
+// what was created and adjusted into it, and that completed transfers
+// and ledger entries match up. Every account is also checked for
+// impossible values.
+func checkLedger(s State) []string {
+	var problems []string
+	if err := validateState(s); err != nil {
+		problems = append(problems, err.Error())
+	}
+	accounts := make(map[ID]User, len(s.Users))
+	for _, u := range s.Users {
+		accounts[u.ID] = u
+	}
+	if len(s.Events) > 0 {
+		problems = append(problems, checkEvents(s)...)
+		accounts = Replay(s.Events)
+	}
+	for _, u := range accounts {
+		switch {
+		case math.IsNaN(u.Balance) || math.IsInf(u.Balance, 0):
+			problems = append(problems, fmt.Sprintf("user %s has balance %v", u.ID, u.Balance))
+		case u.Held < -ledgerTolerance || u.Unsettled < -ledgerTolerance:
+			problems = append(problems, fmt.Sprintf("user %s has held %v and unsettled %v", u.ID, u.Held, u.Unsettled))
+		case !u.System && u.Balance < -ledgerTolerance:
+			problems = append(problems, fmt.Sprintf("user %s has negative balance %v", u.ID, u.Balance))
+		}
+	}
+	return problems
+}
+
+func checkEvents(s State) []string {
+	var problems []string
+	created := make(map[string]float64)
+	transfers := make(map[ID]float64)
+	rolledBack := make(map[ID]bool)
+	for i, e := range s.Events {
+		if e.Seq != i+1 {
+			problems = append(problems, fmt.Sprintf("event %d has seq %d", i+1, e.Seq))
+			break
+		}
+	}
+	replayed := Replay(s.Events)
+	for _, e := range s.Events {
+		switch e.Type {
+		case eventUserCreated:
+			created[e.User.Currency] += e.User.Balance
+		case eventAdjusted:
+			created[replayed[e.UserID].Currency] += e.Amount
+		case eventTransferred, eventConverted:
+			transfers[e.TransactionID] += e.Amount
+		case eventRolledBack:
+			rolledBack[e.TransactionID] = true
+		}
+	}
+	for id := range rolledBack {
+		delete(transfers, id)
+	}
+
+	totals := make(map[string]float64)
+	for _, u := range s.Users {
+		r, ok := replayed[u.ID]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("user %s is saved but not in the event log", u.ID))
+			continue
+		}
+		if math.Abs(r.Balance-u.Balance) > ledgerTolerance {
+			problems = append(problems, fmt.Sprintf("user %s has saved balance %v but the event log gives %v", u.ID, u.Balance, r.Balance))
+		}
+		totals[u.Currency] += u.Balance
+	}
+	for currency, want := range created {
+		if got := totals[currency]; math.Abs(got-want) > ledgerTolerance*math.Max(1, math.Abs(want)) {
+			problems = append(problems, fmt.Sprintf("%s accounts hold %v but %v was created or adjusted in", currency, got, want))
+		}
+	}
+
+	for _, t := range s.Transactions {
+		if t.Status != statusCompleted || t.isSplit() {
+			continue
+		}
+		amount, ok := transfers[t.ID]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("completed transaction %s has no ledger entry", t.ID))
+		} else if math.Abs(amount-t.Amount) > ledgerTolerance {
+			problems = append(problems, fmt.Sprintf("transaction %s is for %v but the ledger moved %v", t.ID, t.Amount, amount))
+		}
+		delete(transfers, t.ID)
+	}
+	for id := range transfers {
+		problems = append(problems, fmt.Sprintf("ledger entry for transaction %s has no completed transaction", id))
+	}
+	return problems
+}
+
+// rejectWrites answers 503 to anything but reads in read-only mode. The
+// one write left open is POST /admin/import, so repaired state can be
+// loaded; exporting it and reading the audit log are reads.
+func rejectWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reimport := r.Method == "POST" && strings.TrimPrefix(r.URL.Path, apiPrefix) == "/admin/import"
+		if readOnly && r.Method != "GET" && r.Method != "HEAD" && !reimport {
+			writeError(w, 503, CodeReadOnly, "Server is read-only: saved state failed its integrity check")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
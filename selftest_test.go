@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeInconsistentState saves a store whose first user's saved balance
+// disagrees with the event log, and returns a clean store pointed at it.
+func writeInconsistentState(t *testing.T) []byte {
+	t.Helper()
+	resetStore(t)
+	path := filepath.Join(t.TempDir(), "state.json")
+	alice, bob := newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 10})
+	if err := saveState(path); err != nil {
+		t.Fatal(err)
+	}
+	s, err := readState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range s.Users {
+		if s.Users[i].ID == alice.ID {
+			s.Users[i].Balance += 500
+		}
+	}
+	data, _ := json.Marshal(s)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	resetStore(t)
+	stateFile = path
+	return data
+}
+
+func TestSelfTestPassesConsistentState(t *testing.T) {
+	resetStore(t)
+	stateFile = filepath.Join(t.TempDir(), "state.json")
+	alice, bob := newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: alice.ID, ReceiverID: bob.ID, Amount: 10})
+	if err := persistState(); err != nil {
+		t.Fatal(err)
+	}
+	if err := startupSelfTest(); err != nil || readOnly {
+		t.Errorf("consistent state: %v, read-only %v", err, readOnly)
+	}
+}
+
+func TestSelfTestRefusesInconsistentState(t *testing.T) {
+	writeInconsistentState(t)
+	if err := startupSelfTest(); err == nil {
+		t.Error("self-test passed a store that doesn't balance")
+	}
+	if readOnly {
+		t.Error("exit mode went read-only")
+	}
+
+	selfTest = false
+	if err := startupSelfTest(); err != nil || readOnly {
+		t.Errorf("with the self-test skipped: %v, read-only %v", err, readOnly)
+	}
+}
+
+func TestSelfTestReadOnlyMode(t *testing.T) {
+	saved := writeInconsistentState(t)
+	selfTestFailure = selfTestReadOnly
+	if err := startupSelfTest(); err != nil {
+		t.Fatalf("read-only mode refused to start: %v", err)
+	}
+	if !readOnly {
+		t.Fatal("failed self-test didn't start read-only")
+	}
+	if err := loadState(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	wantStatus(t, serve(t, "GET", "/user/1", nil), 200)
+	wantStatus(t, serve(t, "GET", "/admin/export", nil), 200)
+	wantStatus(t, serve(t, "GET", "/admin/audit", nil), 200)
+	// the store isn't empty, so import refuses rather than being blocked
+	wantStatus(t, serve(t, "POST", "/v1/admin/import", string(saved)), 409)
+	for _, c := range []struct {
+		method, path string
+		body         interface{}
+	}{
+		{"POST", "/transaction", Transaction{SenderID: "1", ReceiverID: "2", Amount: 1}},
+		{"POST", "/user", User{}},
+		{"PUT", "/user/1/threshold", map[string]float64{"threshold": 5}},
+		{"PUT", "/admin/blocklist/1", nil},
+		{"PUT", "/v1/admin/users/1/freeze", nil},
+		{"POST", "/admin/adjustments", Adjustment{UserID: "1", Amount: 5, Reason: "fix"}},
+	} {
+		w := serve(t, c.method, c.path, c.body)
+		var apiErr APIError
+		decode(t, w, &apiErr)
+		if w.Code != 503 || apiErr.Code != CodeReadOnly {
+			t.Errorf("%s %s while read-only: %d %+v", c.method, c.path, w.Code, apiErr)
+		}
+	}
+
+	if err := persistState(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(stateFile); !bytes.Equal(data, saved) {
+		t.Error("read-only mode saved over the state that failed the self-test")
+	}
+}
+
+// Read-only mode runs no workers or background jobs, since they would all
+// change the state that failed the self-test.
+func TestReadOnlyRunsNoJobs(t *testing.T) {
+	resetStore(t)
+	durability, settlementWindow, roundingInterval = durabilityAsync, time.Hour, time.Hour
+	names := func(jobs []backgroundJob) map[string]bool {
+		m := make(map[string]bool)
+		for _, j := range jobs {
+			m[j.name] = true
+		}
+		return m
+	}
+	running := names(append(workers(), backgroundJobs()...))
+	for _, name := range []string{"verification workers", "transaction workers", "state flusher", "settlement sweeper", "rounding job", "acceptance sweeper"} {
+		if !running[name] {
+			t.Errorf("%s not started normally; started %v", name, running)
+		}
+	}
+
+	readOnly = true
+	if jobs := append(workers(), backgroundJobs()...); len(jobs) != 0 {
+		t.Errorf("read-only mode starts %v", names(jobs))
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Server tuning, all settable by flag.
+var (
+	readTimeout       = 15 * time.Second
+	readHeaderTimeout = 5 * time.Second
+	writeTimeout      = 15 * time.Second
+	idleTimeout       = 60 * time.Second
+	maxHeaderBytes    = http.DefaultMaxHeaderBytes
+	// drainTimeout is how long shutdown waits for open connections to
+	// finish before closing them.
+	drainTimeout = 15 * time.Second
+)
+
+// connTracker counts connections that aren't idle or closed, so shutdown
+// can report what it is still waiting for.
+type connTracker struct {
+	mu     sync.Mutex
+	active map[net.Conn]bool
+}
+
+func (c *connTracker) track(conn net.Conn, state http.ConnState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch state {
+	case http.StateNew, http.StateActive:
+		c.active[conn] = true
+	default:
+		delete(c.active, conn)
+	}
+}
+
+func (c *connTracker) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.active)
+}
+
+var connections = &connTracker{active: make(map[net.Conn]bool)}
+
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler: handler,
+		Addr:    addr,
+		// Good practice: enforce timeouts for servers you create!
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+		ConnState:         connections.track,
+	}
+}
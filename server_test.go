@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer serves the router on a local port with the current tuning
+// and returns its address.
+func startServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(ln.Addr().String(), newRouter(apiPrefix, serveUnprefixed))
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+// closedWithin reports whether the server closes conn within d.
+func closedWithin(conn net.Conn, d time.Duration) bool {
+	conn.SetReadDeadline(time.Now().Add(d))
+	_, err := io.Copy(io.Discard, conn)
+	ne, ok := err.(net.Error)
+	return !ok || !ne.Timeout()
+}
+
+func TestReadHeaderTimeoutCutsOffSlowClients(t *testing.T) {
+	resetStore(t)
+	old := readHeaderTimeout
+	readHeaderTimeout = 50 * time.Millisecond
+	defer func() { readHeaderTimeout = old }()
+	addr := startServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /healthz HTTP/1.1\r\nHost: test\r\n")
+	if !closedWithin(conn, 2*time.Second) {
+		t.Error("connection with unfinished headers was still open after the timeout")
+	}
+}
+
+func TestIdleTimeoutClosesKeepAlives(t *testing.T) {
+	resetStore(t)
+	old := idleTimeout
+	idleTimeout = 50 * time.Millisecond
+	defer func() { idleTimeout = old }()
+	addr := startServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /healthz HTTP/1.1\r\nHost: test\r\n\r\n")
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("status %d, want 200", res.StatusCode)
+	}
+	if !closedWithin(conn, 2*time.Second) {
+		t.Error("idle keep-alive connection was still open after the timeout")
+	}
+}
+
+func TestMaxHeaderBytes(t *testing.T) {
+	resetStore(t)
+	old := maxHeaderBytes
+	maxHeaderBytes = 1024
+	defer func() { maxHeaderBytes = old }()
+	addr := startServer(t)
+
+	req, _ := http.NewRequest("GET", "http://"+addr+"/healthz", nil)
+	req.Header.Set("X-Padding", strings.Repeat("x", 8192))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("oversized headers: status %d, want 431", res.StatusCode)
+	}
+}
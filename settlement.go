@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	settlementSettling = "settling"
+	settlementSettled  = "settled"
+)
+
+// settlementWindow is how long a received credit stays unsettled before the
+// receiver can spend it. Zero makes credits available immediately.
+var settlementWindow time.Duration
+
+// available is what u can spend right now.
+func (u User) available() float64 {
+	return u.Balance - u.Unsettled - u.Held
+}
+
+// MarshalJSON adds available_balance, which is derived rather than stored,
+// so clients don't spend held or unsettled funds by mistake.
+func (u User) MarshalJSON() ([]byte, error) {
+	type plain User
+	return json.Marshal(struct {
+		plain
+		AvailableBalance float64 `json:"available_balance"`
+	}{plain(u), u.available()})
+}
+
+// startSettlement must be called with mu held, after the transfer's event
+// has been recorded.
+func startSettlement(t Transaction) {
+	if settlementWindow <= 0 {
+		return
+	}
+	settlesAt := time.Now().UTC().Add(settlementWindow)
+	txMu.Lock()
+	defer txMu.Unlock()
+	stored, ok := transactions[t.ID]
+	if !ok {
+		return
+	}
+	stored.Settlement = settlementSettling
+	stored.SettlesAt = &settlesAt
+	transactions[t.ID] = stored
+}
+
+// settleDue releases every credit whose window has passed and returns how
+// many were settled.
+func settleDue(now time.Time) int {
+	var due []Transaction
+	txMu.Lock()
+	for _, t := range transactions {
+		if t.Settlement == settlementSettling && !t.SettlesAt.After(now) {
+			due = append(due, t)
+		}
+	}
+	txMu.Unlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, t := range due {
+		recordEvent(Event{Type: eventSettled, UserID: creditHolder(t.ReceiverID), TransactionID: t.ID, Amount: t.credited()})
+		txMu.Lock()
+		stored := transactions[t.ID]
+		stored.Settlement = settlementSettled
+		transactions[t.ID] = stored
+		txMu.Unlock()
+	}
+	return len(due)
+}
+
+// creditHolder follows merges from id to the open account that now holds
+// its unsettled credits, since a merge moves them to the target. It must
+// be called with mu held.
+func creditHolder(id ID) ID {
+	for u, ok := db[id]; ok && u.Closed && u.MergedInto != ""; u, ok = db[id] {
+		id = u.MergedInto
+	}
+	return id
+}
+
+func runSettlementSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		settleDue(now)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCreditsSpendableOnceSettled(t *testing.T) {
+	resetStore(t)
+	settlementWindow = time.Hour
+	sender, receiver, onward := newUser(t, true), newUser(t, true), newUser(t, true)
+
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 500})
+	if got.Status != statusCompleted || got.Settlement != settlementSettling || got.SettlesAt == nil {
+		t.Fatalf("credit: status %s settlement %q settles_at %v", got.Status, got.Settlement, got.SettlesAt)
+	}
+	r, _ := getUser(receiver.ID)
+	if r.Balance != 1500 || r.Unsettled != 500 || r.available() != 1000 {
+		t.Errorf("receiver while settling: balance %v unsettled %v available %v", r.Balance, r.Unsettled, r.available())
+	}
+	if failed := transfer(t, Transaction{SenderID: receiver.ID, ReceiverID: onward.ID, Amount: 1200}); failed.Reason != string(CodeInsufficientFunds) {
+		t.Errorf("spending unsettled funds: status %s reason %q", failed.Status, failed.Reason)
+	}
+
+	if n := settleDue(time.Now()); n != 0 {
+		t.Fatalf("settled %d credits before the window passed", n)
+	}
+	if n := settleDue(time.Now().Add(settlementWindow)); n != 1 {
+		t.Fatalf("settled %d credits, want 1", n)
+	}
+	if got, _ := getTransaction(got.ID); got.Settlement != settlementSettled {
+		t.Errorf("settlement %q after the window, want settled", got.Settlement)
+	}
+	if ok := transfer(t, Transaction{SenderID: receiver.ID, ReceiverID: onward.ID, Amount: 1200}); ok.Status != statusCompleted {
+		t.Errorf("spending settled funds: status %s reason %q", ok.Status, ok.Reason)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxQueueWait sheds new transfers with a 503 once the estimated wait for
+// a newly queued transaction exceeds it. Zero disables shedding.
+var maxQueueWait time.Duration
+
+const throughputWindow = 30 // seconds
+
+// throughputMeter counts dequeued transactions in one-second buckets over
+// the last throughputWindow seconds.
+type throughputMeter struct {
+	mu      sync.Mutex
+	counts  [throughputWindow]int
+	seconds [throughputWindow]int64
+	first   int64
+}
+
+func (m *throughputMeter) mark(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sec := now.Unix()
+	if m.first == 0 {
+		m.first = sec
+	}
+	i := sec % throughputWindow
+	if m.seconds[i] != sec {
+		m.seconds[i] = sec
+		m.counts[i] = 0
+	}
+	m.counts[i]++
+}
+
+// rate is the average number of transactions per second over the window,
+// or over the time since the first mark if that is shorter.
+func (m *throughputMeter) rate(now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.first == 0 {
+		return 0
+	}
+	sec := now.Unix()
+	total := 0
+	for i, s := range m.seconds {
+		if sec-s < throughputWindow {
+			total += m.counts[i]
+		}
+	}
+	span := sec - m.first + 1
+	if span > throughputWindow {
+		span = throughputWindow
+	}
+	return float64(total) / float64(span)
+}
+
+var transactionThroughput = &throughputMeter{}
+
+// estimatedQueueWait is depth divided by recent throughput. With no recent
+// throughput to go on, the age of the oldest queued item stands in.
+func estimatedQueueWait(now time.Time) time.Duration {
+	depth := len(transactionQueue)
+	if depth == 0 {
+		return 0
+	}
+	oldest := transactionClock.oldestAge(now)
+	rate := transactionThroughput.rate(now)
+	if rate == 0 {
+		return oldest
+	}
+	wait := time.Duration(float64(depth) / rate * float64(time.Second))
+	if oldest > wait {
+		return oldest
+	}
+	return wait
+}
+
+// shedLoad reports whether a new transfer should be turned away and, if
+// so, the Retry-After value in whole seconds.
+func shedLoad(now time.Time) (string, bool) {
+	if maxQueueWait <= 0 {
+		return "", false
+	}
+	wait := estimatedQueueWait(now)
+	if wait <= maxQueueWait {
+		return "", false
+	}
+	return strconv.Itoa(int(math.Ceil(wait.Seconds()))), true
+}
+
+// QueuedTransaction is the Transfer response: the new transaction plus
+// where it sits in the queue. EstimatedWaitSeconds is omitted until there
+// is recent throughput to base it on.
+type QueuedTransaction struct {
+	Transaction
+	QueuePosition        int      `json:"queue_position"`
+	EstimatedWaitSeconds *float64 `json:"estimated_wait_seconds,omitempty"`
+}
+
+func queuedTransaction(t Transaction, seq int64, now time.Time) QueuedTransaction {
+	q := QueuedTransaction{Transaction: t, QueuePosition: transactionClock.position(seq)}
+	if rate := transactionThroughput.rate(now); rate > 0 {
+		wait := float64(q.QueuePosition) / rate
+		q.EstimatedWaitSeconds = &wait
+	}
+	return q
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestThroughputMeter(t *testing.T) {
+	m := &throughputMeter{}
+	start := time.Unix(1000, 0)
+	if r := m.rate(start); r != 0 {
+		t.Errorf("rate %v before any marks, want 0", r)
+	}
+	for i := 0; i < 10; i++ {
+		m.mark(start.Add(time.Duration(i) * time.Second))
+	}
+	if r := m.rate(start.Add(9 * time.Second)); r != 1 {
+		t.Errorf("rate %v after one a second for 10s, want 1", r)
+	}
+	// marks older than the window no longer count
+	if r := m.rate(start.Add((throughputWindow + 5) * time.Second)); r != 4.0/throughputWindow {
+		t.Errorf("rate %v once most marks have aged out, want %v", r, 4.0/throughputWindow)
+	}
+}
+
+func TestSaturatedQueueSheds(t *testing.T) {
+	resetStore(t)
+	maxQueueWait = time.Second
+	sender, receiver := newUser(t, true), newUser(t, true)
+	send := func() int {
+		w := serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 1}, "X-Allow-Duplicate", "true")
+		if w.Code == 503 {
+			var apiErr APIError
+			decode(t, w, &apiErr)
+			secs, err := strconv.Atoi(w.Header().Get("Retry-After"))
+			if apiErr.Code != CodeOverloaded || err != nil || secs < 5 {
+				t.Errorf("shed with %+v and Retry-After %q", apiErr, w.Header().Get("Retry-After"))
+			}
+		}
+		return w.Code
+	}
+
+	if code := send(); code != 200 {
+		t.Fatalf("healthy queue: status %d, want 200", code)
+	}
+	drainQueue(t)
+
+	// two transactions a second against a backlog of ten is a 5s wait
+	now := time.Now()
+	transactionThroughput = &throughputMeter{}
+	transactionThroughput.mark(now)
+	transactionThroughput.mark(now)
+	for i := 0; i < 10; i++ {
+		enqueueTransaction(addTransaction(Transaction{SenderID: receiver.ID, ReceiverID: sender.ID, Amount: 1, Currency: defaultCurrency}))
+	}
+	queued := len(transactionQueue)
+	if code := send(); code != 503 {
+		t.Errorf("saturated queue: status %d, want 503", code)
+	}
+	if len(transactionQueue) != queued {
+		t.Errorf("shed transfer was queued anyway")
+	}
+
+	drainQueue(t)
+	if code := send(); code != 200 {
+		t.Errorf("drained queue: status %d, want 200", code)
+	}
+}
+
+func TestTransferReportsQueuePosition(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	send := func() QueuedTransaction {
+		w := serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 1}, "X-Allow-Duplicate", "true")
+		wantStatus(t, w, 200)
+		var q QueuedTransaction
+		decode(t, w, &q)
+		return q
+	}
+
+	first := send()
+	if first.QueuePosition != 1 || first.EstimatedWaitSeconds != nil {
+		t.Errorf("first transfer: position %d, eta %v; want 1 and no eta without throughput", first.QueuePosition, first.EstimatedWaitSeconds)
+	}
+
+	// four transactions a second, or two once the clock ticks over into
+	// the next second
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		transactionThroughput.mark(now)
+	}
+	var last QueuedTransaction
+	for i := 2; i <= 5; i++ {
+		q := send()
+		if q.QueuePosition != i {
+			t.Errorf("transfer %d: position %d", i, q.QueuePosition)
+		}
+		if q.EstimatedWaitSeconds == nil || *q.EstimatedWaitSeconds <= 0 || *q.EstimatedWaitSeconds > float64(i)/2 {
+			t.Errorf("transfer %d: eta %v, want up to %vs", i, q.EstimatedWaitSeconds, float64(i)/2)
+		} else if last.EstimatedWaitSeconds != nil && *q.EstimatedWaitSeconds <= *last.EstimatedWaitSeconds {
+			t.Errorf("transfer %d: eta %v not after the previous %v", i, *q.EstimatedWaitSeconds, *last.EstimatedWaitSeconds)
+		}
+		last = q
+	}
+
+	// the head of the queue moving up moves everyone behind it
+	seq := transactionClock.pushed
+	processQueuedTransaction("test", <-transactionQueue)
+	if p := transactionClock.position(seq); p != 4 {
+		t.Errorf("last transfer at position %d after one was processed, want 4", p)
+	}
+	drainQueue(t)
+	if p := transactionClock.position(seq); p != 0 {
+		t.Errorf("position %d once processed, want 0", p)
+	}
+}
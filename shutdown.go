@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+var shuttingDown int32
+
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+func beginShutdown() {
+	atomic.StoreInt32(&shuttingDown, 1)
+}
+
+// waitForShutdown blocks until SIGINT/SIGTERM, then stops accepting new
+// transactions and drains open connections: idle keep-alives are closed
+// and in-flight requests get up to drainTimeout to finish before the rest
+// are cut off.
+func waitForShutdown(srv *http.Server) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	beginShutdown()
+	log.Printf("draining %d open connections", connections.count())
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v; closing %d connections", err, connections.count())
+		srv.Close()
+	}
+}
+
+// finishShutdown runs once the server has stopped: it saves the state and
+// pushes the run's final metrics, if either is configured.
+func finishShutdown() {
+	if stateFile != "" {
+		if err := persistState(); err != nil {
+			log.Println("saving state: ", err)
+		}
+	}
+	if pushgatewayURL != "" {
+		if err := pushMetrics(context.Background(), pushgatewayURL, pushgatewayJob); err != nil {
+			log.Println("pushing metrics: ", err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestTransfersRejectedDuringShutdown(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	beginShutdown()
+	defer atomic.StoreInt32(&shuttingDown, 0)
+
+	w := serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	wantStatus(t, w, 503)
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if apiErr.Code != CodeShuttingDown {
+		t.Errorf("transfer during shutdown: code %q", apiErr.Code)
+	}
+	wantStatus(t, serve(t, "POST", "/transaction/split", SplitRequest{SenderID: sender.ID, Legs: []SplitLeg{
+		{ReceiverID: receiver.ID, Amount: 10},
+	}}), 503)
+
+	if n := len(transactions); n != 0 {
+		t.Errorf("%d transactions stored during shutdown, want none", n)
+	}
+	if n := len(transactionQueue); n != 0 {
+		t.Errorf("%d transactions queued during shutdown, want none", n)
+	}
+	if balance(t, sender.ID) != 1000 || balance(t, receiver.ID) != 1000 {
+		t.Errorf("balances changed: %v, %v", balance(t, sender.ID), balance(t, receiver.ID))
+	}
+}
+
+// A transfer that panics once shutdown has begun is dead-lettered rather
+// than requeued onto a queue nobody will drain.
+func TestNoRequeueDuringShutdown(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	registerTransactionHook(&panicHook{times: 1})
+	tx := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10, Currency: defaultCurrency})
+	enqueueTransaction(tx)
+	beginShutdown()
+	defer atomic.StoreInt32(&shuttingDown, 0)
+
+	processQueuedTransaction("test", <-transactionQueue)
+	if n := len(transactionQueue); n != 0 {
+		t.Errorf("%d transactions requeued during shutdown", n)
+	}
+	got, _ := getTransaction(tx.ID)
+	if got.Status != statusFailed || got.Reason != string(CodeProcessingPanic) {
+		t.Errorf("panicked transfer: status %s reason %q", got.Status, got.Reason)
+	}
+}
+
+// Admin actions and verification callbacks that would queue a transfer
+// leave it where it is once shutdown has begun.
+func TestNothingQueuedDuringShutdown(t *testing.T) {
+	resetStore(t)
+	verificationSecret = "provider-secret"
+	registerTransactionHook(newFraudHook())
+	sender, receiver := newUser(t, true), newUser(t, true)
+	blocked := newUser(t, true)
+	setBlocked(blocked.ID, true)
+	failed := transfer(t, Transaction{SenderID: blocked.ID, ReceiverID: receiver.ID, Amount: 10})
+	held := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: fraudNewAccountLimit + 1})
+	unverified := newUser(t, false)
+	parked := transfer(t, Transaction{SenderID: unverified.ID, ReceiverID: receiver.ID, Amount: 10})
+	if failed.Status != statusFailed || held.Status != statusInReview || parked.Status != statusQueued {
+		t.Fatalf("setup: statuses %s, %s and %s", failed.Status, held.Status, parked.Status)
+	}
+	beginShutdown()
+	defer atomic.StoreInt32(&shuttingDown, 0)
+
+	for _, path := range []string{
+		"/admin/transaction/" + string(failed.ID) + "/retry",
+		"/admin/transaction/" + string(held.ID) + "/approve",
+	} {
+		w := serve(t, "POST", path, nil)
+		var apiErr APIError
+		decode(t, w, &apiErr)
+		if w.Code != 503 || apiErr.Code != CodeShuttingDown {
+			t.Errorf("POST %s during shutdown: %d %+v", path, w.Code, apiErr)
+		}
+	}
+	wantStatus(t, verificationCallback(t, unverified.ID, decisionApproved, verificationSecret), 200)
+
+	if n := len(transactionQueue); n != 0 {
+		t.Errorf("%d transactions queued during shutdown, want none", n)
+	}
+	if got, _ := getTransaction(failed.ID); got.RetriedBy != "" {
+		t.Errorf("failed transfer retried as %s during shutdown", got.RetriedBy)
+	}
+	if got, _ := getTransaction(held.ID); got.Status != statusInReview {
+		t.Errorf("held transfer: status %s, want it still in review", got.Status)
+	}
+	if got, _ := getTransaction(parked.ID); got.Status != statusQueued {
+		t.Errorf("released transfer: status %s, want it left queued for restart", got.Status)
+	}
+}
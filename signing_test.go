@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// signNow signs t as an upstream service would, stamped with the current
+// time and nonce.
+func signNow(t Transaction, nonce string) Transaction {
+	t.SignedAt, t.Nonce = time.Now().Unix(), nonce
+	t.Signature = signTransfer(t, signingSecret)
+	return t
+}
+
+func TestCanonicalTransferIsDeterministic(t *testing.T) {
+	min := 5.0
+	a := Transaction{SenderID: "1", ReceiverID: "2", Amount: 10.5, Currency: "USD", MinBalanceAfter: &min,
+		Metadata: map[string]string{"order": "A&1", "channel": "web", "b": "x=y"}}
+	b := a
+	b.Metadata = map[string]string{"b": "x=y", "channel": "web", "order": "A&1"}
+	if canonicalTransfer(a) != canonicalTransfer(b) || signTransfer(a, "s") != signTransfer(b, "s") {
+		t.Errorf("equal transfers canonicalize differently:\n%s\n%s", canonicalTransfer(a), canonicalTransfer(b))
+	}
+	if c := canonicalTransfer(a); !strings.Contains(c, "\nmetadata=b=x%3Dy&channel=web&order=A%261\n") || !strings.Contains(c, "\nmin_balance_after=5\n") {
+		t.Errorf("canonical form:\n%s", c)
+	}
+	b.Signature, b.Status = "ignored", statusFailed
+	if signTransfer(a, "s") != signTransfer(b, "s") {
+		t.Error("server-set fields changed the signature")
+	}
+	if signTransfer(a, "s") == signTransfer(a, "other") {
+		t.Error("the secret doesn't change the signature")
+	}
+}
+
+func TestSignedTransfers(t *testing.T) {
+	resetStore(t)
+	signingSecret = "upstream-secret"
+	sender, receiver := newUser(t, true), newUser(t, true)
+	signed := signNow(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 25, Currency: defaultCurrency}, "n1")
+
+	wantStatus(t, serve(t, "POST", "/transaction", signed), 200)
+	drainQueue(t)
+	if balance(t, receiver.ID) != 1025 {
+		t.Errorf("receiver balance %v after the signed transfer, want 1025", balance(t, receiver.ID))
+	}
+
+	tampered := signed
+	tampered.Amount = 2500
+	w := serve(t, "POST", "/transaction", tampered, "X-Allow-Duplicate", "true")
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if w.Code != 401 || apiErr.Code != CodeInvalidSignature {
+		t.Errorf("tampered amount: %d %+v", w.Code, apiErr)
+	}
+	if len(transactionQueue) != 0 {
+		t.Error("the tampered transfer was queued")
+	}
+
+	// unsigned transfers pass until signatures are required
+	unsigned := Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 1}
+	wantStatus(t, serve(t, "POST", "/transaction", unsigned), 200)
+	requireSignature = true
+	w = serve(t, "POST", "/transaction", unsigned, "X-Allow-Duplicate", "true")
+	decode(t, w, &apiErr)
+	if w.Code != 401 || apiErr.Code != CodeSignatureRequired {
+		t.Errorf("unsigned with signatures required: %d %+v", w.Code, apiErr)
+	}
+	wantStatus(t, serve(t, "POST", "/transaction", signNow(signed, "n2"), "X-Allow-Duplicate", "true"), 200)
+}
+
+func TestSignedTransfersCantBeReplayed(t *testing.T) {
+	resetStore(t)
+	signingSecret = "upstream-secret"
+	sender, receiver := newUser(t, true), newUser(t, true)
+	tx := Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 25, Currency: defaultCurrency}
+	signed := signNow(tx, "once")
+	wantStatus(t, serve(t, "POST", "/transaction", signed), 200)
+
+	stale := tx
+	stale.SignedAt, stale.Nonce = time.Now().Add(-signatureSkew-time.Minute).Unix(), "stale"
+	stale.Signature = signTransfer(stale, signingSecret)
+	early := tx
+	early.SignedAt, early.Nonce = time.Now().Add(signatureSkew+time.Minute).Unix(), "early"
+	early.Signature = signTransfer(early, signingSecret)
+	unstamped := tx
+	unstamped.Signature = signTransfer(unstamped, signingSecret)
+	for _, c := range []struct {
+		name string
+		tx   Transaction
+		want ErrorCode
+	}{
+		{"replayed", signed, CodeSignatureReplayed},
+		{"stale", stale, CodeSignatureExpired},
+		{"future", early, CodeSignatureExpired},
+		{"without signed_at or nonce", unstamped, CodeInvalidSignature},
+	} {
+		w := serve(t, "POST", "/transaction", c.tx, "X-Allow-Duplicate", "true")
+		var apiErr APIError
+		decode(t, w, &apiErr)
+		if w.Code != 401 || apiErr.Code != c.want {
+			t.Errorf("%s transfer: %d %+v, want 401 %s", c.name, w.Code, apiErr, c.want)
+		}
+	}
+	drainQueue(t)
+	if balance(t, receiver.ID) != 1025 {
+		t.Errorf("receiver balance %v, want 1025 from the one accepted transfer", balance(t, receiver.ID))
+	}
+
+	// the signature covers both, so neither can be swapped out
+	reused := signed
+	reused.Nonce = "fresh"
+	w := serve(t, "POST", "/transaction", reused, "X-Allow-Duplicate", "true")
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if w.Code != 401 || apiErr.Code != CodeInvalidSignature {
+		t.Errorf("changed nonce: %d %+v", w.Code, apiErr)
+	}
+}
+
+func TestSignedSplits(t *testing.T) {
+	resetStore(t)
+	signingSecret, requireSignature = "upstream-secret", true
+	sender, a, b := newUser(t, true), newUser(t, true), newUser(t, true)
+	req := SplitRequest{SenderID: sender.ID, Currency: defaultCurrency, Legs: []SplitLeg{{ReceiverID: a.ID, Amount: 10}, {ReceiverID: b.ID, Amount: 20}}}
+
+	wantStatus(t, serve(t, "POST", "/transaction/split", req), 401)
+	req.SignedAt, req.Nonce = time.Now().Unix(), "split"
+	req.Signature = signTransfer(req.signed(), signingSecret)
+	wantStatus(t, serve(t, "POST", "/transaction/split", req), 200)
+	wantStatus(t, serve(t, "POST", "/transaction/split", req), 401)
+
+	req.Legs[1].Amount = 200
+	w := serve(t, "POST", "/transaction/split", req)
+	var apiErr APIError
+	decode(t, w, &apiErr)
+	if w.Code != 401 || apiErr.Code != CodeInvalidSignature {
+		t.Errorf("tampered leg: %d %+v", w.Code, apiErr)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+const maxSimulatedTransfers = 10000
+
+type SimulationRequest struct {
+	// Users is the starting snapshot. When empty the current store is
+	// copied instead.
+	Users     []User        `json:"users,omitempty"`
+	Transfers []Transaction `json:"transfers"`
+}
+
+type SimulatedTransfer struct {
+	Index       int         `json:"index"`
+	Transaction Transaction `json:"transaction"`
+	Status      string      `json:"status"`
+	Reason      string      `json:"reason,omitempty"`
+}
+
+type SimulationResult struct {
+	Balances []User              `json:"balances"`
+	Results  []SimulatedTransfer `json:"results"`
+	Failures []SimulatedTransfer `json:"failures"`
+}
+
+// simulate applies transfers in order to a copy of users. Nothing outside
+// the copy is touched.
+func simulate(users map[ID]User, transfers []Transaction) SimulationResult {
+	res := SimulationResult{Results: []SimulatedTransfer{}, Failures: []SimulatedTransfer{}}
+	for i, t := range transfers {
+		sender, exists := users[t.SenderID]
+		if t.Currency == "" {
+			t.Currency = sender.Currency
+		}
+		st := SimulatedTransfer{Index: i, Transaction: t, Status: statusCompleted}
+		var err *APIError
+		switch {
+		case isBlocked(t.SenderID) || isBlocked(t.ReceiverID):
+			err = newError(CodeBlockedAccount, "Sender or receiver is blocked")
+		case verificationEnabled && exists && !sender.Verified:
+			err = newError(CodeSenderUnverified, "Sender is not verified")
+		default:
+			err = applyTransfer(users, t)
+		}
+		if err != nil {
+			st.Status = statusFailed
+			st.Reason = err.Error()
+			res.Failures = append(res.Failures, st)
+		}
+		res.Results = append(res.Results, st)
+	}
+
+	for _, u := range users {
+		res.Balances = append(res.Balances, u)
+	}
+	sort.Slice(res.Balances, func(i, j int) bool { return res.Balances[i].ID.less(res.Balances[j].ID) })
+	return res
+}
+
+func Simulate(w http.ResponseWriter, r *http.Request) {
+	var req SimulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, 400, CodeBadRequest, "Bad request")
+		return
+	}
+	if len(req.Transfers) > maxSimulatedTransfers {
+		writeError(w, 400, CodeBadRequest, "Too many transfers to simulate")
+		return
+	}
+
+	users := make(map[ID]User)
+	if len(req.Users) > 0 {
+		for _, u := range req.Users {
+			users[u.ID] = u
+		}
+	} else {
+		mu.RLock()
+		for id, u := range db {
+			users[id] = u
+		}
+		mu.RUnlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(simulate(users, req.Transfers))
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestSimulateLeavesStoreAlone(t *testing.T) {
+	resetStore(t)
+	a, b := newUser(t, true), newUser(t, true)
+	eventsBefore := len(events)
+
+	w := serve(t, "POST", "/admin/simulate", SimulationRequest{Transfers: []Transaction{
+		{SenderID: a.ID, ReceiverID: b.ID, Amount: 600},
+		{SenderID: a.ID, ReceiverID: b.ID, Amount: 600},
+		{SenderID: b.ID, ReceiverID: a.ID, Amount: 100},
+		{SenderID: a.ID, ReceiverID: "999", Amount: 1},
+	}})
+	wantStatus(t, w, 200)
+	var res SimulationResult
+	decode(t, w, &res)
+
+	projected := make(map[ID]float64)
+	for _, u := range res.Balances {
+		projected[u.ID] = u.Balance
+	}
+	if projected[a.ID] != 500 || projected[b.ID] != 1500 {
+		t.Errorf("projected balances %v, want %s=500 %s=1500", projected, a.ID, b.ID)
+	}
+	if len(res.Results) != 4 || len(res.Failures) != 2 {
+		t.Fatalf("results %+v, failures %+v", res.Results, res.Failures)
+	}
+	if f := res.Failures[0]; f.Index != 1 || f.Reason != string(CodeInsufficientFunds) {
+		t.Errorf("first failure %+v, want transfer 1 for insufficient funds", f)
+	}
+	if f := res.Failures[1]; f.Index != 3 || f.Reason != string(CodeReceiverNotFound) {
+		t.Errorf("second failure %+v, want transfer 3 for an unknown receiver", f)
+	}
+
+	if balance(t, a.ID) != 1000 || balance(t, b.ID) != 1000 {
+		t.Errorf("real balances changed: %v, %v", balance(t, a.ID), balance(t, b.ID))
+	}
+	if len(events) != eventsBefore || len(transactions) != 0 {
+		t.Errorf("simulation recorded %d events and %d transactions", len(events)-eventsBefore, len(transactions))
+	}
+}
+
+func TestSimulateFromSnapshot(t *testing.T) {
+	resetStore(t)
+	var res SimulationResult
+	decode(t, serve(t, "POST", "/admin/simulate", SimulationRequest{
+		Users: []User{
+			{ID: "payroll", Balance: 300, Verified: true, Currency: "USD"},
+			{ID: "alice", Verified: true, Currency: "USD"},
+			{ID: "bob", Verified: true, Currency: "USD"},
+		},
+		Transfers: []Transaction{
+			{SenderID: "payroll", ReceiverID: "alice", Amount: 200},
+			{SenderID: "payroll", ReceiverID: "bob", Amount: 200},
+		},
+	}), &res)
+	if len(res.Failures) != 1 || res.Failures[0].Transaction.ReceiverID != "bob" {
+		t.Errorf("failures %+v, want bob's payment", res.Failures)
+	}
+	if _, ok := getUser("payroll"); ok {
+		t.Error("snapshot users were added to the store")
+	}
+}
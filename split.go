@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// maxSplitLegs caps the receivers in one split transfer.
+const maxSplitLegs = 100
+
+// SplitLeg is one receiver's share of a split. TransactionID is the child
+// transaction created for it once the split goes through.
+type SplitLeg struct {
+	ReceiverID    ID      `json:"receiver_id"`
+	Amount        float64 `json:"amount"`
+	TransactionID ID      `json:"transaction_id,omitempty"`
+}
+
+type SplitRequest struct {
+	SenderID ID                `json:"sender_id"`
+	Currency string            `json:"currency"`
+	Category string            `json:"category,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Legs     []SplitLeg        `json:"legs"`
+	// Signature covers the request as a Transaction with these fields and
+	// no amount; see canonicalTransfer.
+	Signature string `json:"signature,omitempty"`
+	SignedAt  int64  `json:"signed_at,omitempty"`
+	Nonce     string `json:"nonce,omitempty"`
+}
+
+// signed is the transfer the request's signature is checked against.
+func (req SplitRequest) signed() Transaction {
+	return Transaction{
+		SenderID:  req.SenderID,
+		Currency:  req.Currency,
+		Category:  req.Category,
+		Metadata:  req.Metadata,
+		Legs:      req.Legs,
+		Signature: req.Signature,
+		SignedAt:  req.SignedAt,
+		Nonce:     req.Nonce,
+	}
+}
+
+// isSplit reports whether t is the parent of a split. Its amount is the
+// total; the money moves in its child transactions.
+func (t Transaction) isSplit() bool {
+	return len(t.Legs) > 0
+}
+
+func splitLeg(t Transaction, leg SplitLeg) Transaction {
+	return Transaction{
+		SenderID:   t.SenderID,
+		ReceiverID: leg.ReceiverID,
+		Amount:     leg.Amount,
+		Currency:   t.Currency,
+		Category:   t.Category,
+		Metadata:   t.Metadata,
+		SplitOf:    t.ID,
+	}
+}
+
+// processSplit applies every leg of t or none of them. Legs are first
+// tried on a scratch copy of the accounts involved, so a sender who can't
+// cover the total fails the whole split; a leg that still fails once
+// committed rolls back the legs before it. It must be called with mu held.
+func processSplit(t Transaction) error {
+	scratch := make(map[ID]User)
+	for _, id := range append([]ID{t.SenderID}, legReceivers(t)...) {
+		if u, ok := db[id]; ok {
+			scratch[id] = u
+		}
+	}
+	for i, leg := range t.Legs {
+		if err := applyTransfer(scratch, splitLeg(t, leg)); err != nil {
+			return failTransaction(t, newError(err.Code, fmt.Sprintf("Leg %d: %s", i, err.Message)))
+		}
+	}
+
+	legs := make([]SplitLeg, len(t.Legs))
+	paid := make([]map[ID]User, len(t.Legs))
+	for i, leg := range t.Legs {
+		child := addTransaction(splitLeg(t, leg))
+		setSplitOf(child.ID, t.ID)
+		paid[i] = touchedAccounts(child)
+		if err := commitTransfer(child); err != nil {
+			// newest first, so each leg's accounts are back where it
+			// found them
+			for j := i - 1; j >= 0; j-- {
+				rollBack(paid[j], legs[j].TransactionID)
+				unwindLeg(legs[j].TransactionID)
+			}
+			return failTransaction(t, newError(err.Code, fmt.Sprintf("Leg %d: %s", i, err.Message)))
+		}
+		leg.TransactionID = child.ID
+		legs[i] = leg
+	}
+	setSplitLegs(t.ID, legs)
+	completeTransaction(t)
+	return nil
+}
+
+func legReceivers(t Transaction) []ID {
+	ids := make([]ID, len(t.Legs))
+	for i, leg := range t.Legs {
+		ids[i] = leg.ReceiverID
+	}
+	return ids
+}
+
+// unwindLeg fails a committed leg whose funds were rolled back with the
+// rest of its split, and takes it out of settlement so the sweeper doesn't
+// release a credit that no longer exists.
+func unwindLeg(id ID) {
+	txMu.Lock()
+	if t, ok := transactions[id]; ok {
+		t.Settlement = ""
+		t.SettlesAt = nil
+		transactions[id] = t
+	}
+	txMu.Unlock()
+	setTransactionStatus(id, statusFailed, string(CodeSplitRolledBack))
+}
+
+func setSplitOf(id, parent ID) {
+	txMu.Lock()
+	defer txMu.Unlock()
+	if t, ok := transactions[id]; ok {
+		t.SplitOf = parent
+		transactions[id] = t
+	}
+}
+
+func setSplitLegs(id ID, legs []SplitLeg) {
+	txMu.Lock()
+	defer txMu.Unlock()
+	if t, ok := transactions[id]; ok {
+		t.Legs = legs
+		transactions[id] = t
+	}
+}
+
+// SplitTransfer queues a one-to-many payout as a single transaction.
+func SplitTransfer(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseResponseOptions(r, transactionFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	var req SplitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, 400, CodeBadRequest, "Bad request")
+		return
+	}
+	if err := checkSignature(req.signed()); err != nil {
+		writeAPIError(w, 401, err)
+		return
+	}
+	if len(req.Legs) == 0 || len(req.Legs) > maxSplitLegs {
+		writeError(w, 400, CodeBadRequest, fmt.Sprintf("A split needs between 1 and %d legs", maxSplitLegs))
+		return
+	}
+	if req.Currency == "" {
+		if sender, ok := getUser(req.SenderID); ok {
+			req.Currency = sender.Currency
+		} else {
+			req.Currency = defaultCurrency
+		}
+	}
+	total := 0.0
+	for i := range req.Legs {
+		leg := &req.Legs[i]
+		leg.TransactionID = ""
+		if leg.ReceiverID == "" {
+			writeError(w, 400, CodeBadRequest, fmt.Sprintf("Leg %d has no receiver_id", i))
+			return
+		}
+		if !(leg.Amount > 0) || math.IsInf(leg.Amount, 0) {
+			writeError(w, 400, CodeInvalidAmount, fmt.Sprintf("Leg %d amount must be a positive number", i))
+			return
+		}
+		if err := checkPrecision(leg.Amount, req.Currency); err != nil {
+			writeAPIError(w, 400, err)
+			return
+		}
+		total += leg.Amount
+	}
+	if math.IsInf(total, 0) {
+		writeError(w, 400, CodeInvalidAmount, "Split total is too large")
+		return
+	}
+	if err := checkMetadata(req.Metadata); err != nil {
+		writeAPIError(w, 400, err)
+		return
+	}
+	if req.Category != "" && !categories[req.Category] {
+		writeError(w, 400, CodeInvalidCategory, "Unknown category")
+		return
+	}
+
+	if isShuttingDown() {
+		writeError(w, 503, CodeShuttingDown, "Server is shutting down. Try again later")
+		return
+	}
+	if retryAfter, shed := shedLoad(time.Now()); shed {
+		w.Header().Set("Retry-After", retryAfter)
+		writeError(w, 503, CodeOverloaded, "Transaction queue is backed up. Try again later")
+		return
+	}
+	if !transferLimiter.allow(req.SenderID, time.Now()) {
+		writeError(w, 429, CodeUserRateLimited, "Too many transfers from this user. Try again later")
+		return
+	}
+	t := Transaction{
+		SenderID: req.SenderID,
+		Amount:   roundToPrecision(total, req.Currency),
+		Currency: req.Currency,
+		Category: req.Category,
+		Metadata: req.Metadata,
+		Legs:     req.Legs,
+	}
+	if needsConfirmation(t) {
+		requestConfirmation(w, t)
+		return
+	}
+	enqueueTransfer(w, opts, t)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitOverBalanceFailsWhole(t *testing.T) {
+	resetStore(t)
+	sender, a, b := newUser(t, true), newUser(t, true), newUser(t, true)
+
+	w := serve(t, "POST", "/transaction/split", SplitRequest{SenderID: sender.ID, Legs: []SplitLeg{
+		{ReceiverID: a.ID, Amount: 600},
+		{ReceiverID: b.ID, Amount: 600},
+	}})
+	wantStatus(t, w, 200)
+	var queued Transaction
+	decode(t, w, &queued)
+	drainQueue(t)
+
+	got, _ := getTransaction(queued.ID)
+	if got.Status != statusFailed || got.Reason != string(CodeInsufficientFunds) {
+		t.Errorf("split: status %s reason %q", got.Status, got.Reason)
+	}
+	for _, id := range []ID{sender.ID, a.ID, b.ID} {
+		if balance(t, id) != 1000 {
+			t.Errorf("user %s has %v after a failed split", id, balance(t, id))
+		}
+	}
+	if n := len(transactions); n != 1 {
+		t.Errorf("%d transactions, want only the failed parent", n)
+	}
+}
+
+func TestSplitPaysEveryLeg(t *testing.T) {
+	resetStore(t)
+	sender, a, b := newUser(t, true), newUser(t, true), newUser(t, true)
+	got := transfer(t, Transaction{SenderID: sender.ID, Amount: 50, Legs: []SplitLeg{
+		{ReceiverID: a.ID, Amount: 20},
+		{ReceiverID: b.ID, Amount: 30},
+	}})
+	if got.Status != statusCompleted {
+		t.Fatalf("split: status %s reason %q", got.Status, got.Reason)
+	}
+	for _, leg := range got.Legs {
+		child, ok := getTransaction(leg.TransactionID)
+		if !ok || child.SplitOf != got.ID || child.Status != statusCompleted {
+			t.Errorf("leg %+v has child %+v", leg, child)
+		}
+	}
+	if balance(t, sender.ID) != 950 || balance(t, a.ID) != 1020 || balance(t, b.ID) != 1030 {
+		t.Errorf("balances %v, %v, %v", balance(t, sender.ID), balance(t, a.ID), balance(t, b.ID))
+	}
+}
+
+// Legs sent to POST /transaction are dropped rather than skipping the
+// split endpoint's checks.
+func TestTransferIgnoresLegs(t *testing.T) {
+	resetStore(t)
+	sender, receiver, other := newUser(t, true), newUser(t, true), newUser(t, true)
+	w := serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10,
+		Legs: []SplitLeg{{ReceiverID: other.ID, Amount: 10}}})
+	wantStatus(t, w, 200)
+	var queued Transaction
+	decode(t, w, &queued)
+	drainQueue(t)
+
+	got, _ := getTransaction(queued.ID)
+	if got.isSplit() || got.Status != statusCompleted {
+		t.Errorf("transfer with legs: %+v", got)
+	}
+	if balance(t, receiver.ID) != 1010 || balance(t, other.ID) != 1000 {
+		t.Errorf("receiver %v, leg receiver %v", balance(t, receiver.ID), balance(t, other.ID))
+	}
+}
+
+func TestSignatureCoversLegs(t *testing.T) {
+	signed := Transaction{SenderID: "1", Amount: 10, Legs: []SplitLeg{{ReceiverID: "2", Amount: 10}}}
+	tampered := signed
+	tampered.Legs = []SplitLeg{{ReceiverID: "3", Amount: 10}}
+	if signTransfer(signed, "secret") == signTransfer(tampered, "secret") {
+		t.Error("changing a leg's receiver kept the signature")
+	}
+}
+
+// A leg that fails once committed takes the legs already paid back with it
+// and fails the parent.
+func TestSplitLegFailureRollsBackEarlierLegs(t *testing.T) {
+	resetStore(t)
+	settlementWindow = time.Hour
+	checkInvariants, rollbackOnViolation = true, true
+	sender, a, b, c := newUser(t, true), newUser(t, true), newUser(t, true), newUser(t, true)
+	injectFault(t, func(users map[ID]User, e Event) {
+		if e.Type == eventTransferred && e.ReceiverID == b.ID {
+			u := users[b.ID]
+			u.Balance--
+			users[b.ID] = u
+		}
+	})
+
+	got := transfer(t, Transaction{SenderID: sender.ID, Amount: 60, Legs: []SplitLeg{
+		{ReceiverID: a.ID, Amount: 10},
+		{ReceiverID: b.ID, Amount: 20},
+		{ReceiverID: c.ID, Amount: 30},
+	}})
+	if got.Status != statusFailed || got.Reason != string(CodeInvariantViolation) {
+		t.Fatalf("split: status %s reason %q", got.Status, got.Reason)
+	}
+	for _, id := range []ID{sender.ID, a.ID, b.ID, c.ID} {
+		if u, _ := getUser(id); u.Balance != 1000 || u.Unsettled != 0 {
+			t.Errorf("user %s has %v, %v unsettled after a rolled back split", id, u.Balance, u.Unsettled)
+		}
+	}
+	var children []Transaction
+	for _, tx := range transactions {
+		if tx.SplitOf == got.ID {
+			children = append(children, tx)
+		}
+	}
+	if len(children) != 2 {
+		t.Fatalf("%d legs committed, want the first two", len(children))
+	}
+	for _, child := range children {
+		if child.Status != statusFailed || child.Settlement != "" {
+			t.Errorf("leg %s after rollback: status %s settlement %q", child.ID, child.Status, child.Settlement)
+		}
+	}
+	if n := settleDue(time.Now().Add(2 * time.Hour)); n != 0 {
+		t.Errorf("%d rolled back legs settled", n)
+	}
+	if problems := checkLedger(snapshotState()); len(problems) > 0 {
+		t.Errorf("self-test problems after rollback: %v", problems)
+	}
+}
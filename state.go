@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// stateFile is where users and transactions are saved on shutdown and
+// reloaded from on startup. Empty, the default, keeps everything in memory
+// only.
+var stateFile = ""
+
+// State is a full snapshot. When Events is present it is authoritative and
+// Users is only informational; older snapshots without events are loaded
+// from Users directly.
+type State struct {
+	Users        []User        `json:"users"`
+	Transactions []Transaction `json:"transactions"`
+	Events       []Event       `json:"events,omitempty"`
+}
+
+// snapshotState holds mu throughout so it never sees a transaction that is
+// half applied, such as a split whose children are being created.
+func snapshotState() State {
+	var s State
+	mu.RLock()
+	for _, u := range db {
+		s.Users = append(s.Users, u)
+	}
+	s.Events = make([]Event, len(events))
+	copy(s.Events, events)
+	txMu.Lock()
+	for _, t := range transactions {
+		s.Transactions = append(s.Transactions, t)
+	}
+	txMu.Unlock()
+	mu.RUnlock()
+	sort.Slice(s.Users, func(i, j int) bool { return s.Users[i].ID.less(s.Users[j].ID) })
+	sort.Slice(s.Transactions, func(i, j int) bool { return s.Transactions[i].ID.less(s.Transactions[j].ID) })
+	return s
+}
+
+func saveState(path string) error {
+	data, err := json.Marshal(snapshotState())
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readState(path string) (State, error) {
+	var s State
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+// restoreState replaces the in-memory store with s. Anything that was still
+// waiting when it was saved is put back on its queue, so workers must
+// already be running if there may be more than a queue's worth.
+func restoreState(s State) {
+	mu.Lock()
+	if len(s.Events) > 0 {
+		events = s.Events
+		db = Replay(events)
+	} else {
+		events = nil
+		db = make(map[ID]User, len(s.Users))
+		for _, u := range s.Users {
+			u := u
+			recordEvent(Event{Type: eventUserCreated, UserID: u.ID, User: &u})
+		}
+	}
+	users := make([]User, 0, len(db))
+	for _, u := range db {
+		userIDs.Observe(u.ID)
+		users = append(users, u)
+	}
+	mu.Unlock()
+	ensureReserves()
+	txMu.Lock()
+	transactions = make(map[ID]Transaction, len(s.Transactions))
+	for _, t := range s.Transactions {
+		transactionIDs.Observe(t.ID)
+		transactions[t.ID] = t
+	}
+	reindexTransactions()
+	txMu.Unlock()
+
+	// Read-only mode leaves queued work where it is, unprocessed
+	if readOnly {
+		return
+	}
+	for _, u := range users {
+		if !u.Verified {
+			addToVerificationQueue(u)
+		}
+	}
+	for _, t := range s.Transactions {
+		if t.Status == statusQueued {
+			enqueueTransaction(t)
+		}
+	}
+}
+
+// loadState restores the snapshot at path along with any transfers sync
+// durability journaled after it.
+func loadState(path string) error {
+	s, err := readState(path)
+	if err != nil {
+		return err
+	}
+	journal, err := readJournal(path + ".journal")
+	if err != nil {
+		return err
+	}
+	restoreState(withJournal(s, journal))
+	return nil
+}
+
+// validateState checks IDs are unique and every transaction refers to
+// users that are part of the same state.
+func validateState(s State) error {
+	list := s.Users
+	if len(s.Events) > 0 {
+		list = nil
+		for _, u := range Replay(s.Events) {
+			list = append(list, u)
+		}
+	}
+	users := make(map[ID]bool, len(list))
+	for _, u := range list {
+		if users[u.ID] {
+			return fmt.Errorf("duplicate user id %s", u.ID)
+		}
+		users[u.ID] = true
+	}
+	txs := make(map[ID]bool, len(s.Transactions))
+	for _, t := range s.Transactions {
+		if txs[t.ID] {
+			return fmt.Errorf("duplicate transaction id %s", t.ID)
+		}
+		txs[t.ID] = true
+		// A failed transaction moved nothing, and may have failed because
+		// it was malformed or named a user that doesn't exist.
+		if t.Status == statusFailed {
+			continue
+		}
+		receivers := []ID{t.ReceiverID}
+		if t.isSplit() {
+			receivers = legReceivers(t)
+		}
+		for _, id := range append(receivers, t.SenderID) {
+			if !users[id] {
+				return fmt.Errorf("transaction %s references an unknown user", t.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// storeIsEmpty ignores reserve accounts, which always exist.
+func storeIsEmpty() bool {
+	mu.RLock()
+	users := len(db) - len(systemAccounts)
+	mu.RUnlock()
+	txMu.Lock()
+	defer txMu.Unlock()
+	return users == 0 && len(transactions) == 0
+}
+
+func ExportState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshotState())
+}
+
+// ImportState loads a document produced by ExportState. It refuses to
+// replace existing data unless ?force=true.
+func ImportState(w http.ResponseWriter, r *http.Request) {
+	var s State
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		writeError(w, 400, CodeBadRequest, "Bad request")
+		return
+	}
+	if err := validateState(s); err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	if r.URL.Query().Get("force") != "true" && !storeIsEmpty() {
+		writeError(w, 409, CodeStoreNotEmpty, "Store is not empty; pass force=true to overwrite")
+		return
+	}
+	before := snapshotState()
+	restoreState(s)
+	after := snapshotState()
+	recordAudit(r, "state.import", "",
+		map[string]int{"users": len(before.Users), "transactions": len(before.Transactions)},
+		map[string]int{"users": len(after.Users), "transactions": len(after.Transactions)})
+	w.WriteHeader(204)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// Work still queued when state is saved is processed after a restart.
+func TestRestartRequeuesQueuedWork(t *testing.T) {
+	resetStore(t)
+	path := filepath.Join(t.TempDir(), "state.json")
+	sender, receiver := newUser(t, true), newUser(t, true)
+	done := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 5})
+	pending := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 7, Currency: defaultCurrency})
+	if err := saveState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	resetStore(t)
+	if err := loadState(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(transactionQueue); n != 1 {
+		t.Fatalf("%d transactions requeued, want 1", n)
+	}
+	drainQueue(t)
+	if got, _ := getTransaction(pending.ID); got.Status != statusCompleted {
+		t.Errorf("requeued transfer: status %s reason %q", got.Status, got.Reason)
+	}
+	if got, _ := getTransaction(done.ID); got.Status != statusCompleted || got.Attempts != 1 {
+		t.Errorf("completed transfer was reprocessed: %+v", got)
+	}
+	if balance(t, receiver.ID) != 1012 {
+		t.Errorf("receiver balance %v, want 1012", balance(t, receiver.ID))
+	}
+	if next := addTransaction(Transaction{SenderID: sender.ID}); next.ID == pending.ID || next.ID == done.ID {
+		t.Errorf("restored store reused transaction ID %s", next.ID)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	resetStore(t)
+	a, b := newUser(t, true), newUser(t, true)
+	transfer(t, Transaction{SenderID: a.ID, ReceiverID: b.ID, Amount: 25, Category: "groceries"})
+	transfer(t, Transaction{SenderID: b.ID, ReceiverID: a.ID, Amount: 5000})
+	newUser(t, false)
+	w := serve(t, "GET", "/admin/export", nil)
+	wantStatus(t, w, 200)
+	exported := w.Body.String()
+
+	resetStore(t)
+	wantStatus(t, serve(t, "POST", "/admin/import", exported), 204)
+	if again := serve(t, "GET", "/admin/export", nil).Body.String(); again != exported {
+		t.Errorf("state after import differs:\n got %s\nwant %s", again, exported)
+	}
+	if balance(t, b.ID) != 1025 {
+		t.Errorf("imported balance %v, want 1025", balance(t, b.ID))
+	}
+
+	wantStatus(t, serve(t, "POST", "/admin/import", exported), 409)
+	wantStatus(t, serve(t, "POST", "/admin/import?force=true", exported), 204)
+}
+
+func TestImportChecksReferences(t *testing.T) {
+	resetStore(t)
+	s := State{
+		Users:        []User{{ID: "1", Balance: 10, Currency: defaultCurrency}},
+		Transactions: []Transaction{{ID: "1", SenderID: "1", ReceiverID: "2", Amount: 1, Status: statusCompleted}},
+	}
+	wantStatus(t, serve(t, "POST", "/admin/import", s), 400)
+	if !storeIsEmpty() {
+		t.Error("a rejected import changed the store")
+	}
+}
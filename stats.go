@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const maxVolumeBuckets = 10000
+
+type VolumeBucket struct {
+	Start  time.Time `json:"start"`
+	Amount float64   `json:"amount"`
+	Count  int       `json:"count"`
+}
+
+type VolumeStats struct {
+	GroupBy     string         `json:"group_by"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	TotalAmount float64        `json:"total_amount"`
+	TotalCount  int            `json:"total_count"`
+	Buckets     []VolumeBucket `json:"buckets"`
+}
+
+var bucketSteps = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+// bucketStart truncates t (in UTC) to the start of its hour, day or
+// ISO week (Monday).
+func bucketStart(t time.Time, groupBy string) time.Time {
+	t = t.UTC()
+	switch groupBy {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// transferVolume buckets completed transactions in [from, to). Every bucket
+// in the range is present, including ones with no transfers.
+func transferVolume(from, to time.Time, groupBy string) VolumeStats {
+	step := bucketSteps[groupBy]
+	stats := VolumeStats{GroupBy: groupBy, From: from.UTC(), To: to.UTC(), Buckets: []VolumeBucket{}}
+	index := make(map[time.Time]int)
+	for b := bucketStart(from, groupBy); b.Before(to); b = b.Add(step) {
+		index[b] = len(stats.Buckets)
+		stats.Buckets = append(stats.Buckets, VolumeBucket{Start: b})
+	}
+
+	txMu.Lock()
+	defer txMu.Unlock()
+	for _, t := range transactions {
+		if t.Status != statusCompleted || t.isSplit() || t.CompletedAt.Before(from) || !t.CompletedAt.Before(to) {
+			continue
+		}
+		i := index[bucketStart(*t.CompletedAt, groupBy)]
+		stats.Buckets[i].Amount += t.Amount
+		stats.Buckets[i].Count++
+		stats.TotalAmount += t.Amount
+		stats.TotalCount++
+	}
+	return stats
+}
+
+func GetVolumeStats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, err := time.Parse(time.RFC3339, q.Get("from"))
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, "from must be RFC3339")
+		return
+	}
+	to, err := time.Parse(time.RFC3339, q.Get("to"))
+	if err != nil || !to.After(from) {
+		writeError(w, 400, CodeBadRequest, "to must be RFC3339 and after from")
+		return
+	}
+	groupBy := q.Get("group_by")
+	if groupBy == "" {
+		groupBy = "day"
+	}
+	step, ok := bucketSteps[groupBy]
+	if !ok {
+		writeError(w, 400, CodeBadRequest, "group_by must be hour, day or week")
+		return
+	}
+	if to.Sub(from)/step > maxVolumeBuckets {
+		writeError(w, 400, CodeBadRequest, "range has too many buckets")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transferVolume(from, to, groupBy))
+}
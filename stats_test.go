@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVolumeBucketsByDay(t *testing.T) {
+	resetStore(t)
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, c := range []struct {
+		at     time.Time
+		amount float64
+		status string
+	}{
+		{day.Add(1 * time.Hour), 10, statusCompleted},
+		{day.Add(23 * time.Hour), 5, statusCompleted},
+		{day.Add(2*24*time.Hour + time.Hour), 7, statusCompleted},
+		{day.Add(2 * time.Hour), 100, statusFailed},
+		{day.Add(-time.Hour), 100, statusCompleted},
+	} {
+		at := c.at
+		id := ID(string(rune('a' + i)))
+		transactions[id] = Transaction{ID: id, Amount: c.amount, Status: c.status, CreatedAt: at, CompletedAt: &at}
+	}
+
+	w := serve(t, "GET", "/stats/volume?from=2024-03-01T00:00:00Z&to=2024-03-04T00:00:00Z&group_by=day", nil)
+	wantStatus(t, w, 200)
+	var stats VolumeStats
+	decode(t, w, &stats)
+	want := []VolumeBucket{{day, 15, 2}, {day.AddDate(0, 0, 1), 0, 0}, {day.AddDate(0, 0, 2), 7, 1}}
+	if len(stats.Buckets) != len(want) {
+		t.Fatalf("buckets %+v, want %+v", stats.Buckets, want)
+	}
+	for i, b := range stats.Buckets {
+		if !b.Start.Equal(want[i].Start) || b.Amount != want[i].Amount || b.Count != want[i].Count {
+			t.Errorf("bucket %d is %+v, want %+v", i, b, want[i])
+		}
+	}
+	if stats.TotalAmount != 22 || stats.TotalCount != 3 {
+		t.Errorf("totals %v over %d, want 22 over 3", stats.TotalAmount, stats.TotalCount)
+	}
+}
+
+func TestVolumeRejectsBadRanges(t *testing.T) {
+	resetStore(t)
+	for _, q := range []string{
+		"from=2024-03-02T00:00:00Z&to=2024-03-01T00:00:00Z",
+		"from=yesterday&to=2024-03-01T00:00:00Z",
+		"from=2024-03-01T00:00:00Z&to=2024-03-02T00:00:00Z&group_by=minute",
+		"from=1000-01-01T00:00:00Z&to=2024-03-01T00:00:00Z&group_by=hour",
+	} {
+		wantStatus(t, serve(t, "GET", "/stats/volume?"+q, nil), 400)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const uncategorized = "other"
+
+var categories = map[string]bool{
+	"groceries":     true,
+	"rent":          true,
+	"salary":        true,
+	"utilities":     true,
+	"transport":     true,
+	"entertainment": true,
+	uncategorized:   true,
+}
+
+type CategoryTotal struct {
+	Category string  `json:"category"`
+	Amount   float64 `json:"amount"`
+	Count    int     `json:"count"`
+}
+
+type SpendingSummary struct {
+	UserID     ID              `json:"user_id"`
+	From       *time.Time      `json:"from,omitempty"`
+	To         *time.Time      `json:"to,omitempty"`
+	Total      float64         `json:"total"`
+	Categories []CategoryTotal `json:"categories"`
+}
+
+// parseRange reads optional RFC3339 from/to query parameters.
+func parseRange(r *http.Request) (from, to *time.Time, err error) {
+	q := r.URL.Query()
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, nil, err
+		}
+		from = &t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, nil, err
+		}
+		to = &t
+	}
+	return from, to, nil
+}
+
+// spendingSummary totals the user's completed outgoing transfers by
+// category over [from, to). Transfers without a category count as "other".
+// Transfers sent by accounts merged into the user are included.
+func spendingSummary(userID ID, from, to *time.Time) SpendingSummary {
+	sum := SpendingSummary{UserID: userID, From: from, To: to, Categories: []CategoryTotal{}}
+	totals := make(map[string]*CategoryTotal)
+	accounts := mergedAccounts(userID)
+
+	txMu.Lock()
+	for _, t := range transactions {
+		if !accounts[t.SenderID] || t.Status != statusCompleted || t.isSplit() {
+			continue
+		}
+		if (from != nil && t.CompletedAt.Before(*from)) || (to != nil && !t.CompletedAt.Before(*to)) {
+			continue
+		}
+		c := t.Category
+		if c == "" {
+			c = uncategorized
+		}
+		if totals[c] == nil {
+			totals[c] = &CategoryTotal{Category: c}
+		}
+		totals[c].Amount += t.Amount
+		totals[c].Count++
+		sum.Total += t.Amount
+	}
+	txMu.Unlock()
+
+	for _, ct := range totals {
+		sum.Categories = append(sum.Categories, *ct)
+	}
+	sort.Slice(sum.Categories, func(i, j int) bool { return sum.Categories[i].Category < sum.Categories[j].Category })
+	return sum
+}
+
+func GetUserSummary(w http.ResponseWriter, r *http.Request) {
+	id := ID(mux.Vars(r)["id"])
+	from, to, err := parseRange(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, "from and to must be RFC3339")
+		return
+	}
+	if _, ok := getUser(id); !ok {
+		writeError(w, 404, CodeUserNotFound, "User not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(spendingSummary(id, from, to))
+}
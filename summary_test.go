@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestSpendingSummaryByCategory(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	for _, tx := range []Transaction{
+		{Amount: 10, Category: "groceries"},
+		{Amount: 15, Category: "groceries"},
+		{Amount: 500, Category: "rent"},
+		{Amount: 3},
+		{Amount: 4},
+		{Amount: 9000, Category: "rent"}, // fails, so not counted
+	} {
+		tx.SenderID, tx.ReceiverID = sender.ID, receiver.ID
+		transfer(t, tx)
+	}
+	transfer(t, Transaction{SenderID: receiver.ID, ReceiverID: sender.ID, Amount: 7, Category: "salary"})
+
+	w := serve(t, "GET", "/user/"+string(sender.ID)+"/summary", nil)
+	wantStatus(t, w, 200)
+	var sum SpendingSummary
+	decode(t, w, &sum)
+	want := map[string]CategoryTotal{
+		"groceries":   {"groceries", 25, 2},
+		"rent":        {"rent", 500, 1},
+		uncategorized: {uncategorized, 7, 2},
+	}
+	if len(sum.Categories) != len(want) {
+		t.Fatalf("categories %+v, want %+v", sum.Categories, want)
+	}
+	for _, c := range sum.Categories {
+		if c != want[c.Category] {
+			t.Errorf("category %+v, want %+v", c, want[c.Category])
+		}
+	}
+	if sum.Total != 532 {
+		t.Errorf("total %v, want 532", sum.Total)
+	}
+
+	w = serve(t, "GET", "/user/"+string(sender.ID)+"/summary?from=2999-01-01T00:00:00Z", nil)
+	wantStatus(t, w, 200)
+	decode(t, w, &sum)
+	if sum.Total != 0 || len(sum.Categories) != 0 {
+		t.Errorf("summary of a future range: %+v", sum)
+	}
+	wantStatus(t, serve(t, "GET", "/user/"+string(sender.ID)+"/summary?from=soon", nil), 400)
+	wantStatus(t, serve(t, "GET", "/user/999/summary", nil), 404)
+}
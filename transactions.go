@@ -0,0 +1,254 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	statusQueued    = "queued"
+	statusCompleted = "completed"
+	statusFailed    = "failed"
+	// statusAwaitingAcceptance: the sender's funds are held until the
+	// receiver accepts or rejects.
+	statusAwaitingAcceptance = "awaiting_acceptance"
+	// statusInReview: a hook flagged the transfer and it waits, unapplied,
+	// for an admin to approve or reject it.
+	statusInReview = "in_review"
+)
+
+var txMu sync.Mutex
+var transactions map[ID]Transaction
+
+// transactionOrder lists every transaction ID in creation order: by
+// CreatedAt, and by ID among those created in the same instant. It is
+// guarded by txMu and lets exports page through the store without
+// sorting it.
+var transactionOrder []ID
+
+func createdBefore(a, b Transaction) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID.less(b.ID)
+}
+
+// firstCreatedAfter returns the position in transactionOrder of the first
+// transaction created after t. It must be called with txMu held.
+func firstCreatedAfter(t Transaction) int {
+	return sort.Search(len(transactionOrder), func(i int) bool {
+		return createdBefore(t, transactions[transactionOrder[i]])
+	})
+}
+
+// indexTransaction must be called with txMu held, after t is stored. New
+// transactions go at the end unless the clock has stepped back.
+func indexTransaction(t Transaction) {
+	i := firstCreatedAfter(t)
+	transactionOrder = append(transactionOrder, "")
+	copy(transactionOrder[i+1:], transactionOrder[i:])
+	transactionOrder[i] = t.ID
+}
+
+// reindexTransactions rebuilds transactionOrder after the store has been
+// replaced. It must be called with txMu held.
+func reindexTransactions() {
+	transactionOrder = make([]ID, 0, len(transactions))
+	for id := range transactions {
+		transactionOrder = append(transactionOrder, id)
+	}
+	sort.Slice(transactionOrder, func(i, j int) bool {
+		return createdBefore(transactions[transactionOrder[i]], transactions[transactionOrder[j]])
+	})
+}
+
+func isTerminal(status string) bool {
+	return status == statusCompleted || status == statusFailed
+}
+
+func addTransaction(t Transaction) Transaction {
+	txMu.Lock()
+	defer txMu.Unlock()
+	return insertTransaction(t)
+}
+
+// insertTransaction stores t as a new queued transaction, ignoring any
+// server-managed fields it carries. It must be called with txMu held.
+func insertTransaction(t Transaction) Transaction {
+	t.ID = transactionIDs.NewID()
+	t.Status = statusQueued
+	t.Reason = ""
+	t.Attempts = 0
+	t.Settlement = ""
+	t.SettlesAt = nil
+	t.AcceptBy = nil
+	t.RetryOf = ""
+	t.RetriedBy = ""
+	t.ReviewNote = ""
+	t.ReviewedBy = ""
+	t.ReviewContext = nil
+	t.ConvertedAmount = 0
+	t.ConvertedCurrency = ""
+	t.FXRate = ""
+	t.FXResidual = 0
+	t.Signature, t.SignedAt, t.Nonce = "", 0, ""
+	t.SplitOf = ""
+	t.Legs = append([]SplitLeg(nil), t.Legs...)
+	for i := range t.Legs {
+		t.Legs[i].TransactionID = ""
+	}
+	t.CreatedAt = time.Now().UTC()
+	t.CompletedAt = nil
+	transactions[t.ID] = t
+	indexTransaction(t)
+	return t
+}
+
+func getTransaction(id ID) (Transaction, bool) {
+	txMu.Lock()
+	defer txMu.Unlock()
+	t, ok := transactions[id]
+	return t, ok
+}
+
+func setTransactionStatus(id ID, status, reason string) {
+	txMu.Lock()
+	defer txMu.Unlock()
+	t, ok := transactions[id]
+	if !ok {
+		return
+	}
+	t.Status = status
+	t.Reason = reason
+	if isTerminal(status) {
+		now := time.Now().UTC()
+		t.CompletedAt = &now
+	}
+	transactions[id] = t
+	if isTerminal(status) {
+		wakeWaiters(id)
+	}
+}
+
+func setTransactionMetadata(id ID, metadata map[string]string) {
+	txMu.Lock()
+	defer txMu.Unlock()
+	if t, ok := transactions[id]; ok {
+		t.Metadata = metadata
+		transactions[id] = t
+	}
+}
+
+// startAttempt bumps the stored attempt count and returns it.
+func startAttempt(id ID) int {
+	txMu.Lock()
+	defer txMu.Unlock()
+	t, ok := transactions[id]
+	if !ok {
+		return 0
+	}
+	t.Attempts++
+	transactions[id] = t
+	return t.Attempts
+}
+
+func completeTransaction(t Transaction) {
+	setTransactionStatus(t.ID, statusCompleted, "")
+}
+
+// failTransaction records err as the transaction's failure reason and
+// returns it so callers can `return failTransaction(t, err)`.
+func failTransaction(t Transaction, err error) error {
+	setTransactionStatus(t.ID, statusFailed, err.Error())
+	return err
+}
+
+func GetTransaction(w http.ResponseWriter, r *http.Request) {
+	id := ID(mux.Vars(r)["id"])
+	opts, err := parseResponseOptions(r, transactionFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	expand, err := parseExpand(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	t, ok := getTransaction(id)
+	if !ok {
+		writeError(w, 404, CodeTransactionNotFound, "Transaction not found")
+		return
+	}
+	if expand {
+		writeResponse(w, opts, expandCounterparties([]Transaction{t})[0])
+		return
+	}
+	writeResponse(w, opts, t)
+}
+
+// ListTransactions pages through transactions by ID. user_id keeps only
+// transactions involving that user or an account merged into it, and
+// query parameters of the form meta.<key>=<value> keep only transactions
+// with that metadata.
+func ListTransactions(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	opts, err := parseResponseOptions(r, transactionFields)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	expand, err := parseExpand(r)
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, err.Error())
+		return
+	}
+	filters := make(map[string]string)
+	for k, v := range r.URL.Query() {
+		if strings.HasPrefix(k, "meta.") {
+			filters[strings.TrimPrefix(k, "meta.")] = v[0]
+		}
+	}
+	var accounts map[ID]bool
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		accounts = mergedAccounts(ID(v))
+	}
+
+	txMu.Lock()
+	list := make([]Transaction, 0, len(transactions))
+	for _, t := range transactions {
+		if accounts != nil && !accounts[t.SenderID] && !accounts[t.ReceiverID] {
+			continue
+		}
+		if matchesMetadata(t, filters) {
+			list = append(list, t)
+		}
+	}
+	txMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID.less(list[j].ID) })
+	start, end, p := paginate(len(list), limit, offset)
+
+	if expand {
+		writeResponse(w, opts, Envelope{Data: expandCounterparties(list[start:end]), Pagination: p})
+		return
+	}
+	writeResponse(w, opts, Envelope{Data: list[start:end], Pagination: p})
+}
+
+func matchesMetadata(t Transaction, filters map[string]string) bool {
+	for k, v := range filters {
+		if got, ok := t.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
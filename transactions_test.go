@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTransactionTimestamps(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	before := time.Now()
+
+	w := serve(t, "POST", "/transaction", Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	wantStatus(t, w, 200)
+	var raw map[string]json.RawMessage
+	decode(t, w, &raw)
+	var createdText string
+	json.Unmarshal(raw["created_at"], &createdText)
+	created, err := time.Parse(time.RFC3339Nano, createdText)
+	if err != nil || created.Location() != time.UTC {
+		t.Fatalf("created_at %s is not RFC3339 UTC: %v", raw["created_at"], err)
+	}
+	if _, set := raw["completed_at"]; set {
+		t.Errorf("queued transaction has completed_at %s", raw["completed_at"])
+	}
+
+	drainQueue(t)
+	var queued Transaction
+	decode(t, w, &queued)
+	got, _ := getTransaction(queued.ID)
+	if got.CreatedAt.Before(before) || got.CompletedAt == nil || got.CompletedAt.Before(got.CreatedAt) {
+		t.Errorf("created %v, completed %v, want before <= created <= completed", got.CreatedAt, got.CompletedAt)
+	}
+	if got.CompletedAt.Location() != time.UTC {
+		t.Errorf("completed_at in %v, want UTC", got.CompletedAt.Location())
+	}
+
+	next := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 11})
+	if next.CreatedAt.Before(got.CreatedAt) {
+		t.Errorf("later transaction created at %v, before %v", next.CreatedAt, got.CreatedAt)
+	}
+
+	failed := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 5000})
+	if failed.Status != statusFailed || failed.CompletedAt == nil {
+		t.Errorf("failed transaction: status %s completed_at %v", failed.Status, failed.CompletedAt)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import "math"
+
+// checkTransfer reports why t can't be applied to users, or nil if it can.
+// It only reads users, so it works against the live store (with mu held)
+// or a scratch copy for simulations. Against the live store the caller
+// records the transfer under the same lock, and freezes take that lock
+// too, so both parties' state can't change between this check and the
+// debit and credit.
+func checkTransfer(users map[ID]User, t Transaction) *APIError {
+	// Balances are read at the point of applying, never from a snapshot
+	// taken earlier, so the debit is against the current balance.
+	sender, ok := users[t.SenderID]
+	if !ok {
+		return newError(CodeUserNotFound, "Sender not found")
+	}
+	rec, ok := users[t.ReceiverID]
+	if !ok {
+		return newError(CodeReceiverNotFound, "Receiver not found")
+	}
+	if sender.System || rec.System {
+		return newError(CodeSystemAccount, "Reserve accounts can't send or receive transfers")
+	}
+	if sender.Closed || rec.Closed {
+		return newError(CodeAccountClosed, "Account is closed")
+	}
+	if sender.Frozen || rec.Frozen {
+		return newError(CodeAccountFrozen, "Sender or receiver is frozen")
+	}
+	if sender.Currency != t.Currency || (rec.Currency != t.Currency && rec.Currency != t.ConvertedCurrency) {
+		return newError(CodeCurrencyMismatch, "Accounts do not hold the transaction currency")
+	}
+	if requireVerifiedReceiver && !rec.Verified {
+		return newError(CodeReceiverUnverified, "Receiver is not verified")
+	}
+	if sender.available() < t.Amount+t.Fee {
+		return newError(CodeInsufficientFunds, "Insufficient funds")
+	}
+	if !conditionsMet(t, sender.Balance) {
+		return newError(CodeConditionNotMet, "Transfer condition not met")
+	}
+	if math.IsInf(rec.Balance+t.credited(), 0) {
+		return newError(CodeAmountOverflow, "Transfer would overflow the receiver's balance")
+	}
+	return nil
+}
+
+// applyTransfer moves the funds for t on a scratch copy of users if the
+// transfer is allowed. The live store records a transferred event instead.
+func applyTransfer(users map[ID]User, t Transaction) *APIError {
+	if err := checkTransfer(users, t); err != nil {
+		return err
+	}
+	applyEvent(users, transferEvent(t))
+	return nil
+}
+
+func conditionsMet(t Transaction, balance float64) bool {
+	if t.MinBalanceBefore != nil && balance < *t.MinBalanceBefore {
+		return false
+	}
+	if t.MinBalanceAfter != nil && balance-t.Amount-t.Fee < *t.MinBalanceAfter {
+		return false
+	}
+	return true
+}
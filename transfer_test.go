@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOverflowingTransferIsRejected(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	mu.Lock()
+	for _, id := range []ID{sender.ID, receiver.ID} {
+		u := db[id]
+		u.Balance = math.MaxFloat64
+		db[id] = u
+	}
+	mu.Unlock()
+
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: math.MaxFloat64 / 2})
+	if got.Status != statusFailed || got.Reason != string(CodeAmountOverflow) {
+		t.Errorf("overflowing transfer: status %s reason %q", got.Status, got.Reason)
+	}
+	if b := balance(t, receiver.ID); b != math.MaxFloat64 {
+		t.Errorf("receiver balance %v, want it unchanged", b)
+	}
+	if b := balance(t, sender.ID); b != math.MaxFloat64 {
+		t.Errorf("sender balance %v, want it unchanged", b)
+	}
+
+	wantStatus(t, serve(t, "POST", "/transaction", `{"sender_id": 1, "receiver_id": 2, "amount": 1e400}`), 400)
+}
+
+func TestTransferConditions(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, true)
+	for i, c := range []struct {
+		before, after *float64
+		ok            bool
+	}{
+		{before: floatPtr(1000), ok: true},
+		{after: floatPtr(800), ok: true},
+		{before: floatPtr(1000), ok: false}, // balance is now 800
+		{after: floatPtr(750), ok: false},
+		{before: floatPtr(800), after: floatPtr(700), ok: true},
+	} {
+		got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 100, MinBalanceBefore: c.before, MinBalanceAfter: c.after})
+		if c.ok && got.Status != statusCompleted {
+			t.Errorf("case %d: status %s reason %q, want completed", i, got.Status, got.Reason)
+		}
+		if !c.ok && (got.Status != statusFailed || got.Reason != string(CodeConditionNotMet)) {
+			t.Errorf("case %d: status %s reason %q, want condition_not_met", i, got.Status, got.Reason)
+		}
+	}
+	if balance(t, sender.ID) != 700 {
+		t.Errorf("sender balance %v, want 700", balance(t, sender.ID))
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// KeyStore remembers keys for a limited time. It backs duplicate detection
+// and is an interface so it can later live in Redis instead of memory.
+type KeyStore interface {
+	Get(key string) (interface{}, bool)
+	Set(key string, value interface{}, ttl time.Duration)
+	// SetIfAbsent stores value only if key is missing or expired and
+	// reports whether it did.
+	SetIfAbsent(key string, value interface{}, ttl time.Duration) bool
+	// Pop removes key and returns its value if it had not expired.
+	Pop(key string) (interface{}, bool)
+	Delete(key string)
+}
+
+type ttlItem struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// ttlStore is an in-memory KeyStore. Expired entries are invisible to
+// lookups immediately and are removed by a background janitor.
+type ttlStore struct {
+	mu    sync.RWMutex
+	items map[string]ttlItem
+	now   func() time.Time
+	done  chan struct{}
+}
+
+func newTTLStore(janitorInterval time.Duration) *ttlStore {
+	s := &ttlStore{items: make(map[string]ttlItem), now: time.Now, done: make(chan struct{})}
+	go s.janitor(janitorInterval)
+	return s
+}
+
+func (s *ttlStore) Get(key string) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, ok := s.items[key]
+	if !ok || !s.now().Before(item.expiresAt) {
+		return nil, false
+	}
+	return item.value, true
+}
+
+func (s *ttlStore) Set(key string, value interface{}, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = ttlItem{value, s.now().Add(ttl)}
+}
+
+func (s *ttlStore) SetIfAbsent(key string, value interface{}, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if item, ok := s.items[key]; ok && now.Before(item.expiresAt) {
+		return false
+	}
+	s.items[key] = ttlItem{value, now.Add(ttl)}
+	return true
+}
+
+func (s *ttlStore) Pop(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[key]
+	delete(s.items, key)
+	if !ok || !s.now().Before(item.expiresAt) {
+		return nil, false
+	}
+	return item.value, true
+}
+
+func (s *ttlStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, key)
+}
+
+func (s *ttlStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items)
+}
+
+func (s *ttlStore) Stop() {
+	close(s.done)
+}
+
+func (s *ttlStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.removeExpired()
+		}
+	}
+}
+
+// removeExpired finds stale keys under the read lock so lookups continue,
+// then takes the write lock only briefly to delete them.
+func (s *ttlStore) removeExpired() {
+	now := s.now()
+	var stale []string
+	s.mu.RLock()
+	for k, item := range s.items {
+		if !now.Before(item.expiresAt) {
+			stale = append(stale, k)
+		}
+	}
+	s.mu.RUnlock()
+	if len(stale) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range stale {
+		// The key may have been refreshed since we looked
+		if item, ok := s.items[k]; ok && !now.Before(item.expiresAt) {
+			delete(s.items, k)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTTLStoreExpiry(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	s := newClockedStore(clock)
+
+	s.Set("a", 1, time.Minute)
+	if v, ok := s.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %v, %v", v, ok)
+	}
+	if s.SetIfAbsent("a", 2, time.Minute) {
+		t.Error("SetIfAbsent replaced a live key")
+	}
+	clock.advance(time.Minute)
+	if _, ok := s.Get("a"); ok {
+		t.Error("expired key still visible")
+	}
+	if !s.SetIfAbsent("a", 3, time.Minute) {
+		t.Error("SetIfAbsent refused an expired key")
+	}
+	if v, ok := s.Pop("a"); !ok || v != 3 {
+		t.Errorf("Pop(a) = %v, %v", v, ok)
+	}
+	if _, ok := s.Pop("a"); ok {
+		t.Error("key still there after Pop")
+	}
+	s.Set("b", 1, time.Minute)
+	s.Delete("b")
+	if _, ok := s.Get("b"); ok {
+		t.Error("key still there after Delete")
+	}
+}
+
+// The janitor drops expired keys while lookups of live ones carry on.
+func TestTTLStoreJanitor(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	s := newClockedStore(clock)
+	for i := 0; i < 1000; i++ {
+		s.Set(fmt.Sprint("stale", i), i, time.Second)
+	}
+	clock.advance(2 * time.Second)
+	s.Set("live", true, time.Hour)
+
+	go s.janitor(time.Millisecond)
+	defer s.Stop()
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for j := 0; j < 1000; j++ {
+				if _, ok := s.Get("live"); !ok {
+					t.Error("live key missing during cleanup")
+					return
+				}
+			}
+		}()
+	}
+	waitFor(t, "the janitor", func() bool { return s.Len() == 1 })
+	readers.Wait()
+}
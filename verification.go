@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// verificationSecret is shared with the external verification (KYC)
+// provider, which signs each callback body with it. Callbacks are refused
+// while it is unset.
+var verificationSecret string
+
+const (
+	decisionApproved = "approved"
+	decisionRejected = "rejected"
+)
+
+// VerificationDecision is the provider's decision on a user.
+type VerificationDecision struct {
+	UserID   ID     `json:"user_id"`
+	Decision string `json:"decision"`
+}
+
+type VerificationResult struct {
+	UserID   ID     `json:"user_id"`
+	Decision string `json:"decision"`
+	// Applied is false when the user already had this decision, e.g. for
+	// a redelivered callback.
+	Applied bool `json:"applied"`
+	User    User `json:"user"`
+}
+
+// awaitingVerification holds transfers from senders who are not verified
+// yet, in submission order, until the sender's decision.
+var awaitingMu sync.Mutex
+var awaitingVerification = make(map[ID][]Transaction)
+
+// awaitVerification parks t if its sender is still awaiting verification
+// and reports whether it did. mu is held across the check and the park so
+// a decision can't be recorded in between and strand t.
+func awaitVerification(t Transaction) bool {
+	if !verificationEnabled {
+		return false
+	}
+	mu.RLock()
+	u, ok := db[t.SenderID]
+	waiting := ok && !u.Verified && !u.VerificationRejected
+	if waiting {
+		awaitingMu.Lock()
+		awaitingVerification[t.SenderID] = append(awaitingVerification[t.SenderID], t)
+		awaitingMu.Unlock()
+	}
+	mu.RUnlock()
+	if waiting {
+		addToVerificationQueue(u)
+	}
+	return waiting
+}
+
+// releaseAwaiting requeues id's parked transfers once they are approved,
+// or fails them if rejected. It must be called with mu held, after the
+// decision's event has been recorded. Approved transfers released during
+// shutdown stay queued in the saved state, to be requeued on restart.
+func releaseAwaiting(id ID, approved bool) {
+	awaitingMu.Lock()
+	parked := awaitingVerification[id]
+	delete(awaitingVerification, id)
+	awaitingMu.Unlock()
+	for _, t := range parked {
+		if approved {
+			if !isShuttingDown() {
+				requeueTransaction(t)
+			}
+		} else {
+			failTransaction(t, newError(CodeSenderUnverified, "Sender failed verification"))
+		}
+	}
+}
+
+// awaitVerificationCallback replaces verifyUser when a provider is
+// configured: queued users stay unverified until their callback arrives.
+func awaitVerificationCallback(User) error {
+	return nil
+}
+
+// signCallback returns the hex HMAC-SHA256 of a callback body.
+func signCallback(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// applyVerificationDecision records the decision unless the user already
+// has it, so providers can redeliver callbacks safely.
+func applyVerificationDecision(id ID, decision string) (User, bool, *APIError) {
+	mu.Lock()
+	defer mu.Unlock()
+	u, ok := db[id]
+	if !ok {
+		return u, false, newError(CodeUserNotFound, "User not found")
+	}
+	if u.System {
+		return u, false, newError(CodeSystemAccount, "Reserve accounts aren't verified")
+	}
+	if decision == decisionApproved {
+		if u.Verified {
+			return u, false, nil
+		}
+		recordEvent(Event{Type: eventVerified, UserID: id})
+		notifyUser(db[id], eventVerificationDone, "your account is verified")
+		releaseAwaiting(id, true)
+	} else {
+		if u.VerificationRejected {
+			return u, false, nil
+		}
+		recordEvent(Event{Type: eventVerificationRejected, UserID: id})
+		releaseAwaiting(id, false)
+	}
+	return db[id], true, nil
+}
+
+// VerificationCallback handles POST /verification/callback. The provider
+// signs the raw body and sends the hex digest in X-Signature.
+func VerificationCallback(w http.ResponseWriter, r *http.Request) {
+	if verificationSecret == "" {
+		writeError(w, 404, CodeNotFound, "Verification callbacks are not enabled")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		writeError(w, 400, CodeBadRequest, "Can't read request body")
+		return
+	}
+	want := signCallback(body, verificationSecret)
+	got := strings.ToLower(r.Header.Get("X-Signature"))
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		writeError(w, 401, CodeInvalidSignature, "Callback signature does not match")
+		return
+	}
+	var cb VerificationDecision
+	if err := json.Unmarshal(body, &cb); err != nil || cb.UserID == "" {
+		writeError(w, 400, CodeBadRequest, "user_id and decision are required")
+		return
+	}
+	if cb.Decision != decisionApproved && cb.Decision != decisionRejected {
+		writeError(w, 400, CodeBadRequest, `decision must be "approved" or "rejected"`)
+		return
+	}
+	user, applied, apiErr := applyVerificationDecision(cb.UserID, cb.Decision)
+	if apiErr != nil {
+		status := 400
+		if apiErr.Code == CodeUserNotFound {
+			status = 404
+		}
+		writeAPIError(w, status, apiErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VerificationResult{UserID: cb.UserID, Decision: cb.Decision, Applied: applied, User: user})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// A transfer from an unverified sender waits for verification without
+// being retried, and goes through once the sender is verified.
+func TestUnverifiedSenderIsParked(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, false), newUser(t, true)
+
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 25})
+	if got.Status != statusQueued || got.Attempts != 0 {
+		t.Fatalf("parked transfer: status %s, %d attempts", got.Status, got.Attempts)
+	}
+	if n := len(transactionQueue); n != 0 {
+		t.Errorf("parked transfer was requeued: %d on the queue", n)
+	}
+	if len(failures) != 0 {
+		t.Errorf("parking recorded failures: %v", failures)
+	}
+	if n := len(verificationQueue); n != 1 {
+		t.Errorf("%d users queued for verification, want 1", n)
+	}
+
+	if err := verifyUser(sender); err != nil {
+		t.Fatal(err)
+	}
+	drainQueue(t)
+	got, _ = getTransaction(got.ID)
+	if got.Status != statusCompleted || got.Attempts != 1 {
+		t.Errorf("after verification: status %s reason %q, %d attempts", got.Status, got.Reason, got.Attempts)
+	}
+	if balance(t, receiver.ID) != 1025 {
+		t.Errorf("receiver balance %v, want 1025", balance(t, receiver.ID))
+	}
+}
+
+func verificationCallback(t *testing.T, id ID, decision, secret string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(VerificationDecision{UserID: id, Decision: decision})
+	return serve(t, "POST", "/verification/callback", string(body), "X-Signature", signCallback(body, secret))
+}
+
+func TestVerificationCallback(t *testing.T) {
+	resetStore(t)
+	verificationSecret = "provider-secret"
+	u := newUser(t, false)
+
+	var res VerificationResult
+	w := verificationCallback(t, u.ID, decisionApproved, verificationSecret)
+	wantStatus(t, w, 200)
+	decode(t, w, &res)
+	if !res.Applied || !res.User.Verified {
+		t.Errorf("first callback: %+v", res)
+	}
+
+	seq := len(events)
+	w = verificationCallback(t, u.ID, decisionApproved, verificationSecret)
+	wantStatus(t, w, 200)
+	decode(t, w, &res)
+	if res.Applied || len(events) != seq {
+		t.Errorf("replayed callback was applied again: %+v", res)
+	}
+
+	wantStatus(t, verificationCallback(t, u.ID, decisionRejected, "wrong-secret"), 401)
+	if current, _ := getUser(u.ID); !current.Verified {
+		t.Error("a badly signed callback changed the user")
+	}
+	wantStatus(t, verificationCallback(t, "999", decisionApproved, verificationSecret), 404)
+}
+
+func TestVerificationCallbackReleasesParkedTransfers(t *testing.T) {
+	resetStore(t)
+	verificationSecret = "provider-secret"
+	approved, rejected, receiver := newUser(t, false), newUser(t, false), newUser(t, true)
+	first := transfer(t, Transaction{SenderID: approved.ID, ReceiverID: receiver.ID, Amount: 10})
+	second := transfer(t, Transaction{SenderID: rejected.ID, ReceiverID: receiver.ID, Amount: 20})
+
+	wantStatus(t, verificationCallback(t, approved.ID, decisionApproved, verificationSecret), 200)
+	wantStatus(t, verificationCallback(t, rejected.ID, decisionRejected, verificationSecret), 200)
+	drainQueue(t)
+
+	if got, _ := getTransaction(first.ID); got.Status != statusCompleted {
+		t.Errorf("approved sender's transfer: status %s reason %q", got.Status, got.Reason)
+	}
+	if got, _ := getTransaction(second.ID); got.Status != statusFailed || got.Reason != string(CodeSenderUnverified) {
+		t.Errorf("rejected sender's transfer: status %s reason %q", got.Status, got.Reason)
+	}
+}
+
+func TestUnverifiedReceiverPolicy(t *testing.T) {
+	resetStore(t)
+	sender, receiver := newUser(t, true), newUser(t, false)
+
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	if got.Status != statusCompleted {
+		t.Errorf("default policy: status %s reason %q", got.Status, got.Reason)
+	}
+
+	requireVerifiedReceiver = true
+	got = transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 20})
+	if got.Status != statusFailed || got.Reason != string(CodeReceiverUnverified) {
+		t.Errorf("enforced policy: status %s reason %q", got.Status, got.Reason)
+	}
+	if balance(t, receiver.ID) != 1010 {
+		t.Errorf("receiver balance %v, want 1010", balance(t, receiver.ID))
+	}
+	verified := newUser(t, true)
+	got = transfer(t, Transaction{SenderID: sender.ID, ReceiverID: verified.ID, Amount: 30})
+	if got.Status != statusCompleted {
+		t.Errorf("verified receiver under enforced policy: status %s reason %q", got.Status, got.Reason)
+	}
+}
+
+// Verifying from a stale copy of a user doesn't undo balance changes made
+// since the copy was taken, and vice versa.
+func TestVerificationKeepsBalanceChanges(t *testing.T) {
+	resetStore(t)
+	sender := newUser(t, true)
+	stale := newUser(t, false)
+	transfer(t, Transaction{SenderID: sender.ID, ReceiverID: stale.ID, Amount: 50})
+	if err := verifyUser(stale); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := getUser(stale.ID)
+	if !got.Verified || got.Balance != 1050 {
+		t.Errorf("after a transfer then a stale verify: verified %v balance %v", got.Verified, got.Balance)
+	}
+
+	receivers := make([]User, 20)
+	for i := range receivers {
+		receivers[i] = newUser(t, false)
+	}
+	startWorkers(t, 4)
+	var queued []ID
+	for _, r := range receivers {
+		tx := addTransaction(Transaction{SenderID: sender.ID, ReceiverID: r.ID, Amount: 1, Currency: defaultCurrency})
+		enqueueTransaction(tx)
+		queued = append(queued, tx.ID)
+	}
+	for _, r := range receivers {
+		verifyUser(r)
+	}
+	for _, id := range queued {
+		waitFor(t, "transfer "+string(id), hasStatus(id, statusCompleted))
+	}
+	for _, r := range receivers {
+		got, _ := getUser(r.ID)
+		if !got.Verified || got.Balance != 1001 {
+			t.Errorf("user %s: verified %v balance %v", r.ID, got.Verified, got.Balance)
+		}
+	}
+}
+
+func TestVerificationDisabled(t *testing.T) {
+	resetStore(t)
+	verificationEnabled = false
+	w := serve(t, "POST", "/user", User{})
+	wantStatus(t, w, 200)
+	var sender User
+	decode(t, w, &sender)
+	if !sender.Verified || len(verificationQueue) != 0 {
+		t.Fatalf("new user verified %v with %d queued for verification", sender.Verified, len(verificationQueue))
+	}
+	receiver := newUser(t, false)
+
+	got := transfer(t, Transaction{SenderID: sender.ID, ReceiverID: receiver.ID, Amount: 10})
+	if got.Status != statusCompleted || got.Attempts != 1 {
+		t.Errorf("first transfer: status %s after %d attempts", got.Status, got.Attempts)
+	}
+	if n := len(verificationQueue); n != 0 {
+		t.Errorf("%d users queued for verification", n)
+	}
+}
+
+func TestUserIsVerifiedOnce(t *testing.T) {
+	resetStore(t)
+	rec := &recordingNotifier{}
+	notifier = rec
+	w := serve(t, "POST", "/user", User{})
+	wantStatus(t, w, 200)
+	var u User
+	decode(t, w, &u)
+	receiver := newUser(t, true)
+
+	// two transfers bouncing off the unverified sender
+	transfer(t, Transaction{SenderID: u.ID, ReceiverID: receiver.ID, Amount: 1})
+	transfer(t, Transaction{SenderID: u.ID, ReceiverID: receiver.ID, Amount: 2})
+	addToVerificationQueue(u)
+	if n := len(verificationQueue); n != 1 {
+		t.Fatalf("user queued %d times, want once", n)
+	}
+
+	// as the verification worker runs it
+	queued := <-verificationQueue
+	verificationClock.pop()
+	addToVerificationQueue(u)
+	if n := len(verificationQueue); n != 0 {
+		t.Errorf("user requeued while being verified")
+	}
+	verifyUser(queued)
+	doneVerifying(queued.ID)
+	addToVerificationQueue(u)
+	verifyUser(u)
+	if n := len(verificationQueue); n != 0 {
+		t.Errorf("verified user requeued")
+	}
+
+	verified := 0
+	for _, e := range events {
+		if e.Type == eventVerified && e.UserID == u.ID {
+			verified++
+		}
+	}
+	rec.settled(t)
+	if verified != 1 || rec.count(u.ID, eventVerificationDone) != 1 {
+		t.Errorf("%d verified events and %d notifications, want one each", verified, rec.count(u.ID, eventVerificationDone))
+	}
+	drainQueue(t)
+	if balance(t, receiver.ID) != 1003 {
+		t.Errorf("receiver balance %v after release, want 1003", balance(t, receiver.ID))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+var poolMinWorkers = 2
+var poolMaxWorkers = 8
+var poolScaleThreshold = 100
+var poolScaleCooldown = 5 * time.Second
+
+var transactionPool *workerPool
+
+// workerPool drains queue with between min and max workers, adding one
+// while the backlog is above threshold and retiring one once it is empty.
+// At most one scaling step happens per cooldown so bursts don't flap.
+type workerPool struct {
+	queue     chan Transaction
+	f         func(worker string, t Transaction) error
+	min, max  int
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	stops     []chan struct{}
+	lastScale time.Time
+	spawned   int
+}
+
+func newWorkerPool(queue chan Transaction, f func(worker string, t Transaction) error, min, max, threshold int, cooldown time.Duration) *workerPool {
+	if max < min {
+		max = min
+	}
+	return &workerPool{queue: queue, f: f, min: min, max: max, threshold: threshold, cooldown: cooldown}
+}
+
+func (p *workerPool) run(interval time.Duration) {
+	p.mu.Lock()
+	for len(p.stops) < p.min {
+		p.spawn()
+	}
+	p.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		p.scale(now)
+	}
+}
+
+func (p *workerPool) scale(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now.Sub(p.lastScale) < p.cooldown {
+		return
+	}
+	depth := len(p.queue)
+	switch {
+	case depth > p.threshold && len(p.stops) < p.max:
+		p.spawn()
+	case depth == 0 && len(p.stops) > p.min:
+		p.retire()
+	default:
+		return
+	}
+	p.lastScale = now
+}
+
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.stops)
+}
+
+// spawn and retire must be called with p.mu held.
+func (p *workerPool) spawn() {
+	stop := make(chan struct{})
+	p.stops = append(p.stops, stop)
+	p.spawned++
+	go p.work("worker-"+strconv.Itoa(p.spawned), stop)
+}
+
+func (p *workerPool) retire() {
+	last := len(p.stops) - 1
+	close(p.stops[last])
+	p.stops = p.stops[:last]
+}
+
+func (p *workerPool) work(name string, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case t := <-p.queue:
+			p.f(name, t)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolScalesWithBacklog(t *testing.T) {
+	queue := make(chan Transaction, 100)
+	gate := make(chan struct{})
+	done := make(chan struct{}, 100)
+	p := newWorkerPool(queue, func(string, Transaction) error {
+		<-gate
+		done <- struct{}{}
+		return nil
+	}, 1, 4, 2, 0)
+	p.mu.Lock()
+	p.spawn()
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		for len(p.stops) > 0 {
+			p.retire()
+		}
+		p.mu.Unlock()
+	}()
+
+	for i := 0; i < 20; i++ {
+		queue <- Transaction{ID: ID(string(rune('a' + i)))}
+	}
+	for i := 0; i < 10; i++ {
+		p.scale(time.Now())
+	}
+	if n := p.size(); n != 4 {
+		t.Fatalf("%d workers under a burst, want the max of 4", n)
+	}
+
+	close(gate)
+	for i := 0; i < 20; i++ {
+		<-done
+	}
+	for i := 0; i < 10; i++ {
+		p.scale(time.Now())
+	}
+	if n := p.size(); n != 1 {
+		t.Errorf("%d workers after draining, want the min of 1", n)
+	}
+}
+
+func TestWorkerPoolScalingIsDebounced(t *testing.T) {
+	queue := make(chan Transaction, 100)
+	for i := 0; i < 10; i++ {
+		queue <- Transaction{}
+	}
+	gate := make(chan struct{})
+	defer close(gate)
+	p := newWorkerPool(queue, func(string, Transaction) error {
+		<-gate
+		return nil
+	}, 0, 4, 2, time.Minute)
+
+	now := time.Now()
+	p.scale(now)
+	p.scale(now.Add(time.Second))
+	if n := p.size(); n != 1 {
+		t.Fatalf("%d workers within one cooldown, want 1", n)
+	}
+	p.scale(now.Add(2 * time.Minute))
+	if n := p.size(); n != 2 {
+		t.Errorf("%d workers after the cooldown, want 2", n)
+	}
+}